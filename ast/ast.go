@@ -249,6 +249,26 @@ func (sl *StringLiteral) String() string {
 	return "'" + sl.Token.Literal + "'"
 }
 
+// Attribute of the principal the query is built for. Ex. $principal.clinics
+type PrincipalAttribute struct {
+	Token token.Token
+	Name  string
+}
+
+func (pa *PrincipalAttribute) expressionNode()      {}
+func (pa *PrincipalAttribute) TokenLiteral() string { return pa.Token.Literal }
+func (pa *PrincipalAttribute) String() string       { return pa.Token.Literal }
+
+// Value bound when a compiled plan is executed. Ex. $param.since
+type Parameter struct {
+	Token token.Token
+	Name  string
+}
+
+func (p *Parameter) expressionNode()      {}
+func (p *Parameter) TokenLiteral() string { return p.Token.Literal }
+func (p *Parameter) String() string       { return p.Token.Literal }
+
 // @ token
 // Can reference the last Column or be used as a function to call a column
 type Reference struct {
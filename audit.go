@@ -0,0 +1,91 @@
+package dyre
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/Team-Solutions-Dental/dyre/transpiler"
+)
+
+// Destination of audit records, ex. a file, a log pipeline or an audit table
+type AuditSink interface {
+	Write(ctx context.Context, record *transpiler.AuditRecord) error
+}
+
+// Writes each record as one line of JSON. Safe for concurrent use.
+type JSONLinesSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{w: w}
+}
+
+// Append records to the file at path, creating it readable only by the owner
+func OpenJSONLinesSink(path string) (*JSONLinesSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesSink{w: file, closer: file}, nil
+}
+
+func (s *JSONLinesSink) Write(ctx context.Context, record *transpiler.AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(line)
+	return err
+}
+
+// Close the file of OpenJSONLinesSink. Writers passed to NewJSONLinesSink are left open.
+func (s *JSONLinesSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// Record every audited request in sink. Nil disables auditing.
+func (d *Dyre) SetAuditSink(sink AuditSink) {
+	d.audit = sink
+}
+
+// Write the audit record of an evaluated request to the audit sink.
+// Does nothing without a sink.
+func (d *Dyre) Audit(ctx context.Context, pir *transpiler.PrimaryIR) error {
+	if d.audit == nil {
+		return nil
+	}
+	record, err := pir.Audit()
+	if err != nil {
+		return err
+	}
+	return d.audit.Write(ctx, record)
+}
+
+// Write the audit record of a request served by plan to the audit sink.
+// Does nothing without a sink.
+func (d *Dyre) AuditPlan(ctx context.Context, plan *transpiler.Plan, subject string) error {
+	if d.audit == nil {
+		return nil
+	}
+	return d.audit.Write(ctx, plan.Audit(subject))
+}
+
+// Caller recorded in audit records. Ex. a user ID
+func WithSubject(id string) RequestOption {
+	return func(o *transpiler.Options) {
+		o.Subject = id
+	}
+}
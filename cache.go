@@ -0,0 +1,287 @@
+package dyre
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Team-Solutions-Dental/dyre/endpoint"
+	"github.com/Team-Solutions-Dental/dyre/transpiler"
+)
+
+// Number of compiled plans kept by Init
+const DefaultPlanCacheSize = 256
+
+// Request compiled into a cached plan.
+// Requests with the same fields share a plan.
+type PlanRequest struct {
+	Endpoint string
+	Query    string
+	Joins    []PlanJoin
+	OrderBy  string
+	// Principals with the same class have the same permissions and share plans.
+	// Checker decides the permissions of the class when the plan is compiled. Requests with a Checker require a class.
+	PrincipalClass string
+	Checker        endpoint.ContextChecker
+	Context        context.Context
+	// Tenant of the request, see WithTenant
+	Tenant any
+	// Request exports rows, see WithExport
+	Export bool
+	// Select the join keys of Nest, see WithNest
+	Nest bool
+}
+
+// Join of a PlanRequest. Ex. {Type: "LEFT", Join: "Invoices", Query: "Balance: > 0;"}
+type PlanJoin struct {
+	Type  string
+	Join  string
+	Query string
+}
+
+func (pr *PlanRequest) key() string {
+	var sb strings.Builder
+	tenant := ""
+	if pr.Tenant != nil {
+		tenant = fmt.Sprintf("%T:%v", pr.Tenant, pr.Tenant)
+	}
+	export := ""
+	if pr.Export {
+		export = "export"
+	}
+	nest := ""
+	if pr.Nest {
+		nest = "nest"
+	}
+	// Plans compiled without a checker skip security and are not shared with checked requests
+	checked := ""
+	if pr.Checker != nil {
+		checked = "checked"
+	}
+	for _, s := range []string{pr.Endpoint, pr.Query, pr.OrderBy, pr.PrincipalClass, checked, tenant, export, nest} {
+		sb.WriteString(s)
+		sb.WriteByte(0)
+	}
+	for _, j := range pr.Joins {
+		sb.WriteString(j.Type)
+		sb.WriteByte(0)
+		sb.WriteString(j.Join)
+		sb.WriteByte(0)
+		sb.WriteString(j.Query)
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
+
+type PlanCacheStats struct {
+	Hits     int
+	Misses   int
+	Size     int
+	Capacity int
+}
+
+// Least recently used cache of compiled plans
+type planCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // Front is the most recently used
+	entries  map[string]*list.Element
+	hits     int
+	misses   int
+	// Principal attributes read by the row filters of a request's plans.
+	// Plans of these requests are cached per attribute value.
+	attributes map[string]*planAttributes
+}
+
+type planAttributes struct {
+	names []string
+	plans int // Cached plans of the request
+}
+
+type planCacheEntry struct {
+	key     string
+	request string // Key of the request without principal attributes
+	plan    *transpiler.Plan
+}
+
+func newPlanCache(capacity int) *planCache {
+	return &planCache{capacity: capacity, order: list.New(), entries: map[string]*list.Element{}, attributes: map[string]*planAttributes{}}
+}
+
+// Key of the request with the values of the principal attributes. False when the principal lacks an attribute
+func attributeKey(request string, names []string, principal endpoint.Principal) (string, bool) {
+	if principal == nil {
+		return "", false
+	}
+
+	var sb strings.Builder
+	sb.WriteString(request)
+	for _, name := range names {
+		value, ok := principal.Attribute(name)
+		if !ok {
+			return "", false
+		}
+		fmt.Fprintf(&sb, "%s\x00%#v\x00", name, value)
+	}
+	return sb.String(), true
+}
+
+func (pc *planCache) get(request string, principal endpoint.Principal) (*transpiler.Plan, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	key := request
+	if pa, ok := pc.attributes[request]; ok {
+		if key, ok = attributeKey(request, pa.names, principal); !ok {
+			pc.misses++
+			return nil, false
+		}
+	}
+
+	el, ok := pc.entries[key]
+	if !ok {
+		pc.misses++
+		return nil, false
+	}
+	pc.hits++
+	pc.order.MoveToFront(el)
+	return el.Value.(*planCacheEntry).plan, true
+}
+
+func (pc *planCache) add(request string, plan *transpiler.Plan) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	key := request
+	attributes := plan.PrincipalAttributes()
+	var names []string
+	if len(attributes) > 0 {
+		for name := range attributes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		key, _ = attributeKey(request, names, endpoint.PrincipalMap(attributes))
+	}
+
+	if el, ok := pc.entries[key]; ok {
+		el.Value.(*planCacheEntry).plan = plan
+		pc.order.MoveToFront(el)
+		return
+	}
+
+	if names != nil {
+		pa, ok := pc.attributes[request]
+		if !ok {
+			pa = &planAttributes{names: names}
+			pc.attributes[request] = pa
+		}
+		pa.plans++
+	}
+
+	pc.entries[key] = pc.order.PushFront(&planCacheEntry{key: key, request: request, plan: plan})
+	for pc.order.Len() > pc.capacity {
+		oldest := pc.order.Remove(pc.order.Back()).(*planCacheEntry)
+		delete(pc.entries, oldest.key)
+		if pa, ok := pc.attributes[oldest.request]; ok {
+			if pa.plans--; pa.plans == 0 {
+				delete(pc.attributes, oldest.request)
+			}
+		}
+	}
+}
+
+// Drop the cached plans, ex. after the service settings change. Stats are kept
+func (pc *planCache) clear() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pc.order.Init()
+	pc.entries = map[string]*list.Element{}
+	pc.attributes = map[string]*planAttributes{}
+}
+
+func (pc *planCache) stats() PlanCacheStats {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	return PlanCacheStats{Hits: pc.hits, Misses: pc.misses, Size: pc.order.Len(), Capacity: pc.capacity}
+}
+
+// Keep up to size compiled plans. A size of 0 disables the cache.
+func (d *Dyre) SetPlanCacheSize(size int) {
+	if size <= 0 {
+		d.cache = nil
+		return
+	}
+	d.cache = newPlanCache(size)
+}
+
+func (d *Dyre) PlanCacheStats() PlanCacheStats {
+	if d.cache == nil {
+		return PlanCacheStats{}
+	}
+	return d.cache.stats()
+}
+
+// Compiled plan of the request, from the cache when the same request was compiled before.
+// Plans with row filters are only reused for principals with the same values of the attributes the filters read.
+// Errors are not cached.
+func (d *Dyre) Plan(req PlanRequest) (*transpiler.Plan, error) {
+	if req.Checker != nil && req.PrincipalClass == "" {
+		return nil, errors.New("PrincipalClass required for a plan request with a Checker")
+	}
+
+	key := req.key()
+	if d.cache != nil {
+		principal, _ := req.Checker.(endpoint.Principal)
+		if plan, ok := d.cache.get(key, principal); ok {
+			return plan, nil
+		}
+	}
+
+	plan, err := d.compile(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.cache != nil {
+		d.cache.add(key, plan)
+	}
+	return plan, nil
+}
+
+func (d *Dyre) compile(req PlanRequest) (*transpiler.Plan, error) {
+	ep, ok := d.service.Endpoints[req.Endpoint]
+	if !ok {
+		return nil, errors.New("Invalid Endpoint. got=" + req.Endpoint)
+	}
+
+	pir, err := newRequest(req.Context, req.Checker, d.mode, ep, req.Query, WithTenant(req.Tenant), WithExport(req.Export), WithNest(req.Nest))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, j := range req.Joins {
+		join, err := pir.AUTOJOIN(j.Type, j.Join)
+		if err != nil {
+			return nil, err
+		}
+		_, err = join.Query(j.Query)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if req.OrderBy != "" {
+		err = pir.OrderBy(req.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pir.Compile()
+}
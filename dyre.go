@@ -1,6 +1,7 @@
 package dyre
 
 import (
+	"context"
 	"errors"
 	"io"
 	"log"
@@ -10,8 +11,14 @@ import (
 	"github.com/Team-Solutions-Dental/dyre/transpiler"
 )
 
+// Init with SecurityOptional. Requests without a checker are not checked.
 func Init(filepath string) Dyre {
+	return InitWithSecurity(filepath, SecurityOptional)
+}
+
+func InitWithSecurity(filepath string, mode SecurityMode) Dyre {
 	var dyre Dyre
+	dyre.mode = mode
 
 	json_bytes := openDyreJSON(filepath)
 	service, err := endpoint.ParseJSON(json_bytes)
@@ -20,6 +27,7 @@ func Init(filepath string) Dyre {
 	}
 
 	dyre.service = service
+	dyre.SetPlanCacheSize(DefaultPlanCacheSize)
 
 	return dyre
 }
@@ -42,8 +50,23 @@ func openDyreJSON(path string) []byte {
 
 }
 
+// How requests without a security checker are handled
+type SecurityMode int
+
+const (
+	// Requests without a checker skip security checks
+	SecurityOptional SecurityMode = iota
+	// Requests without a checker are refused for endpoints that declare security, including joined endpoints
+	SecurityStrict
+	// Every request needs a checker
+	SecurityRequired
+)
+
 type Dyre struct {
 	service *endpoint.Service
+	cache   *planCache
+	mode    SecurityMode
+	audit   AuditSink
 }
 
 func (d *Dyre) Endpoint(req string) (*Endpoint, error) {
@@ -52,16 +75,98 @@ func (d *Dyre) Endpoint(req string) (*Endpoint, error) {
 		return nil, errors.New("Invalid Endpoint. got=" + req)
 	}
 
-	return &Endpoint{ref: endpoint}, nil
+	return &Endpoint{ref: endpoint, mode: d.mode}, nil
 }
 
-func (d *Dyre) Request(req string, query string) (*transpiler.PrimaryIR, error) {
-	endpoint, ok := d.service.Endpoints[req]
+// Request without a security checker. Refused by SecurityRequired and by SecurityStrict for secured endpoints.
+func (d *Dyre) Request(req string, query string, opts ...RequestOption) (*transpiler.PrimaryIR, error) {
+	return d.RequestAs(context.Background(), nil, req, query, opts...)
+}
+
+// Request checked against the permissions of the caller.
+// A checker implementing endpoint.Principal provides the attributes read by row filters.
+func (d *Dyre) RequestAs(ctx context.Context, checker endpoint.ContextChecker, req string, query string, opts ...RequestOption) (*transpiler.PrimaryIR, error) {
+	ep, ok := d.service.Endpoints[req]
 	if !ok {
 		return nil, errors.New("Invalid Endpoint. got=" + req)
 	}
 
-	return transpiler.New(query, endpoint)
+	return newRequest(ctx, checker, d.mode, ep, query, opts...)
+}
+
+// Store all tenants in the same tables, see endpoint.Service.SetTenantColumns.
+// Requests of the listed endpoints need WithTenant. Cached plans are dropped.
+func (d *Dyre) SetTenantColumns(columns map[string]string) error {
+	if err := d.service.SetTenantColumns(columns); err != nil {
+		return err
+	}
+	if d.cache != nil {
+		d.cache.clear()
+	}
+	return nil
+}
+
+// Optional settings of a request
+type RequestOption func(*transpiler.Options)
+
+// Limit the request to the rows of a tenant. A string or integer
+func WithTenant(id any) RequestOption {
+	return func(o *transpiler.Options) {
+		o.Tenant = id
+	}
+}
+
+// Request exports rows, ex. a CSV download. Endpoints with an export policy require it.
+func WithExport(export bool) RequestOption {
+	return func(o *transpiler.Options) {
+		o.Export = export
+	}
+}
+
+// Select the join keys Nest groups rows by when the query does not. They are left out of the documents.
+func WithNest(nest bool) RequestOption {
+	return func(o *transpiler.Options) {
+		o.Nest = nest
+	}
+}
+
+// Endpoints, fields and joins the principal of the checker may access.
+// A checker is required unless the security mode is SecurityOptional.
+func (d *Dyre) VisibleTo(ctx context.Context, checker endpoint.ContextChecker) (*endpoint.VisibleService, error) {
+	if checker == nil && d.mode != SecurityOptional {
+		return nil, errors.New("security checker required for the visible schema")
+	}
+	return d.service.VisibleToContext(ctx, checker)
+}
+
+// Fields any caller can select, see endpoint.Service.UnprotectedFields
+func (d *Dyre) UnprotectedFields() []endpoint.UnprotectedField {
+	return d.service.UnprotectedFields()
+}
+
+func (d *Dyre) SecurityMode() SecurityMode {
+	return d.mode
+}
+
+func newRequest(ctx context.Context, checker endpoint.ContextChecker, mode SecurityMode, ep *endpoint.Endpoint, query string, opts ...RequestOption) (*transpiler.PrimaryIR, error) {
+	if checker == nil && mode == SecurityRequired {
+		return nil, errors.New("security checker required for endpoint " + ep.Name)
+	}
+
+	// Checkers that know the caller provide the attributes of row filters
+	principal, _ := checker.(endpoint.Principal)
+
+	options := transpiler.Options{
+		Context:   ctx,
+		Checker:   checker,
+		Strict:    mode == SecurityStrict,
+		Principal: principal,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return transpiler.NewWithOptions(query, ep, options)
 }
 
 func (d *Dyre) EndpointNames() []string {
@@ -78,21 +183,43 @@ func (d *Dyre) AllEndpointPaths(depth int) [][]string {
 }
 
 type Endpoint struct {
-	ref *endpoint.Endpoint
+	ref  *endpoint.Endpoint
+	mode SecurityMode
+}
+
+func (e *Endpoint) Request(query string, opts ...RequestOption) (*transpiler.PrimaryIR, error) {
+	return e.RequestAs(context.Background(), nil, query, opts...)
 }
 
-func (e *Endpoint) Request(query string) (*transpiler.PrimaryIR, error) {
-	return transpiler.New(query, e.ref)
+func (e *Endpoint) RequestAs(ctx context.Context, checker endpoint.ContextChecker, query string, opts ...RequestOption) (*transpiler.PrimaryIR, error) {
+	return newRequest(ctx, checker, e.mode, e.ref, query, opts...)
 }
 
 func (e *Endpoint) Fields() []string {
 	return e.ref.FieldNames
 }
 
+// Classification of the field, ex. "phi". Empty when the field is not classified
+func (e *Endpoint) Classification(field string) string {
+	return e.ref.Fields[field].Classification
+}
+
+// Names of the fields with the classification
+func (e *Endpoint) ClassifiedFields(classification string) []string {
+	var fields []string
+	for _, name := range e.ref.FieldNames {
+		if e.ref.Fields[name].Classification == classification {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
 func (e *Endpoint) Joins() []string {
 	var joins []string
-	for _, j := range e.ref.Joins {
-		joins = append(joins, j.Name())
+	for _, j := range e.ref.JoinNames {
+		join := e.ref.Joins[j]
+		joins = append(joins, join.Name())
 	}
 	return joins
 }
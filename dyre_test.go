@@ -1 +1,413 @@
 package dyre
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Team-Solutions-Dental/dyre/endpoint"
+	"github.com/Team-Solutions-Dental/dyre/transpiler"
+)
+
+func testNewDyre(t *testing.T, cacheSize int) *Dyre {
+	input := `
+[
+  {
+    "name": "Customers",
+    "tableName": "Customers",
+    "joins": [{ "endpoint": "Invoices", "on": "CustomerID" }],
+    "fields": ["CustomerID", "Name"]
+  },
+  {
+    "name": "Invoices",
+    "tableName": "Invoices",
+    "fields": ["CustomerID", {"name": "Balance", "type": "float"}]
+  }
+]`
+	service, err := endpoint.ParseJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	d := &Dyre{service: service}
+	d.SetPlanCacheSize(cacheSize)
+	return d
+}
+
+func TestPlanCache(t *testing.T) {
+	d := testNewDyre(t, 2)
+
+	customers := PlanRequest{Endpoint: "Customers", Query: "CustomerID: Name:", OrderBy: "Name: ASC;"}
+	joined := PlanRequest{Endpoint: "Customers", Query: "CustomerID:",
+		Joins: []PlanJoin{{Type: "LEFT", Join: "Invoices", Query: "Balance: > 0;"}}}
+	admin := customers
+	admin.PrincipalClass = "admin"
+
+	first, err := d.Plan(customers)
+	if err != nil {
+		t.Fatalf("Plan error: %v", err)
+	}
+	second, err := d.Plan(customers)
+	if err != nil {
+		t.Fatalf("Plan error: %v", err)
+	}
+	if first != second {
+		t.Errorf("expected the cached plan for the same request")
+	}
+	if first.SQL() != "SELECT Customers.[CustomerID], Customers.[Name] FROM Customers ORDER BY Name ASC" {
+		t.Errorf("unexpected SQL %s", first.SQL())
+	}
+
+	if _, err := d.Plan(joined); err != nil {
+		t.Fatalf("Plan error: %v", err)
+	}
+	if _, err := d.Plan(admin); err != nil {
+		t.Fatalf("Plan error: %v", err)
+	}
+
+	// admin evicted customers as the least recently used plan
+	evicted, err := d.Plan(customers)
+	if err != nil {
+		t.Fatalf("Plan error: %v", err)
+	}
+	if evicted == first {
+		t.Errorf("expected the plan to be evicted")
+	}
+
+	if _, err := d.Plan(PlanRequest{Endpoint: "Customers", Query: "Missing:"}); err == nil {
+		t.Errorf("expected error for missing field")
+	}
+
+	expected := PlanCacheStats{Hits: 1, Misses: 5, Size: 2, Capacity: 2}
+	if stats := d.PlanCacheStats(); stats != expected {
+		t.Errorf("unexpected stats %+v. want=%+v", stats, expected)
+	}
+}
+
+func TestPlanCacheChecker(t *testing.T) {
+	d := testNewDyre(t, 4)
+	d.service.Endpoints["Customers"].Security = &endpoint.SecurityPolicy{Permissions: []string{"customers:read"}, OnDeny: "error"}
+	checker := endpoint.AdaptChecker(endpoint.NewStaticChecker(map[string]struct{}{}))
+
+	req := PlanRequest{Endpoint: "Customers", Query: "Name:", PrincipalClass: "staff"}
+	if _, err := d.Plan(req); err != nil {
+		t.Fatalf("Plan error: %v", err)
+	}
+
+	// A checked request of the same class is not served the unchecked plan
+	req.Checker = checker
+	if _, err := d.Plan(req); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("expected the checked plan to be denied. got=%v", err)
+	}
+
+	req.PrincipalClass = ""
+	if _, err := d.Plan(req); err == nil || !strings.Contains(err.Error(), "PrincipalClass required") {
+		t.Errorf("expected a principal class to be required. got=%v", err)
+	}
+}
+
+// Checker which also provides the attributes of row filters
+type principalChecker struct {
+	endpoint.ContextChecker
+	endpoint.PrincipalMap
+}
+
+func TestPlanCachePrincipalAttributes(t *testing.T) {
+	d := testNewDyre(t, 4)
+	d.service.Endpoints["Customers"].RowFilter = "@('Name') == $principal.name"
+	checker := endpoint.AdaptChecker(endpoint.NewStaticChecker(map[string]struct{}{}))
+
+	plan := func(name any) *transpiler.Plan {
+		t.Helper()
+		p, err := d.Plan(PlanRequest{Endpoint: "Customers", Query: "CustomerID:", PrincipalClass: "staff",
+			Checker: principalChecker{checker, endpoint.PrincipalMap{"name": name}}})
+		if err != nil {
+			t.Fatalf("Plan error: %v", err)
+		}
+		return p
+	}
+
+	ann := plan("ann")
+	if plan("ann") != ann {
+		t.Errorf("expected the cached plan for the same attribute values")
+	}
+	bob := plan("bob")
+	if bob == ann || !strings.Contains(bob.SQL(), "'bob'") {
+		t.Errorf("expected a plan per attribute value. got=%s", bob.SQL())
+	}
+	if plan([]string{"ann"}) == ann {
+		t.Errorf("expected values of another type to compile a new plan")
+	}
+	if attributes := ann.PrincipalAttributes(); attributes["name"] != "ann" {
+		t.Errorf("unexpected attributes %v", attributes)
+	}
+
+	// Principals without the attribute are not served a cached plan
+	_, err := d.Plan(PlanRequest{Endpoint: "Customers", Query: "CustomerID:", PrincipalClass: "staff", Checker: checker})
+	if err == nil || !strings.Contains(err.Error(), "No principal provided") {
+		t.Errorf("expected the row filter to require a principal. got=%v", err)
+	}
+}
+
+func TestPlanCacheDisabled(t *testing.T) {
+	d := testNewDyre(t, 0)
+
+	req := PlanRequest{Endpoint: "Customers", Query: "CustomerID:"}
+	first, _ := d.Plan(req)
+	second, _ := d.Plan(req)
+	if first == nil || first == second {
+		t.Errorf("expected a new plan without a cache")
+	}
+	if stats := d.PlanCacheStats(); stats != (PlanCacheStats{}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestSecurityModes(t *testing.T) {
+	service, err := endpoint.ParseJSON([]byte(`
+[
+  {
+    "name": "Customers",
+    "tableName": "Customers",
+    "joins": [{ "endpoint": "Invoices", "on": "CustomerID" }],
+    "fields": ["CustomerID"]
+  },
+  {
+    "name": "Invoices",
+    "tableName": "Invoices",
+    "security": "invoices:read",
+    "fields": ["CustomerID"]
+  }
+]`))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	checker := endpoint.AdaptChecker(endpoint.NewStaticChecker(map[string]struct{}{"invoices:read": {}}))
+
+	tests := []struct {
+		mode     SecurityMode
+		endpoint string
+		checker  endpoint.ContextChecker
+		join     bool
+		expected string
+	}{
+		{SecurityOptional, "Invoices", nil, false, ""},
+		{SecurityStrict, "Customers", nil, false, ""},
+		{SecurityStrict, "Invoices", nil, false, "security checker required for endpoint Invoices"},
+		{SecurityStrict, "Customers", nil, true, "security checker required for endpoint Invoices"},
+		{SecurityStrict, "Customers", checker, true, ""},
+		{SecurityRequired, "Customers", nil, false, "security checker required for endpoint Customers"},
+		{SecurityRequired, "Invoices", checker, false, ""},
+	}
+
+	for i, tt := range tests {
+		d := &Dyre{service: service, mode: tt.mode}
+		ir, err := d.RequestAs(context.Background(), tt.checker, tt.endpoint, "CustomerID:")
+		if err == nil && tt.join {
+			join, joinErr := ir.AUTOJOIN("LEFT", "Invoices")
+			if joinErr != nil {
+				t.Fatalf("test %d: join error: %v", i, joinErr)
+			}
+			_, err = join.Query("CustomerID:")
+		}
+
+		if tt.expected == "" && err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+		}
+		if tt.expected != "" && (err == nil || !strings.Contains(err.Error(), tt.expected)) {
+			t.Errorf("test %d: expected error containing %q. got=%v", i, tt.expected, err)
+		}
+	}
+
+	d := &Dyre{service: service, mode: SecurityStrict}
+	ep, err := d.Endpoint("Invoices")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if _, err := ep.Request("CustomerID:"); err == nil {
+		t.Errorf("expected strict mode to refuse endpoint request without checker")
+	}
+}
+
+func TestSetTenantColumnsDropsPlans(t *testing.T) {
+	d := testNewDyre(t, 4)
+	request := PlanRequest{Endpoint: "Customers", Query: "Name:", Tenant: "c1"}
+
+	shared, err := d.Plan(request)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if strings.Contains(shared.SQL(), "'c1'") {
+		t.Errorf("expected no tenant predicate before tenant columns are set. got=%s", shared.SQL())
+	}
+
+	if err := d.SetTenantColumns(map[string]string{"Customers": "CustomerID"}); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	tenant, err := d.Plan(request)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if tenant == shared || tenant.SQL() != "SELECT Customers.[Name] FROM Customers WHERE (Customers.[CustomerID] = 'c1')" {
+		t.Errorf("expected a new plan with the tenant predicate. got=%s", tenant.SQL())
+	}
+}
+
+func TestRequestWithTenant(t *testing.T) {
+	d := testNewDyre(t, 4)
+	if err := d.SetTenantColumns(map[string]string{"Customers": "CustomerID"}); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	missing, err := d.Request("Customers", "Name:")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if _, err := missing.EvaluateQuery(); err == nil || !strings.Contains(err.Error(), "requires a tenant") {
+		t.Errorf("expected tenant error. got=%v", err)
+	}
+
+	ir, err := d.Request("Customers", "Name:", WithTenant("c1"))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	sql, err := ir.EvaluateQuery()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if sql != "SELECT Customers.[Name] FROM Customers WHERE (Customers.[CustomerID] = 'c1')" {
+		t.Errorf("unexpected SQL %s", sql)
+	}
+
+	first, err := d.Plan(PlanRequest{Endpoint: "Customers", Query: "Name:", Tenant: "c1"})
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	second, err := d.Plan(PlanRequest{Endpoint: "Customers", Query: "Name:", Tenant: "c2"})
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if first == second || !strings.Contains(second.SQL(), "'c2'") {
+		t.Errorf("expected a plan per tenant. got=%s", second.SQL())
+	}
+}
+
+func TestVisibleTo(t *testing.T) {
+	d := testNewDyre(t, 0)
+	d.service.Endpoints["Invoices"].Security = &endpoint.SecurityPolicy{Permissions: []string{"invoices:read"}, OnDeny: "error"}
+
+	vs, err := d.VisibleTo(context.Background(), endpoint.AdaptChecker(endpoint.NewStaticChecker(map[string]struct{}{})))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(vs.EndpointNames) != 1 || len(vs.Endpoints["Customers"].JoinNames) != 0 {
+		t.Errorf("expected only Customers without joins. got=%v", vs.EndpointNames)
+	}
+
+	d.mode = SecurityRequired
+	if _, err := d.VisibleTo(context.Background(), nil); err == nil {
+		t.Errorf("expected an error without a checker in required mode")
+	}
+}
+
+func TestAuditSink(t *testing.T) {
+	d := testNewDyre(t, 0)
+
+	ir, err := d.Request("Customers", "Name: CustomerID: == 'c1';", WithSubject("u1"))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if _, err := ir.EvaluateQuery(); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	// Without a sink nothing is written
+	if err := d.Audit(context.Background(), ir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var out bytes.Buffer
+	d.SetAuditSink(NewJSONLinesSink(&out))
+	for range 2 {
+		if err := d.Audit(context.Background(), ir); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines. got=%q", out.String())
+	}
+	var record transpiler.AuditRecord
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("line is not JSON: %v", err)
+	}
+	if record.Subject != "u1" || record.Endpoint != "Customers" || len(record.Selected) != 2 {
+		t.Errorf("wrong record. got=%s", lines[0])
+	}
+
+	// Cached plans are audited for the caller they serve
+	out.Reset()
+	plan, err := d.Plan(PlanRequest{Endpoint: "Customers", Query: "Name:"})
+	if err != nil {
+		t.Fatalf("Plan error: %v", err)
+	}
+	if err := d.AuditPlan(context.Background(), plan, "u2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil || record.Subject != "u2" {
+		t.Errorf("wrong plan record. got=%s, %v", out.String(), err)
+	}
+}
+
+func TestEndpointClassifications(t *testing.T) {
+	d := testNewDyre(t, 0)
+	customers := d.service.Endpoints["Customers"]
+	name := customers.Fields["Name"]
+	name.Classification = "pii"
+	customers.Fields["Name"] = name
+
+	ep, err := d.Endpoint("Customers")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if ep.Classification("Name") != "pii" || ep.Classification("CustomerID") != "" {
+		t.Errorf("wrong classifications. got Name=%q, CustomerID=%q", ep.Classification("Name"), ep.Classification("CustomerID"))
+	}
+	if fields := ep.ClassifiedFields("pii"); len(fields) != 1 || fields[0] != "Name" {
+		t.Errorf("expected only Name to be pii. got=%v", fields)
+	}
+}
+
+func TestRequestExport(t *testing.T) {
+	d := testNewDyre(t, 4)
+	d.service.Endpoints["Customers"].Operations = &endpoint.Operations{
+		Export: &endpoint.SecurityPolicy{Permissions: []string{"export:customers"}, OnDeny: "error"},
+	}
+	checker := endpoint.AdaptChecker(endpoint.NewStaticChecker(map[string]struct{}{}))
+
+	ir, err := d.RequestAs(context.Background(), checker, "Customers", "Name:")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if _, err := ir.EvaluateQuery(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	ir, err = d.RequestAs(context.Background(), checker, "Customers", "Name:", WithExport(true))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if _, err := ir.EvaluateQuery(); err == nil || !strings.Contains(err.Error(), "permission denied for export of Customers") {
+		t.Errorf("expected export to be denied. got=%v", err)
+	}
+
+	if _, err := d.Plan(PlanRequest{Endpoint: "Customers", Query: "Name:", PrincipalClass: "staff", Checker: checker}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := d.Plan(PlanRequest{Endpoint: "Customers", Query: "Name:", PrincipalClass: "staff", Checker: checker, Export: true}); err == nil {
+		t.Errorf("expected the export plan to be denied")
+	}
+}
@@ -2,6 +2,7 @@ package endpoint
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -21,7 +22,13 @@ type Service struct {
 	Node
 	Endpoints     map[string]*Endpoint
 	EndpointNames []string
-	Settings      Settings
+	// Named policies referenced by endpoints and fields with {"policy": name}
+	Policies    map[string]*SecurityPolicy
+	PolicyNames []string
+	// Policies of fields by classification. Ex. "phi" fields require phi:read
+	Classifications     map[string]*SecurityPolicy
+	ClassificationNames []string
+	Settings            Settings
 }
 
 func (s *Service) JSON() string {
@@ -30,9 +37,41 @@ func (s *Service) JSON() string {
 	for _, ep := range s.EndpointNames {
 		enpoints = append(enpoints, s.Endpoints[ep].JSON())
 	}
-	out.WriteString("[")
+	if len(s.PolicyNames) == 0 && len(s.ClassificationNames) == 0 && s.Settings.DefaultPolicy == nil && !s.Settings.DenyByDefault {
+		out.WriteString("[")
+		out.WriteString(strings.Join(enpoints, ", "))
+		out.WriteString("]")
+		return out.String()
+	}
+
+	policies := []string{}
+	for _, name := range s.PolicyNames {
+		policies = append(policies, fmt.Sprintf("%s : %s", jsonString(name), s.Policies[name].definitionJSON()))
+	}
+	out.WriteString("{")
+	if len(policies) > 0 {
+		out.WriteString("\"policies\" : {")
+		out.WriteString(strings.Join(policies, ", "))
+		out.WriteString("}, ")
+	}
+	if len(s.ClassificationNames) > 0 {
+		classifications := []string{}
+		for _, name := range s.ClassificationNames {
+			classifications = append(classifications, fmt.Sprintf("%s : %s", jsonString(name), s.Classifications[name].JSON()))
+		}
+		out.WriteString("\"classifications\" : {")
+		out.WriteString(strings.Join(classifications, ", "))
+		out.WriteString("}, ")
+	}
+	if s.Settings.DefaultPolicy != nil {
+		out.WriteString(fmt.Sprintf("\"defaultPolicy\" : %s, ", s.Settings.DefaultPolicy.JSON()))
+	}
+	if s.Settings.DenyByDefault {
+		out.WriteString("\"denyByDefault\" : true, ")
+	}
+	out.WriteString("\"endpoints\" : [")
 	out.WriteString(strings.Join(enpoints, ", "))
-	out.WriteString("]")
+	out.WriteString("]}")
 
 	return out.String()
 }
@@ -76,14 +115,15 @@ func EndpointPaths(endpoint *Endpoint, currpath []string, depth int, depthStop i
 	}
 
 	for _, j := range endpoint.JoinNames {
-		if utils.Array_Contains(path, j) {
+		join := endpoint.Joins[j]
+
+		if utils.Array_Contains(path, join.EndpointName()) {
 			continue
 		}
 
-		join := endpoint.Joins[j]
-
+		// Child paths start with the endpoint name. Reference it by the join name instead
 		for _, p := range EndpointPaths(join.ChildEndpoint(), path, (depth + 1), depthStop) {
-			new_path := append([]string{endpoint.Name}, p...)
+			new_path := append([]string{endpoint.Name, j}, p[1:]...)
 			subPaths = append(subPaths, new_path)
 		}
 	}
@@ -102,6 +142,27 @@ type Endpoint struct {
 	JoinNames  []string
 	Fields     map[string]Field
 	FieldNames []string
+	Hierarchy  *Hierarchy
+	// Dyre expression ANDed into the where statement of every query of the endpoint, including joins.
+	// Ex. @('ClinicID') IN $principal.clinics
+	RowFilter string
+	// Policies of grouping, joining, limits and exports
+	Operations *Operations
+}
+
+// Default and highest recursion limit of hierarchy queries.
+// SQL Server stops recursive CTEs after 100 levels unless the statement sets OPTION (MAXRECURSION)
+const DefaultMaxDepth = 100
+
+// Self referencing parent child relationship of an endpoint's rows
+type Hierarchy struct {
+	ID       string
+	Parent   string
+	MaxDepth int
+}
+
+func (h *Hierarchy) JSON() string {
+	return fmt.Sprintf("{\"id\": \"%s\", \"parent\": \"%s\", \"maxDepth\": %d}", h.ID, h.Parent, h.MaxDepth)
 }
 
 func (e *Endpoint) JSON() string {
@@ -109,7 +170,8 @@ func (e *Endpoint) JSON() string {
 	out.WriteString("{ ")
 
 	joins := []string{}
-	for _, join := range e.Joins {
+	for _, j := range e.JoinNames {
+		join := e.Joins[j]
 		joins = append(joins, join.JSON())
 	}
 
@@ -123,29 +185,16 @@ func (e *Endpoint) JSON() string {
 	out.WriteString(fmt.Sprintf("\"tableName\" : \"%s\", ", e.TableName))
 	out.WriteString(fmt.Sprintf("\"schemaName\" : \"%s\", ", e.SchemaName))
 	if e.Security != nil && !e.Security.IsEmpty() {
-		out.WriteString("\"security\" : ")
-		if e.Security.OnDeny == "error" {
-			// Array format for error behavior (backward compatible)
-			out.WriteString("[")
-			quoted := make([]string, 0, len(e.Security.Permissions))
-			for _, s := range e.Security.Permissions {
-				quoted = append(quoted, fmt.Sprintf("\"%s\"", s))
-			}
-			out.WriteString(strings.Join(quoted, ", "))
-			out.WriteString("], ")
-		} else {
-			// Object form for omit behavior
-			out.WriteString("{")
-			out.WriteString("\"permissions\": [")
-			quoted := make([]string, 0, len(e.Security.Permissions))
-			for _, s := range e.Security.Permissions {
-				quoted = append(quoted, fmt.Sprintf("\"%s\"", s))
-			}
-			out.WriteString(strings.Join(quoted, ", "))
-			out.WriteString("], ")
-			out.WriteString(fmt.Sprintf("\"onDeny\": \"%s\"", e.Security.OnDeny))
-			out.WriteString("}, ")
-		}
+		out.WriteString(fmt.Sprintf("\"security\" : %s, ", e.Security.JSON()))
+	}
+	if e.Hierarchy != nil {
+		out.WriteString(fmt.Sprintf("\"hierarchy\" : %s, ", e.Hierarchy.JSON()))
+	}
+	if e.RowFilter != "" {
+		out.WriteString(fmt.Sprintf("\"rowFilter\" : %s, ", jsonString(e.RowFilter)))
+	}
+	if !e.Operations.IsEmpty() {
+		out.WriteString(fmt.Sprintf("\"operations\" : %s, ", e.Operations.JSON()))
 	}
 	out.WriteString("\"joins\" : [")
 	out.WriteString(strings.Join(joins, ", "))
@@ -167,6 +216,11 @@ func (e *Endpoint) TS() string {
 		out.WriteString("\n  ")
 		out.WriteString(field.TS())
 	}
+	for _, j := range e.JoinNames {
+		join := e.Joins[j]
+		out.WriteString("\n  ")
+		out.WriteString(join.TS())
+	}
 	out.WriteString("\n}")
 
 	return out.String()
@@ -179,6 +233,8 @@ type Field struct {
 	FieldType objectType.Type
 	Nullable  bool
 	Security  *SecurityPolicy
+	// Sensitivity of the values. Ex. "public", "internal", "phi" or "pii"
+	Classification string
 }
 
 func (f *Field) Type() objectType.Type { return f.FieldType }
@@ -190,30 +246,11 @@ func (f *Field) JSON() string {
 	out.WriteString(fmt.Sprintf("\"name\" : \"%s\", ", f.Name))
 	out.WriteString(fmt.Sprintf("\"type\" : \"%s\", ", f.FieldType))
 	out.WriteString(fmt.Sprintf("\"nullable\" : %t", f.Nullable))
+	if f.Classification != "" {
+		out.WriteString(", \"classification\" : " + jsonString(f.Classification))
+	}
 	if f.Security != nil && !f.Security.IsEmpty() {
-		out.WriteString(", \"security\" : ")
-		if f.Security.OnDeny == "error" {
-			// Array format for error behavior (backward compatible)
-			out.WriteString("[")
-			quoted := make([]string, 0, len(f.Security.Permissions))
-			for _, s := range f.Security.Permissions {
-				quoted = append(quoted, fmt.Sprintf("\"%s\"", s))
-			}
-			out.WriteString(strings.Join(quoted, ", "))
-			out.WriteString("]")
-		} else {
-			// Object form for omit behavior
-			out.WriteString("{")
-			out.WriteString("\"permissions\": [")
-			quoted := make([]string, 0, len(f.Security.Permissions))
-			for _, s := range f.Security.Permissions {
-				quoted = append(quoted, fmt.Sprintf("\"%s\"", s))
-			}
-			out.WriteString(strings.Join(quoted, ", "))
-			out.WriteString("], ")
-			out.WriteString(fmt.Sprintf("\"onDeny\": \"%s\"", f.Security.OnDeny))
-			out.WriteString("}")
-		}
+		out.WriteString(", \"security\" : " + f.Security.JSON())
 	}
 
 	out.WriteString("}")
@@ -229,7 +266,7 @@ func (f *Field) TS() string {
 	}
 	out.WriteString(": ")
 
-	out.WriteString(objTypeToTsType(f.FieldType))
+	out.WriteString(TSType(f.FieldType))
 	out.WriteString(";")
 
 	return out.String()
@@ -248,8 +285,48 @@ type Join struct {
 	parentEndpoint    *Endpoint
 	childEndpoint     *Endpoint
 	childEndpointName string
-	Parent_ON         string
-	Child_ON          string
+	// Name the join is referenced by in SQL and column references.
+	// Defaults to the child endpoint name.
+	Alias     string
+	Parent_ON string
+	Child_ON  string
+	// All key pairs of the join. The first pair mirrors Parent_ON and Child_ON.
+	On []JoinOn
+	// Fixed dyre expression applied to the child of the join
+	Filter string
+	// Relationship from parent to child rows. Empty when unknown.
+	Cardinality string
+}
+
+// Join cardinalities, read from parent to child
+const (
+	OneToOne   = "one-to-one"
+	OneToMany  = "one-to-many"
+	ManyToOne  = "many-to-one"
+	ManyToMany = "many-to-many"
+)
+
+var cardinalities = []string{OneToOne, OneToMany, ManyToOne, ManyToMany}
+
+// Check a join cardinality. Empty is allowed as unknown.
+func ValidCardinality(c string) bool {
+	return c == "" || utils.Array_Contains(cardinalities, c)
+}
+
+// Each parent row can match many child rows
+func ToMany(c string) bool {
+	return c == OneToMany || c == ManyToMany
+}
+
+// Each parent row matches at most one child row
+func ToOne(c string) bool {
+	return c == OneToOne || c == ManyToOne
+}
+
+// A single [ParentON, ChildOn] column pair of a join
+type JoinOn struct {
+	Parent string
+	Child  string
 }
 
 func (j *Join) JSON() string {
@@ -259,19 +336,65 @@ func (j *Join) JSON() string {
 	out.WriteString(
 		fmt.Sprintf("\"endpoint\" : \"%s\", ", j.childEndpointName),
 	)
-	out.WriteString(
-		fmt.Sprintf("\"on\": [\"%s\",\"%s\"] ", j.Parent_ON, j.Child_ON),
-	)
+	if j.Alias != "" && j.Alias != j.childEndpointName {
+		out.WriteString(fmt.Sprintf("\"alias\" : \"%s\", ", j.Alias))
+	}
+
+	keys := j.Keys()
+	if len(keys) == 1 {
+		out.WriteString(
+			fmt.Sprintf("\"on\": [\"%s\",\"%s\"] ", keys[0].Parent, keys[0].Child),
+		)
+	} else {
+		pairs := []string{}
+		for _, k := range keys {
+			pairs = append(pairs, fmt.Sprintf("[\"%s\",\"%s\"]", k.Parent, k.Child))
+		}
+		out.WriteString(fmt.Sprintf("\"on\": [%s] ", strings.Join(pairs, ",")))
+	}
+
+	if j.Filter != "" {
+		out.WriteString(fmt.Sprintf(", \"filter\": %s ", jsonString(j.Filter)))
+	}
+
+	if j.Cardinality != "" {
+		out.WriteString(fmt.Sprintf(", \"cardinality\": \"%s\" ", j.Cardinality))
+	}
 
 	out.WriteString("}")
 
 	return out.String()
 }
 
+// Keys returns every column pair the join is made on.
+// Joins built without On fall back to Parent_ON and Child_ON.
+func (j *Join) Keys() []JoinOn {
+	if len(j.On) > 0 {
+		return j.On
+	}
+	return []JoinOn{{Parent: j.Parent_ON, Child: j.Child_ON}}
+}
+
+// Name of the join. The alias when given, otherwise the child endpoint name.
 func (j *Join) Name() string {
+	if j.Alias != "" {
+		return j.Alias
+	}
+	return j.childEndpointName
+}
+
+// Name of the endpoint being joined
+func (j *Join) EndpointName() string {
 	return j.childEndpointName
 }
 
+func (j *Join) TS() string {
+	if ToOne(j.Cardinality) {
+		return fmt.Sprintf("%s?: %s;", j.Name(), j.childEndpointName)
+	}
+	return fmt.Sprintf("%s?: %s[];", j.Name(), j.childEndpointName)
+}
+
 func (j *Join) ParentEndpoint() *Endpoint {
 	return j.parentEndpoint
 }
@@ -280,7 +403,8 @@ func (j *Join) ChildEndpoint() *Endpoint {
 	return j.childEndpoint
 }
 
-func objTypeToTsType(obj objectType.Type) string {
+// TypeScript type of an object type
+func TSType(obj objectType.Type) string {
 	switch obj {
 	case objectType.STRING:
 		return "string"
@@ -303,4 +427,74 @@ func objTypeToTsType(obj objectType.Type) string {
 
 type Settings struct {
 	BracketedColumns bool
+	// Column holding the tenant of each row by endpoint name.
+	// Endpoints not listed are shared by all tenants.
+	TenantColumns map[string]string
+	// Policy of fields when neither the field nor its endpoint has one
+	DefaultPolicy *SecurityPolicy
+	// Fields without a field, endpoint or default policy are denied
+	DenyByDefault bool
+}
+
+// Security policy of a field of the endpoint.
+// Fields without a policy require the policy of their classification in addition to the endpoint policy.
+// Otherwise they inherit the endpoint policy and then the service default policy.
+func (e *Endpoint) FieldPolicy(f *Field) *SecurityPolicy {
+	if !f.Security.IsEmpty() {
+		return f.Security
+	}
+	if e.Service != nil && f.Classification != "" && !e.Service.Classifications[f.Classification].IsEmpty() {
+		return allOfPolicies(e.Security, e.Service.Classifications[f.Classification])
+	}
+	if !e.Security.IsEmpty() {
+		return e.Security
+	}
+	if e.Service != nil && !e.Service.Settings.DefaultPolicy.IsEmpty() {
+		return e.Service.Settings.DefaultPolicy
+	}
+	return nil
+}
+
+// Store all tenants in the same tables. Every query of a listed endpoint is limited to the tenant of the request.
+// Ex. {"Patients": "TenantID", "Appointments": "TenantID"}
+func (s *Service) SetTenantColumns(columns map[string]string) error {
+	var errs []error
+	for name, column := range columns {
+		ep, ok := s.Endpoints[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("Tenant endpoint %s not found", name))
+			continue
+		}
+		if _, ok := ep.Fields[column]; !ok {
+			errs = append(errs, fmt.Errorf("Tenant field %s not found on endpoint %s", column, name))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	// Copied so later changes of the caller's map do not reach the service
+	s.Settings.TenantColumns = make(map[string]string, len(columns))
+	for name, column := range columns {
+		s.Settings.TenantColumns[name] = column
+	}
+	return nil
+}
+
+// Tenant column of the endpoint. False when the endpoint is shared by all tenants
+func (s *Service) TenantColumn(endpointName string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	column, ok := s.Settings.TenantColumns[endpointName]
+	return column, ok
+}
+
+// Quote a string value for JSON output
+func jsonString(s string) string {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "\"\""
+	}
+	return string(b)
 }
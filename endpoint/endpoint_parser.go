@@ -1,19 +1,24 @@
 package endpoint
- 
+
 import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
+	"github.com/Team-Solutions-Dental/dyre/ast"
+	"github.com/Team-Solutions-Dental/dyre/lexer"
 	"github.com/Team-Solutions-Dental/dyre/object/objectType"
+	"github.com/Team-Solutions-Dental/dyre/parser"
 	"github.com/Team-Solutions-Dental/dyre/utils"
 )
 
+// Parse a config of an array of endpoints, or an object of endpoints, named policies and classification policies.
+// Ex. {"policies": {"phi": {"permissions": ["phi:read"], "onDeny": "omit"}}, "classifications": {"phi": {"policy": "phi"}}, "endpoints": [...]}
 func ParseJSON(b []byte) (*Service, error) {
-	// required fields
-	var m []map[string]any
-	err := json.Unmarshal([]byte(b), &m)
+	var root any
+	err := json.Unmarshal([]byte(b), &root)
 	if err != nil {
 		return nil, err
 	}
@@ -25,6 +30,11 @@ func ParseJSON(b []byte) (*Service, error) {
 
 	var errs []error
 
+	m, err := parseRoot(root, &service)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
 	for i, ep := range m {
 		newEndpoint, err := parseEndpoint(ep, &service, i)
 		if err != nil {
@@ -48,7 +58,7 @@ func ParseJSON(b []byte) (*Service, error) {
 				}
 
 				join.childEndpoint = childEndpoint
-				ep.Joins[join.childEndpointName] = join
+				ep.Joins[join.Name()] = join
 
 			}
 		}
@@ -59,6 +69,158 @@ func ParseJSON(b []byte) (*Service, error) {
 	return &service, errors.Join(errs...)
 }
 
+// Endpoints of the config root. Policies are parsed first so endpoints can reference them.
+func parseRoot(root any, s *Service) ([]map[string]any, error) {
+	var items []any
+	var errs []error
+
+	switch v := root.(type) {
+	case []any:
+		items = v
+	case map[string]any:
+		for key := range v {
+			if !utils.Array_Contains([]string{"endpoints", "policies", "classifications", "defaultPolicy", "denyByDefault"}, key) {
+				errs = append(errs, fmt.Errorf("Unexpected key %s in config", key))
+			}
+		}
+		if policies, ok := v["policies"]; ok {
+			errs = append(errs, parsePolicies(policies, s))
+		}
+		if classifications, ok := v["classifications"]; ok {
+			errs = append(errs, parseClassifications(classifications, s))
+		}
+		if policy, ok := v["defaultPolicy"]; ok {
+			var err error
+			s.Settings.DefaultPolicy, err = s.parseSecurity(policy)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("Config defaultPolicy: %w", err))
+			} else if s.Settings.DefaultPolicy != nil && s.Settings.DefaultPolicy.OnDeny == "partial" {
+				errs = append(errs, errors.New("Config defaultPolicy: onDeny 'partial' is only allowed on fields"))
+			}
+		}
+		if deny, ok := v["denyByDefault"]; ok {
+			denyBool, ok := deny.(bool)
+			if !ok {
+				errs = append(errs, fmt.Errorf("Config denyByDefault not bool. got=%T", deny))
+			}
+			s.Settings.DenyByDefault = denyBool
+		}
+		endpoints, ok := v["endpoints"].([]any)
+		if !ok {
+			return nil, errors.Join(append(errs, fmt.Errorf("Config endpoints not array. got=%T", v["endpoints"]))...)
+		}
+		items = endpoints
+	default:
+		return nil, fmt.Errorf("Config must be an array of endpoints or an object. got=%T", root)
+	}
+
+	var m []map[string]any
+	for i, item := range items {
+		ep, ok := item.(map[string]any)
+		if !ok {
+			errs = append(errs, fmt.Errorf("Endpoint %d not object. got=%T", i, item))
+			continue
+		}
+		m = append(m, ep)
+	}
+	return m, errors.Join(errs...)
+}
+
+func parsePolicies(a any, s *Service) error {
+	policies, ok := a.(map[string]any)
+	if !ok {
+		return fmt.Errorf("Config policies not object. got=%T", a)
+	}
+
+	var errs []error
+	s.Policies = map[string]*SecurityPolicy{}
+	for name, value := range policies {
+		policy, err := NormalizeSecurityValue(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Policy %s: %w", name, err))
+			continue
+		}
+		if policy == nil {
+			errs = append(errs, fmt.Errorf("Policy %s is null", name))
+			continue
+		}
+		policy.Name = name
+		s.Policies[name] = policy
+		s.PolicyNames = append(s.PolicyNames, name)
+	}
+	// Map order is random, keep the JSON output stable
+	sort.Strings(s.PolicyNames)
+
+	return errors.Join(errs...)
+}
+
+// Policies of classified fields. Values may reference named policies.
+func parseClassifications(a any, s *Service) error {
+	classifications, ok := a.(map[string]any)
+	if !ok {
+		return fmt.Errorf("Config classifications not object. got=%T", a)
+	}
+
+	var errs []error
+	s.Classifications = map[string]*SecurityPolicy{}
+	for name, value := range classifications {
+		if err := validClassification(name); err != nil {
+			errs = append(errs, fmt.Errorf("Classification %s: %w", name, err))
+			continue
+		}
+		policy, err := s.parseSecurity(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Classification %s: %w", name, err))
+			continue
+		}
+		if policy == nil {
+			errs = append(errs, fmt.Errorf("Classification %s is null", name))
+			continue
+		}
+		s.Classifications[name] = policy
+		s.ClassificationNames = append(s.ClassificationNames, name)
+	}
+	sort.Strings(s.ClassificationNames)
+
+	return errors.Join(errs...)
+}
+
+// Classifications are compared exactly, so spaces and case variants are refused
+func validClassification(name string) error {
+	if name == "" {
+		return errors.New("'classification' cannot be empty")
+	}
+	if name != strings.ToLower(strings.TrimSpace(name)) {
+		return fmt.Errorf("'classification' must be lower case without spaces. got=%q", name)
+	}
+	return nil
+}
+
+// Security value of an endpoint or field. {"policy": "name"} references a named policy of the service.
+func (s *Service) parseSecurity(value any) (*SecurityPolicy, error) {
+	m, ok := value.(map[string]any)
+	if !ok {
+		return NormalizeSecurityValue(value)
+	}
+	name, ok := m["policy"]
+	if !ok {
+		return NormalizeSecurityValue(value)
+	}
+
+	if len(m) != 1 {
+		return nil, errors.New("policy reference may not have other keys")
+	}
+	str, ok := name.(string)
+	if !ok {
+		return nil, fmt.Errorf("policy not string. got=%T", name)
+	}
+	policy, ok := s.Policies[str]
+	if !ok {
+		return nil, fmt.Errorf("unknown policy %s", str)
+	}
+	return policy, nil
+}
+
 func parseEndpoint(m map[string]any, s *Service, index int) (*Endpoint, error) {
 	var errs []error
 	var err error
@@ -96,10 +258,20 @@ func parseEndpoint(m map[string]any, s *Service, index int) (*Endpoint, error) {
 		}
 	}
 
+	if operations, ok := m["operations"]; ok {
+		request.Operations, err = s.parseOperations(operations, &request)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Operations: %w", err))
+		}
+	}
+
 	if security, ok := m["security"]; ok {
-		request.Security, err = NormalizeSecurityValue(security)
+		request.Security, err = s.parseSecurity(security)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("Security: %w", err))
+		} else if request.Security != nil && request.Security.OnDeny == "partial" {
+			// Patterns are written for the values of one field
+			errs = append(errs, errors.New("Security: onDeny 'partial' is only allowed on fields"))
 		}
 	}
 
@@ -107,7 +279,24 @@ func parseEndpoint(m map[string]any, s *Service, index int) (*Endpoint, error) {
 		return nil, errors.New(fmt.Sprintf("No field <fields> on request  %s\n", request.Name))
 	}
 
-	expected_keys := []string{"name", "fields", "tableName", "schemaName", "joins", "security"}
+	if hierarchy, ok := m["hierarchy"]; ok {
+		request.Hierarchy, err = parseHierarchy(hierarchy, &request)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Hierarchy: %w", err))
+		}
+	}
+
+	if _, ok := m["rowFilter"]; ok {
+		request.RowFilter, err = parseString(m, "rowFilter")
+		if err == nil {
+			err = parseFilter("rowFilter", request.RowFilter)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	expected_keys := []string{"name", "fields", "tableName", "schemaName", "joins", "security", "hierarchy", "rowFilter", "operations"}
 	for i := range m {
 		if !utils.Array_Contains(expected_keys, i) {
 			errs = append(errs, fmt.Errorf("Unexpected key %s", i))
@@ -176,11 +365,19 @@ func parseField(f any, e *Endpoint) (Field, error) {
 		errs = append(errs, err)
 
 		if security, ok := f["security"]; ok {
-			newField.Security, err = NormalizeSecurityValue(security)
+			newField.Security, err = e.Service.parseSecurity(security)
 			errs = append(errs, err)
 		}
 
-		expected_keys := []string{"name", "type", "nullable", "security"}
+		if _, ok := f["classification"]; ok {
+			newField.Classification, err = parseString(f, "classification")
+			if err == nil {
+				err = validClassification(newField.Classification)
+			}
+			errs = append(errs, err)
+		}
+
+		expected_keys := []string{"name", "type", "nullable", "security", "classification"}
 		for i := range f {
 			if !utils.Array_Contains(expected_keys, i) {
 				errs = append(errs,
@@ -273,14 +470,14 @@ func parseEndpointJoins(a []any, e *Endpoint) (map[string]Join, error) {
 			continue
 		}
 
-		_, check := joins[newJoin.childEndpointName]
+		_, check := joins[newJoin.Name()]
 		if check {
-			errs = append(errs, fmt.Errorf("Duplicate join %s", newJoin.childEndpointName))
+			errs = append(errs, fmt.Errorf("Duplicate join %s", newJoin.Name()))
 			continue
 		}
 
-		e.JoinNames = append(e.JoinNames, newJoin.childEndpointName)
-		joins[newJoin.childEndpointName] = newJoin
+		e.JoinNames = append(e.JoinNames, newJoin.Name())
+		joins[newJoin.Name()] = newJoin
 	}
 
 	return joins, errors.Join(errs...)
@@ -301,12 +498,39 @@ func parseJoin(a any, e *Endpoint) (Join, error) {
 	}
 
 	var errs []error
-	ons, err := parseJoinOn(m)
+	newJoin.Alias = newJoin.childEndpointName
+	if _, ok := m["alias"]; ok {
+		newJoin.Alias, err = parseString(m, "alias")
+		errs = append(errs, err)
+		if err == nil && strings.TrimSpace(newJoin.Alias) == "" {
+			errs = append(errs, errors.New("'alias' cannot be empty"))
+		}
+	}
+
+	newJoin.On, err = parseJoinOn(m)
 	errs = append(errs, err)
-	newJoin.Parent_ON = ons[0]
-	newJoin.Child_ON = ons[1]
+	if len(newJoin.On) > 0 {
+		newJoin.Parent_ON = newJoin.On[0].Parent
+		newJoin.Child_ON = newJoin.On[0].Child
+	}
+
+	if _, ok := m["filter"]; ok {
+		newJoin.Filter, err = parseString(m, "filter")
+		errs = append(errs, err)
+		if err == nil {
+			errs = append(errs, parseFilter("filter", newJoin.Filter))
+		}
+	}
+
+	if _, ok := m["cardinality"]; ok {
+		newJoin.Cardinality, err = parseString(m, "cardinality")
+		errs = append(errs, err)
+		if err == nil && !ValidCardinality(newJoin.Cardinality) {
+			errs = append(errs, fmt.Errorf("Invalid 'cardinality' %s, expected one of %s", newJoin.Cardinality, strings.Join(cardinalities, ", ")))
+		}
+	}
 
-	expected_keys := []string{"endpoint", "on"}
+	expected_keys := []string{"endpoint", "alias", "on", "filter", "cardinality"}
 	for i := range m {
 		if !utils.Array_Contains(expected_keys, i) {
 			errs = append(errs, fmt.Errorf("Unexpected key %s", i))
@@ -315,40 +539,140 @@ func parseJoin(a any, e *Endpoint) (Join, error) {
 
 	err = errors.Join(errs...)
 	if err != nil {
-		err = fmt.Errorf("Join %s, %w", newJoin.childEndpointName, err)
+		err = fmt.Errorf("Join %s, %w", newJoin.Name(), err)
 	}
 
 	return newJoin, err
 }
 
-func parseJoinOn(m map[string]any) ([2]string, error) {
-	var output [2]string
+// Accepts
+// "Key"
+// ["ParentKey", "ChildKey"]
+// [["ParentKey", "ChildKey"], "Key", ...]
+func parseJoinOn(m map[string]any) ([]JoinOn, error) {
 	o, ok := m["on"]
 	if !ok {
-		return output, errors.New("Missing 'on'")
+		return nil, errors.New("Missing 'on'")
 	}
 
 	switch o := o.(type) {
 	case string:
-		output[0] = o
-		output[1] = o
+		return []JoinOn{{Parent: o, Child: o}}, nil
+	case []any:
+		if isJoinOnList(o) {
+			var output []JoinOn
+			for i, pair := range o {
+				on, err := parseJoinOnPair(pair)
+				if err != nil {
+					return nil, fmt.Errorf("On array[%d], %w", i, err)
+				}
+				output = append(output, on)
+			}
+			return output, nil
+		}
+		on, err := parseJoinOnPair(o)
+		if err != nil {
+			return nil, err
+		}
+		return []JoinOn{on}, nil
+	default:
+		return nil, fmt.Errorf("Invalid 'on' JSON type %T", o)
+	}
+}
+
+// An on array containing any nested array is a list of key pairs
+func isJoinOnList(a []any) bool {
+	for _, v := range a {
+		if _, ok := v.([]any); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func parseJoinOnPair(a any) (JoinOn, error) {
+	var output JoinOn
+	switch a := a.(type) {
+	case string:
+		output.Parent = a
+		output.Child = a
 	case []any:
-		if len(o) != 2 {
-			return output, fmt.Errorf("On array length is not two. [ParentON, ChildOn]. got %d", len(o))
+		if len(a) != 2 {
+			return output, fmt.Errorf("On array length is not two. [ParentON, ChildOn]. got %d", len(a))
 		}
 		var ok bool
-		if output[0], ok = o[0].(string); !ok {
-			return output, fmt.Errorf("On array[%d] not string. got %T", 0, o[0])
+		if output.Parent, ok = a[0].(string); !ok {
+			return output, fmt.Errorf("On array[%d] not string. got %T", 0, a[0])
 		}
-		if output[1], ok = o[1].(string); !ok {
-			return output, fmt.Errorf("On array[%d] not string. got %T", 1, o[1])
+		if output.Child, ok = a[1].(string); !ok {
+			return output, fmt.Errorf("On array[%d] not string. got %T", 1, a[1])
 		}
 	default:
-		return output, fmt.Errorf("Invalid 'on' JSON type %T", o)
+		return output, fmt.Errorf("Invalid 'on' JSON type %T", a)
 	}
 	return output, nil
 }
 
+// Join and row filters are plain dyre expressions. Columns cannot be selected by a filter.
+func parseFilter(key string, filter string) error {
+	p := parser.New(lexer.New(filter))
+	q := p.ParseQuery()
+	if errs := p.Errors(); len(errs) > 0 {
+		return fmt.Errorf("'%s' parser errors: %s", key, strings.Join(errs, ", "))
+	}
+
+	for _, stmnt := range q.Statements {
+		if _, ok := stmnt.(*ast.ExpressionStatement); !ok {
+			return fmt.Errorf("'%s' may only contain expressions. got=%s", key, stmnt.String())
+		}
+	}
+
+	return nil
+}
+
+func parseHierarchy(a any, e *Endpoint) (*Hierarchy, error) {
+	m, ok := a.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("Invalid 'hierarchy' JSON type %T", a)
+	}
+
+	hierarchy := &Hierarchy{MaxDepth: DefaultMaxDepth}
+
+	var errs []error
+	var err error
+	hierarchy.ID, err = parseString(m, "id")
+	errs = append(errs, err)
+	if _, ok := e.Fields[hierarchy.ID]; err == nil && !ok {
+		errs = append(errs, fmt.Errorf("'id' field %s not found", hierarchy.ID))
+	}
+
+	hierarchy.Parent, err = parseString(m, "parent")
+	errs = append(errs, err)
+	if _, ok := e.Fields[hierarchy.Parent]; err == nil && !ok {
+		errs = append(errs, fmt.Errorf("'parent' field %s not found", hierarchy.Parent))
+	}
+
+	if maxDepth, ok := m["maxDepth"]; ok {
+		depth, ok := maxDepth.(float64)
+		if !ok || depth != float64(int(depth)) || depth < 1 {
+			errs = append(errs, fmt.Errorf("'maxDepth' not a positive integer. got=%v", maxDepth))
+		} else if depth > DefaultMaxDepth {
+			errs = append(errs, fmt.Errorf("'maxDepth' above the recursion limit of %d. got=%v", DefaultMaxDepth, maxDepth))
+		} else {
+			hierarchy.MaxDepth = int(depth)
+		}
+	}
+
+	expected_keys := []string{"id", "parent", "maxDepth"}
+	for i := range m {
+		if !utils.Array_Contains(expected_keys, i) {
+			errs = append(errs, fmt.Errorf("Unexpected key %s", i))
+		}
+	}
+
+	return hierarchy, errors.Join(errs...)
+}
+
 func parseString(m map[string]any, index string) (string, error) {
 	n, ok := m[index]
 	if !ok {
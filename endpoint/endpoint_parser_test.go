@@ -334,3 +334,378 @@ func testingJSON() string {
 ]
 `
 }
+
+func TestParseJoinCompositeOn(t *testing.T) {
+	input := `
+[
+  {
+    "name": "Patients",
+    "tableName": "Patients",
+    "joins": [
+      {
+        "endpoint": "Appointments",
+        "on": [["ClinicID", "ClinicID"], "PatientID"],
+        "filter": "@('Active') == TRUE"
+      }
+    ],
+    "fields": ["ClinicID", "PatientID"]
+  },
+  {
+    "name": "Appointments",
+    "tableName": "Appointments",
+    "fields": ["ClinicID", "PatientID", {"name": "Active", "type": "bool"}]
+  }
+]`
+
+	service, err := ParseJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	join := service.Endpoints["Patients"].Joins["Appointments"]
+	keys := join.Keys()
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 join keys. got=%d", len(keys))
+	}
+	if keys[0] != (JoinOn{Parent: "ClinicID", Child: "ClinicID"}) || keys[1] != (JoinOn{Parent: "PatientID", Child: "PatientID"}) {
+		t.Errorf("unexpected join keys %v", keys)
+	}
+	if join.Parent_ON != "ClinicID" || join.Child_ON != "ClinicID" {
+		t.Errorf("expected first key on Parent_ON/Child_ON. got=%s %s", join.Parent_ON, join.Child_ON)
+	}
+	if join.Filter != "@('Active') == TRUE" {
+		t.Errorf("unexpected filter %s", join.Filter)
+	}
+
+	expected := `{"endpoint":"Appointments","on":[["ClinicID","ClinicID"],["PatientID","PatientID"]],"filter":"@('Active')==TRUE"}`
+	if got := strings.Replace(join.JSON(), " ", "", -1); got != expected {
+		t.Errorf("join JSON did not match\n%s\n%s", got, expected)
+	}
+}
+
+func TestParseJoinInvalid(t *testing.T) {
+	tests := []struct {
+		join     string
+		expected string
+	}{
+		{`{"endpoint": "B", "on": ["A", "B", "C"]}`, "On array length is not two"},
+		{`{"endpoint": "B", "on": [["A"], "B"]}`, "On array[0]"},
+		{`{"endpoint": "B", "on": "A", "filter": "A: == 1"}`, "may only contain expressions"},
+		{`{"endpoint": "B", "on": "A", "filter": 1}`, "'filter' not string"},
+		{`{"endpoint": "B", "on": "A", "cardinality": "one-to-few"}`, "Invalid 'cardinality' one-to-few"},
+	}
+
+	for _, tt := range tests {
+		input := `[{"name": "A", "tableName": "A", "fields": ["A"], "joins": [` + tt.join + `]},
+			{"name": "B", "tableName": "B", "fields": ["A"]}]`
+		_, err := ParseJSON([]byte(input))
+		if err == nil {
+			t.Errorf("expected error for %s", tt.join)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected error containing %q. got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestParseHierarchy(t *testing.T) {
+	input := `[{"name": "Orgs", "tableName": "Orgs", "fields": ["OrgID", "ParentID"],
+		"hierarchy": {"id": "OrgID", "parent": "ParentID"}}]`
+	service, err := ParseJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	h := service.Endpoints["Orgs"].Hierarchy
+	if h == nil || h.ID != "OrgID" || h.Parent != "ParentID" || h.MaxDepth != DefaultMaxDepth {
+		t.Fatalf("unexpected hierarchy %v", h)
+	}
+	if !strings.Contains(service.Endpoints["Orgs"].JSON(), `"hierarchy" : {"id": "OrgID", "parent": "ParentID", "maxDepth": 100}`) {
+		t.Errorf("expected hierarchy in JSON. got=%s", service.Endpoints["Orgs"].JSON())
+	}
+
+	tests := []struct {
+		hierarchy string
+		expected  string
+	}{
+		{`{"id": "Missing", "parent": "ParentID"}`, "'id' field Missing not found"},
+		{`{"id": "OrgID"}`, "Missing parent"},
+		{`{"id": "OrgID", "parent": "ParentID", "maxDepth": 0}`, "'maxDepth' not a positive integer"},
+		{`{"id": "OrgID", "parent": "ParentID", "maxDepth": 101}`, "'maxDepth' above the recursion limit of 100"},
+		{`{"id": "OrgID", "parent": "ParentID", "depth": 2}`, "Unexpected key depth"},
+		{`"OrgID"`, "Invalid 'hierarchy' JSON type"},
+	}
+
+	for _, tt := range tests {
+		input := `[{"name": "Orgs", "tableName": "Orgs", "fields": ["OrgID", "ParentID"], "hierarchy": ` + tt.hierarchy + `}]`
+		_, err := ParseJSON([]byte(input))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected error containing %q. got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestParseRowFilter(t *testing.T) {
+	input := `[{"name": "Patients", "tableName": "Patients", "fields": ["ClinicID"],
+		"rowFilter": "@('ClinicID') IN $principal.clinics"}]`
+	service, err := ParseJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	patients := service.Endpoints["Patients"]
+	if patients.RowFilter != "@('ClinicID') IN $principal.clinics" {
+		t.Errorf("unexpected row filter %s", patients.RowFilter)
+	}
+	if !strings.Contains(patients.JSON(), `"rowFilter" : "@('ClinicID') IN $principal.clinics"`) {
+		t.Errorf("expected rowFilter in JSON. got=%s", patients.JSON())
+	}
+
+	tests := []struct {
+		rowFilter string
+		expected  string
+	}{
+		{`"ClinicID:"`, "'rowFilter' may only contain expressions"},
+		{`"@('ClinicID') IN $user.clinics"`, "'rowFilter' parser errors"},
+		{`1`, "'rowFilter' not string"},
+	}
+
+	for _, tt := range tests {
+		input := `[{"name": "Patients", "tableName": "Patients", "fields": ["ClinicID"], "rowFilter": ` + tt.rowFilter + `}]`
+		_, err := ParseJSON([]byte(input))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected error containing %q. got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestParsePolicies(t *testing.T) {
+	input := `{
+  "policies": {
+    "phi": {"permissions": ["phi:read"], "onDeny": "omit"},
+    "billing": "billing:read"
+  },
+  "endpoints": [
+    {"name": "Patients", "tableName": "Patients", "security": {"policy": "billing"},
+      "fields": ["PatientID", {"name": "Diagnosis", "security": {"policy": "phi"}}, {"name": "Notes", "security": {"policy": "phi"}}]}
+  ]
+}`
+	service, err := ParseJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	patients := service.Endpoints["Patients"]
+	if patients.Security != service.Policies["billing"] {
+		t.Errorf("expected endpoint to use the billing policy. got=%+v", patients.Security)
+	}
+	diagnosis, notes := patients.Fields["Diagnosis"], patients.Fields["Notes"]
+	if diagnosis.Security != service.Policies["phi"] || notes.Security != service.Policies["phi"] {
+		t.Errorf("expected fields to share the phi policy")
+	}
+	if diagnosis.Security.OnDeny != "omit" {
+		t.Errorf("expected onDeny omit. got=%s", diagnosis.Security.OnDeny)
+	}
+
+	// JSON output references policies by name and parses back into the same service
+	output := service.JSON()
+	if !strings.Contains(output, `"policies" : {"billing" : ["billing:read"], "phi" : {"permissions": ["phi:read"], "onDeny": "omit"}}`) {
+		t.Errorf("expected policies in JSON. got=%s", output)
+	}
+	if !strings.Contains(output, `"security" : {"policy": "phi"}`) {
+		t.Errorf("expected policy reference in JSON. got=%s", output)
+	}
+	reparsed, err := ParseJSON([]byte(output))
+	if err != nil {
+		t.Fatalf("error parsing JSON output: %v", err)
+	}
+	if reparsed.JSON() != output {
+		t.Errorf("JSON not round tripped.\nexpected=%s\ngot=     %s", output, reparsed.JSON())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"endpoints": [{"name": "P", "tableName": "P", "fields": [{"name": "A", "security": {"policy": "phi"}}]}]}`, "unknown policy phi"},
+		{`{"policies": {"phi": "phi:read"}, "endpoints": [{"name": "P", "tableName": "P", "security": {"policy": "other"}, "fields": ["A"]}]}`, "unknown policy other"},
+		{`{"policies": {"phi": "phi:read"}, "endpoints": [{"name": "P", "tableName": "P", "fields": [{"name": "A", "security": {"policy": "phi", "onDeny": "omit"}}]}]}`, "policy reference may not have other keys"},
+		{`{"policies": {"phi": {"policy": "other"}}, "endpoints": []}`, "Policy phi: policy references are only allowed"},
+		{`{"policies": {"phi": 1}, "endpoints": []}`, "Policy phi: security value has invalid type"},
+		{`{"policies": [], "endpoints": []}`, "Config policies not object"},
+		{`{"policies": {}}`, "Config endpoints not array"},
+		{`{"endpoints": [], "settings": {}}`, "Unexpected key settings in config"},
+		{`"Patients"`, "Config must be an array of endpoints or an object"},
+		{`["Patients"]`, "Endpoint 0 not object"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseJSON([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected error containing %q. got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestParseClassifications(t *testing.T) {
+	input := `{
+  "policies": {"phi": {"permissions": ["phi:read"], "onDeny": "omit"}},
+  "classifications": {"phi": {"policy": "phi"}, "pii": "pii:read"},
+  "endpoints": [
+    {"name": "Patients", "tableName": "Patients", "security": "patients:read",
+      "fields": [
+        {"name": "PatientID", "classification": "internal"},
+        {"name": "Diagnosis", "classification": "phi"},
+        {"name": "SSN", "classification": "pii", "security": "admin"},
+        "Clinic"
+      ]}
+  ]
+}`
+	service, err := ParseJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	patients := service.Endpoints["Patients"]
+	tests := []struct {
+		field          string
+		classification string
+		policy         string
+	}{
+		// Classifications without a policy inherit the endpoint policy
+		{"PatientID", "internal", "[patients:read]"},
+		// Classification policies add to the endpoint policy
+		{"Diagnosis", "phi", "allOf(patients:read, phi:read)"},
+		// Field policies override the classification
+		{"SSN", "pii", "[admin]"},
+		{"Clinic", "", "[patients:read]"},
+	}
+	for _, tt := range tests {
+		field := patients.Fields[tt.field]
+		if field.Classification != tt.classification {
+			t.Errorf("%s: wrong classification. expected=%q, got=%q", tt.field, tt.classification, field.Classification)
+		}
+		if policy := patients.FieldPolicy(&field); policy.String() != tt.policy {
+			t.Errorf("%s: wrong policy. expected=%s, got=%s", tt.field, tt.policy, policy.String())
+		}
+	}
+
+	output := service.JSON()
+	if !strings.Contains(output, `"classifications" : {"phi" : {"policy": "phi"}, "pii" : ["pii:read"]}`) {
+		t.Errorf("expected classifications in JSON. got=%s", output)
+	}
+	if !strings.Contains(output, `"nullable" : true, "classification" : "phi"`) {
+		t.Errorf("expected field classification in JSON. got=%s", output)
+	}
+	reparsed, err := ParseJSON([]byte(output))
+	if err != nil {
+		t.Fatalf("error parsing JSON output: %v", err)
+	}
+	if reparsed.JSON() != output {
+		t.Errorf("JSON not round tripped.\nexpected=%s\ngot=     %s", output, reparsed.JSON())
+	}
+
+	invalid := []struct {
+		input    string
+		expected string
+	}{
+		{`{"classifications": {"phi": {"policy": "other"}}, "endpoints": []}`, "Classification phi: unknown policy other"},
+		{`{"classifications": {"phi": null}, "endpoints": []}`, "Classification phi is null"},
+		{`{"classifications": {"PHI": "phi:read"}, "endpoints": []}`, "must be lower case"},
+		{`{"classifications": [], "endpoints": []}`, "Config classifications not object"},
+		{`[{"name": "P", "tableName": "P", "fields": [{"name": "A", "classification": 1}]}]`, "'classification' not string"},
+		{`[{"name": "P", "tableName": "P", "fields": [{"name": "A", "classification": ""}]}]`, "'classification' cannot be empty"},
+	}
+	for _, tt := range invalid {
+		_, err := ParseJSON([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected error containing %q. got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestParseOperations(t *testing.T) {
+	input := `{
+  "policies": {"reports": {"permissions": ["reports:run"]}},
+  "endpoints": [
+    {"name": "Invoices", "tableName": "Invoices",
+      "joins": [{"endpoint": "Patients", "on": "PatientID"}],
+      "operations": {
+        "group": {"policy": "reports"},
+        "groupFunctions": {"SUM": {"permissions": ["billing:totals"], "onDeny": "omit"}},
+        "joins": {"Patients": "phi:read"},
+        "limit": {"above": 1000, "security": {"permissions": ["bulk:read"], "onDeny": "omit"}},
+        "export": "export:invoices"
+      },
+      "fields": ["InvoiceID", "PatientID"]},
+    {"name": "Patients", "tableName": "Patients", "fields": ["PatientID"]}
+  ]
+}`
+	service, err := ParseJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	invoices := service.Endpoints["Invoices"]
+	ops := invoices.Operations
+	if ops.Group != service.Policies["reports"] {
+		t.Errorf("expected group to use the reports policy. got=%v", ops.Group)
+	}
+	if sum := ops.GroupFunctions["SUM"]; sum == nil || sum.OnDeny != "omit" {
+		t.Errorf("expected SUM policy with onDeny omit. got=%+v", sum)
+	}
+	if ops.Limit == nil || ops.Limit.Above != 1000 || ops.Limit.Security.OnDeny != "omit" {
+		t.Errorf("wrong limit policy. got=%+v", ops.Limit)
+	}
+	if ops.Export.String() != "[export:invoices]" {
+		t.Errorf("wrong export policy. got=%s", ops.Export)
+	}
+	if len(ops.Policies()) != 5 {
+		t.Errorf("expected 5 policies. got=%d", len(ops.Policies()))
+	}
+
+	// Joins under another alias use the policy of the config join
+	if invoices.JoinPolicy("Patients", "Patients") != ops.Joins["Patients"] || invoices.JoinPolicy("Owner", "Patients") != ops.Joins["Patients"] {
+		t.Errorf("expected the Patients join policy for both aliases")
+	}
+	if invoices.JoinPolicy("Other", "Other") != nil {
+		t.Errorf("expected no policy for an unknown join")
+	}
+
+	limit, above := 1000, 1001
+	if ops.Limit.Exceeded(&limit) || !ops.Limit.Exceeded(&above) || !ops.Limit.Exceeded(nil) {
+		t.Errorf("wrong limit threshold")
+	}
+
+	output := service.JSON()
+	reparsed, err := ParseJSON([]byte(output))
+	if err != nil {
+		t.Fatalf("error parsing JSON output: %v", err)
+	}
+	if reparsed.JSON() != output {
+		t.Errorf("JSON not round tripped.\nexpected=%s\ngot=     %s", output, reparsed.JSON())
+	}
+
+	invalid := []struct {
+		operations string
+		expected   string
+	}{
+		{`{"group": {"permissions": ["a"], "onDeny": "omit"}}`, "group: onDeny 'omit' is not allowed"},
+		{`{"export": {"permissions": ["a"], "onDeny": "omit"}}`, "export: onDeny 'omit' is not allowed"},
+		{`{"groupFunctions": {"SUM": {"permissions": ["a"], "onDeny": "mask"}}}`, "groupFunctions SUM: onDeny 'mask' is not allowed"},
+		{`{"groupFunctions": {"sum": "a"}}`, "must be an upper case group function"},
+		{`{"joins": {"Claims": "a"}}`, "joins Claims: join not found"},
+		{`{"limit": {"above": 0, "security": "a"}}`, "limit 'above' not a positive integer"},
+		{`{"limit": {"above": 10}}`, "limit has no 'security'"},
+		{`{"sort": "a"}`, "Unexpected key sort in operations"},
+		{`"a"`, "'operations' not object"},
+	}
+	for _, tt := range invalid {
+		config := `[{"name": "P", "tableName": "P", "operations": ` + tt.operations + `, "fields": ["A"]}]`
+		_, err := ParseJSON([]byte(config))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected error containing %q. got=%v", tt.operations, tt.expected, err)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package endpoint
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -13,18 +15,22 @@ func TestTypescript(t *testing.T) {
   CreateDate?: Date;
   Active?: boolean;
   Zip?: number;
+  Invoices?: Invoices[];
 }`,
 		"Invoices": `interface Invoices { 
   SaleID: string;
   Balance?: number;
   InvoiceNumber?: number;
   CreateDate?: Date;
+  Sales?: Sales[];
 }`,
 		"Sales": `interface Sales { 
   CustomerID: string;
   SaleID?: number;
   CreateDate?: Date;
   Charge?: number;
+  Customers?: Customers[];
+  Invoices?: Invoices[];
 }`,
 	}
 	service, err := ParseJSON([]byte(testingJSON()))
@@ -45,3 +51,240 @@ func TestTypescript(t *testing.T) {
 	}
 
 }
+
+func TestJoinAliases(t *testing.T) {
+	input := `
+[
+  {
+    "name": "Appointments",
+    "tableName": "Appointments",
+    "joins": [
+      { "endpoint": "Providers", "alias": "Dentist", "on": ["DentistID", "ProviderID"] },
+      { "endpoint": "Providers", "alias": "Hygienist", "on": ["HygienistID", "ProviderID"] }
+    ],
+    "fields": ["DentistID", "HygienistID"]
+  },
+  {
+    "name": "Providers",
+    "tableName": "Providers",
+    "fields": [{"name": "ProviderID", "nullable": false}, "Name"]
+  }
+]`
+
+	service, err := ParseJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	appointments := service.Endpoints["Appointments"]
+	if len(appointments.JoinNames) != 2 || appointments.JoinNames[0] != "Dentist" || appointments.JoinNames[1] != "Hygienist" {
+		t.Fatalf("unexpected join names %v", appointments.JoinNames)
+	}
+
+	for _, alias := range appointments.JoinNames {
+		join := appointments.Joins[alias]
+		if join.Name() != alias {
+			t.Errorf("expected join name %s. got=%s", alias, join.Name())
+		}
+		if join.ChildEndpoint() != service.Endpoints["Providers"] {
+			t.Errorf("join %s not resolved to Providers", alias)
+		}
+	}
+
+	expectedTS := `interface Appointments { 
+  DentistID?: string;
+  HygienistID?: string;
+  Dentist?: Providers[];
+  Hygienist?: Providers[];
+}`
+	if appointments.TS() != expectedTS {
+		t.Errorf("TS output does not match\n%s\n%s", appointments.TS(), expectedTS)
+	}
+
+	dentist := appointments.Joins["Dentist"]
+	if !strings.Contains(dentist.JSON(), `"alias" : "Dentist"`) {
+		t.Errorf("expected alias in join JSON. got=%s", dentist.JSON())
+	}
+
+	paths := service.AllEndpointPaths(1)
+	expectedPaths := []string{"Appointments", "Appointments/Dentist", "Appointments/Hygienist", "Providers"}
+	if len(paths) != len(expectedPaths) {
+		t.Fatalf("unexpected paths %v", paths)
+	}
+	for i, p := range paths {
+		if strings.Join(p, "/") != expectedPaths[i] {
+			t.Errorf("expected path %s. got=%s", expectedPaths[i], strings.Join(p, "/"))
+		}
+	}
+}
+
+func TestDuplicateJoinAlias(t *testing.T) {
+	input := `
+[
+  {
+    "name": "Appointments",
+    "tableName": "Appointments",
+    "joins": [
+      { "endpoint": "Providers", "on": ["DentistID", "ProviderID"] },
+      { "endpoint": "Providers", "on": ["HygienistID", "ProviderID"] }
+    ],
+    "fields": ["DentistID", "HygienistID"]
+  },
+  {
+    "name": "Providers",
+    "tableName": "Providers",
+    "fields": ["ProviderID"]
+  }
+]`
+
+	_, err := ParseJSON([]byte(input))
+	if err == nil || !strings.Contains(err.Error(), "Duplicate join Providers") {
+		t.Errorf("expected duplicate join error. got=%v", err)
+	}
+}
+
+func TestJoinCardinality(t *testing.T) {
+	input := `
+[
+  {
+    "name": "Invoices",
+    "tableName": "Invoices",
+    "joins": [
+      { "endpoint": "Customers", "on": "CustomerID", "cardinality": "many-to-one" },
+      { "endpoint": "Lines", "on": "InvoiceID", "cardinality": "one-to-many" }
+    ],
+    "fields": ["InvoiceID", "CustomerID"]
+  },
+  {
+    "name": "Customers",
+    "tableName": "Customers",
+    "fields": ["CustomerID"]
+  },
+  {
+    "name": "Lines",
+    "tableName": "Lines",
+    "fields": ["InvoiceID"]
+  }
+]`
+
+	service, err := ParseJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	invoices := service.Endpoints["Invoices"]
+	expectedTS := `interface Invoices { 
+  InvoiceID?: string;
+  CustomerID?: string;
+  Customers?: Customers;
+  Lines?: Lines[];
+}`
+	if invoices.TS() != expectedTS {
+		t.Errorf("TS output does not match\n%s\n%s", invoices.TS(), expectedTS)
+	}
+
+	customers := invoices.Joins["Customers"]
+	if customers.Cardinality != ManyToOne {
+		t.Errorf("expected cardinality %s. got=%s", ManyToOne, customers.Cardinality)
+	}
+	if !strings.Contains(customers.JSON(), `"cardinality": "many-to-one"`) {
+		t.Errorf("expected cardinality in join JSON. got=%s", customers.JSON())
+	}
+}
+
+func TestSetTenantColumns(t *testing.T) {
+	service, err := ParseJSON([]byte(testingJSON()))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	err = service.SetTenantColumns(map[string]string{"Customers": "TenantID", "Missing": "TenantID"})
+	if err == nil || !strings.Contains(err.Error(), "Tenant field TenantID not found on endpoint Customers") ||
+		!strings.Contains(err.Error(), "Tenant endpoint Missing not found") {
+		t.Errorf("expected tenant errors. got=%v", err)
+	}
+	if _, ok := service.TenantColumn("Customers"); ok {
+		t.Errorf("invalid tenant columns should not be set")
+	}
+
+	columns := map[string]string{"Customers": "CustomerID"}
+	if err := service.SetTenantColumns(columns); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	columns["Customers"] = "TenantID"
+	if column, ok := service.TenantColumn("Customers"); !ok || column != "CustomerID" {
+		t.Errorf("expected tenant column CustomerID. got=%s", column)
+	}
+}
+
+func TestUnprotectedFields(t *testing.T) {
+	config := `{
+  %s
+  "endpoints": [
+    {"name": "Patients", "tableName": "Patients",
+      "fields": ["PatientID", {"name": "Notes", "security": "phi:read"}, {"name": "Clinic", "security": "*"},
+        {"name": "Phone", "security": {"anyOf": ["*", "phi:read"]}}]},
+    {"name": "Invoices", "tableName": "Invoices", "security": "billing:read", "fields": ["InvoiceID"]}
+  ]
+}`
+
+	tests := []struct {
+		settings string
+		expected []UnprotectedField
+	}{
+		{"", []UnprotectedField{
+			{Endpoint: "Patients", Field: "PatientID", Reason: "no policy"},
+			{Endpoint: "Patients", Field: "Clinic", Reason: "wildcard"},
+			{Endpoint: "Patients", Field: "Phone", Reason: "wildcard"},
+		}},
+		{`"defaultPolicy": "patients:read",`, []UnprotectedField{
+			{Endpoint: "Patients", Field: "Clinic", Reason: "wildcard"},
+			{Endpoint: "Patients", Field: "Phone", Reason: "wildcard"},
+		}},
+		{`"denyByDefault": true,`, []UnprotectedField{
+			{Endpoint: "Patients", Field: "Clinic", Reason: "wildcard"},
+			{Endpoint: "Patients", Field: "Phone", Reason: "wildcard"},
+		}},
+	}
+
+	for _, tt := range tests {
+		service, err := ParseJSON([]byte(fmt.Sprintf(config, tt.settings)))
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+
+		unprotected := service.UnprotectedFields()
+		if len(unprotected) != len(tt.expected) {
+			t.Fatalf("%s: wrong unprotected fields. expected=%v, got=%v", tt.settings, tt.expected, unprotected)
+		}
+		for i := range tt.expected {
+			if unprotected[i] != tt.expected[i] {
+				t.Errorf("%s: wrong unprotected field %d. expected=%v, got=%v", tt.settings, i, tt.expected[i], unprotected[i])
+			}
+		}
+
+		// Settings are kept in the JSON output
+		reparsed, err := ParseJSON([]byte(service.JSON()))
+		if err != nil {
+			t.Fatalf("error parsing JSON output: %v", err)
+		}
+		if reparsed.JSON() != service.JSON() {
+			t.Errorf("JSON not round tripped.\nexpected=%s\ngot=     %s", service.JSON(), reparsed.JSON())
+		}
+	}
+
+	invalid := []struct {
+		settings string
+		expected string
+	}{
+		{`"denyByDefault": "yes",`, "Config denyByDefault not bool"},
+		{`"defaultPolicy": {"policy": "phi"},`, "Config defaultPolicy: unknown policy phi"},
+		{`"defaultPolicy": {"permissions": ["a"], "onDeny": "partial", "pattern": "**##"},`, "onDeny 'partial' is only allowed on fields"},
+	}
+	for _, tt := range invalid {
+		_, err := ParseJSON([]byte(fmt.Sprintf(config, tt.settings)))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected error containing %q. got=%v", tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package endpoint
+
+// Field any caller can select
+type UnprotectedField struct {
+	Endpoint string
+	Field    string
+	Reason   string // "no policy" or "wildcard"
+	// Classification of the field so sensitive fields stand out. Ex. "phi"
+	Classification string
+}
+
+// List every field reachable without a permission.
+// Fields without a policy are listed unless the service denies by default.
+// Fields whose policy is allowed by a wildcard "*" are listed so public fields can be reviewed.
+func (s *Service) UnprotectedFields() []UnprotectedField {
+	var unprotected []UnprotectedField
+	for _, epName := range s.EndpointNames {
+		ep := s.Endpoints[epName]
+		for _, name := range ep.FieldNames {
+			field := ep.Fields[name]
+			policy := ep.FieldPolicy(&field)
+			if policy == nil {
+				if !s.Settings.DenyByDefault {
+					unprotected = append(unprotected, UnprotectedField{Endpoint: ep.Name, Field: name, Reason: "no policy", Classification: field.Classification})
+				}
+				continue
+			}
+
+			// Allowed without granting a permission
+			allowed, _ := policy.Evaluate(func([]string) (bool, error) { return false, nil })
+			if allowed {
+				unprotected = append(unprotected, UnprotectedField{Endpoint: ep.Name, Field: name, Reason: "wildcard", Classification: field.Classification})
+			}
+		}
+	}
+	return unprotected
+}
@@ -0,0 +1,214 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Policies of operations on an endpoint's rows, checked in addition to the field policies.
+// Ex. {"group": "reports:aggregate", "groupFunctions": {"SUM": "billing:totals"}, "joins": {"Patients": "phi:read"}}
+type Operations struct {
+	// Grouping the endpoint with GROUP or any group function
+	Group *SecurityPolicy
+	// Group functions by name. Ex. "SUM"
+	GroupFunctions map[string]*SecurityPolicy
+	// Joins and exists filters by join name
+	Joins map[string]*SecurityPolicy
+	// Requests without a limit or above the threshold
+	Limit *LimitPolicy
+	// Requests made in export mode
+	Export *SecurityPolicy
+}
+
+// Policy of a limit above Above. A request without a limit is above every threshold.
+// With onDeny "omit" the limit is lowered to Above.
+type LimitPolicy struct {
+	Above    int
+	Security *SecurityPolicy
+}
+
+// Limit requires the policy
+func (lp *LimitPolicy) Exceeded(limit *int) bool {
+	return limit == nil || *limit <= 0 || *limit > lp.Above
+}
+
+func (o *Operations) IsEmpty() bool {
+	return o == nil || (o.Group == nil && len(o.GroupFunctions) == 0 && len(o.Joins) == 0 && o.Limit == nil && o.Export == nil)
+}
+
+// Every policy of the operations
+func (o *Operations) Policies() []*SecurityPolicy {
+	if o == nil {
+		return nil
+	}
+
+	var policies []*SecurityPolicy
+	for _, policy := range []*SecurityPolicy{o.Group, o.Export} {
+		if policy != nil {
+			policies = append(policies, policy)
+		}
+	}
+	if o.Limit != nil {
+		policies = append(policies, o.Limit.Security)
+	}
+	for _, name := range sortedKeys(o.GroupFunctions) {
+		policies = append(policies, o.GroupFunctions[name])
+	}
+	for _, name := range sortedKeys(o.Joins) {
+		policies = append(policies, o.Joins[name])
+	}
+	return policies
+}
+
+func (o *Operations) JSON() string {
+	var items []string
+	if o.Group != nil {
+		items = append(items, "\"group\" : "+o.Group.JSON())
+	}
+	if len(o.GroupFunctions) > 0 {
+		items = append(items, "\"groupFunctions\" : "+policiesJSON(o.GroupFunctions))
+	}
+	if len(o.Joins) > 0 {
+		items = append(items, "\"joins\" : "+policiesJSON(o.Joins))
+	}
+	if o.Limit != nil {
+		items = append(items, fmt.Sprintf("\"limit\" : {\"above\" : %d, \"security\" : %s}", o.Limit.Above, o.Limit.Security.JSON()))
+	}
+	if o.Export != nil {
+		items = append(items, "\"export\" : "+o.Export.JSON())
+	}
+	return "{" + strings.Join(items, ", ") + "}"
+}
+
+func policiesJSON(policies map[string]*SecurityPolicy) string {
+	var items []string
+	for _, name := range sortedKeys(policies) {
+		items = append(items, fmt.Sprintf("%s : %s", jsonString(name), policies[name].JSON()))
+	}
+	return "{" + strings.Join(items, ", ") + "}"
+}
+
+func sortedKeys(policies map[string]*SecurityPolicy) []string {
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Policy of a join to child by alias. Joins made under another alias use the policy of a config join to the same endpoint.
+func (e *Endpoint) JoinPolicy(alias string, child string) *SecurityPolicy {
+	if e.Operations == nil {
+		return nil
+	}
+	if policy, ok := e.Operations.Joins[alias]; ok {
+		return policy
+	}
+	for _, name := range sortedKeys(e.Operations.Joins) {
+		if join, ok := e.Joins[name]; ok && join.EndpointName() == child {
+			return e.Operations.Joins[name]
+		}
+	}
+	return nil
+}
+
+// Parse the operations of an endpoint. Joins must be parsed first.
+func (s *Service) parseOperations(value any, e *Endpoint) (*Operations, error) {
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("'operations' not object. got=%T", value)
+	}
+
+	ops := &Operations{}
+	var errs []error
+
+	// Operations are refused or skipped. Their values cannot be masked
+	policy := func(key string, value any, omit bool) *SecurityPolicy {
+		policy, err := s.parseSecurity(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			return nil
+		}
+		if policy == nil {
+			errs = append(errs, fmt.Errorf("%s is null", key))
+			return nil
+		}
+		if policy.Masks() || (policy.OnDeny == "omit" && !omit) {
+			errs = append(errs, fmt.Errorf("%s: onDeny '%s' is not allowed", key, policy.OnDeny))
+			return nil
+		}
+		return policy
+	}
+	policies := func(key string, value any, valid func(name string) error) map[string]*SecurityPolicy {
+		items, ok := value.(map[string]any)
+		if !ok {
+			errs = append(errs, fmt.Errorf("'%s' not object. got=%T", key, value))
+			return nil
+		}
+		output := map[string]*SecurityPolicy{}
+		for name, item := range items {
+			if err := valid(name); err != nil {
+				errs = append(errs, fmt.Errorf("%s %s: %w", key, name, err))
+				continue
+			}
+			if p := policy(key+" "+name, item, true); p != nil {
+				output[name] = p
+			}
+		}
+		return output
+	}
+
+	for key, item := range m {
+		switch key {
+		case "group":
+			// Omitting the group columns would aggregate across them
+			ops.Group = policy(key, item, false)
+		case "groupFunctions":
+			ops.GroupFunctions = policies(key, item, func(name string) error {
+				if name != strings.ToUpper(name) || name == "GROUP" {
+					return errors.New("must be an upper case group function other than GROUP")
+				}
+				return nil
+			})
+		case "joins":
+			ops.Joins = policies(key, item, func(name string) error {
+				if _, ok := e.Joins[name]; !ok {
+					return errors.New("join not found")
+				}
+				return nil
+			})
+		case "limit":
+			limit, ok := item.(map[string]any)
+			if !ok {
+				errs = append(errs, fmt.Errorf("'limit' not object. got=%T", item))
+				continue
+			}
+			above, ok := limit["above"].(float64)
+			if !ok || above != float64(int(above)) || above < 1 {
+				errs = append(errs, fmt.Errorf("limit 'above' not a positive integer. got=%v", limit["above"]))
+				continue
+			}
+			if _, ok := limit["security"]; !ok {
+				errs = append(errs, errors.New("limit has no 'security'"))
+				continue
+			}
+			for k := range limit {
+				if k != "above" && k != "security" {
+					errs = append(errs, fmt.Errorf("Unexpected key %s in limit", k))
+				}
+			}
+			if p := policy("limit", limit["security"], true); p != nil {
+				ops.Limit = &LimitPolicy{Above: int(above), Security: p}
+			}
+		case "export":
+			ops.Export = policy(key, item, false)
+		default:
+			errs = append(errs, fmt.Errorf("Unexpected key %s in operations", key))
+		}
+	}
+
+	return ops, errors.Join(errs...)
+}
@@ -0,0 +1,201 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Requirement is a node of a permission tree.
+// A leaf requires its Permission, AllOf requires every child and AnyOf requires one child.
+// Ex. {"anyOf": ["billing:read", {"allOf": ["admin", "phi:read"]}]}
+type Requirement struct {
+	Permission string
+	AllOf      []*Requirement
+	AnyOf      []*Requirement
+}
+
+func (r *Requirement) leaf() bool {
+	return r.AllOf == nil && r.AnyOf == nil
+}
+
+// Permissions of an all-of node whose children are all leaves, checked as one permission set.
+// A wildcard leaf is satisfied on its own so it is left out of the set.
+func (r *Requirement) leafSet() ([]string, bool) {
+	if r.AllOf == nil {
+		return nil, false
+	}
+	perms := make([]string, 0, len(r.AllOf))
+	for _, child := range r.AllOf {
+		if !child.leaf() {
+			return nil, false
+		}
+		if child.Permission != "*" {
+			perms = append(perms, child.Permission)
+		}
+	}
+	return perms, true
+}
+
+// Evaluate the tree by checking permission sets with allow.
+// A wildcard leaf "*" is allowed without calling allow.
+func (r *Requirement) Evaluate(allow func(required []string) (bool, error)) (bool, error) {
+	if r.leaf() {
+		return allowSet([]string{r.Permission}, allow)
+	}
+	if perms, ok := r.leafSet(); ok {
+		if len(perms) == 0 {
+			return true, nil
+		}
+		return allow(perms)
+	}
+
+	if r.AllOf != nil {
+		for _, child := range r.AllOf {
+			allowed, err := child.Evaluate(allow)
+			if err != nil || !allowed {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	for _, child := range r.AnyOf {
+		allowed, err := child.Evaluate(allow)
+		if err != nil {
+			return false, err
+		}
+		if allowed {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Permission sets Evaluate may check, without wildcard sets
+func (r *Requirement) Sets() [][]string {
+	if r.leaf() {
+		return checkedSets([]string{r.Permission})
+	}
+	if perms, ok := r.leafSet(); ok {
+		if len(perms) == 0 {
+			return nil
+		}
+		return [][]string{perms}
+	}
+
+	var sets [][]string
+	for _, child := range append(r.AllOf, r.AnyOf...) {
+		sets = append(sets, child.Sets()...)
+	}
+	return sets
+}
+
+func (r *Requirement) JSON() string {
+	if r.leaf() {
+		return jsonString(r.Permission)
+	}
+
+	key, children := "allOf", r.AllOf
+	if r.AnyOf != nil {
+		key, children = "anyOf", r.AnyOf
+	}
+	return fmt.Sprintf("{\"%s\": %s}", key, requirementsJSON(children))
+}
+
+func (r *Requirement) String() string {
+	if r.leaf() {
+		return r.Permission
+	}
+
+	key, children := "allOf", r.AllOf
+	if r.AnyOf != nil {
+		key, children = "anyOf", r.AnyOf
+	}
+	names := make([]string, 0, len(children))
+	for _, child := range children {
+		names = append(names, child.String())
+	}
+	return key + "(" + strings.Join(names, ", ") + ")"
+}
+
+func requirementsJSON(children []*Requirement) string {
+	items := make([]string, 0, len(children))
+	for _, child := range children {
+		items = append(items, child.JSON())
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+func hasWildcard(perms []string) bool {
+	for _, p := range perms {
+		if p == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func allowSet(perms []string, allow func(required []string) (bool, error)) (bool, error) {
+	if hasWildcard(perms) {
+		return true, nil
+	}
+	return allow(perms)
+}
+
+func checkedSets(perms []string) [][]string {
+	if hasWildcard(perms) {
+		return nil
+	}
+	return [][]string{perms}
+}
+
+// Parse a permission string or an object with a single anyOf or allOf key
+func parseRequirement(value any) (*Requirement, error) {
+	switch v := value.(type) {
+	case string:
+		trimmed := strings.TrimSpace(v)
+		if trimmed == "" {
+			return nil, errors.New("permission cannot be empty")
+		}
+		return &Requirement{Permission: trimmed}, nil
+	case map[string]any:
+		if len(v) != 1 {
+			return nil, fmt.Errorf("requirement must have a single 'anyOf' or 'allOf' key. got=%d keys", len(v))
+		}
+		for key, items := range v {
+			if key != "anyOf" && key != "allOf" {
+				return nil, fmt.Errorf("unexpected key in requirement: %s", key)
+			}
+			children, err := parseRequirements(key, items)
+			if err != nil {
+				return nil, err
+			}
+			if key == "anyOf" {
+				return &Requirement{AnyOf: children}, nil
+			}
+			return &Requirement{AllOf: children}, nil
+		}
+	}
+	return nil, fmt.Errorf("requirement not string or object. got=%T", value)
+}
+
+func parseRequirements(key string, value any) ([]*Requirement, error) {
+	items, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("'%s' not array. got=%T", key, value)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("'%s' cannot be empty", key)
+	}
+
+	children := make([]*Requirement, 0, len(items))
+	for i, item := range items {
+		child, err := parseRequirement(item)
+		if err != nil {
+			return nil, fmt.Errorf("'%s[%d]': %w", key, i, err)
+		}
+		children = append(children, child)
+	}
+	return children, nil
+}
@@ -1,32 +1,198 @@
 package endpoint
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strings"
 )
 
 // SecurityPolicy represents normalized security metadata with permissions and denial behavior
 type SecurityPolicy struct {
-	Permissions []string
-	OnDeny      string // "error" or "omit"
+	Permissions []string     // All required
+	Requirement *Requirement // Any-of and all-of tree used instead of Permissions
+	OnDeny      string       // "error", "omit", "mask" or "partial"
+	Mask        string       // Placeholder returned by "mask". Empty returns NULL
+	Pattern     string       // Pattern of "partial". Ex. "***-**-####"
+	Name        string       // Name of a policy defined in the service config
 }
 
-// HasWildcard returns true if the policy contains the wildcard permission "*"
+// Masks returns true when denied fields are returned masked under the same name
+func (sp *SecurityPolicy) Masks() bool {
+	return sp != nil && (sp.OnDeny == "mask" || sp.OnDeny == "partial")
+}
+
+// JSON form of the policy. Named policies are referenced with {"policy": name}
+func (sp *SecurityPolicy) JSON() string {
+	if sp.Name != "" {
+		return fmt.Sprintf("{\"policy\": %s}", jsonString(sp.Name))
+	}
+	return sp.definitionJSON()
+}
+
+// The array form is used for the default "error" behavior
+func (sp *SecurityPolicy) definitionJSON() string {
+	if sp.Requirement != nil {
+		tree := sp.Requirement.JSON()
+		if sp.OnDeny == "error" {
+			return tree
+		}
+		// Add the behavior keys to the requirement object
+		return strings.TrimSuffix(tree, "}") + ", " + sp.behaviorJSON() + "}"
+	}
+
+	quoted := make([]string, 0, len(sp.Permissions))
+	for _, s := range sp.Permissions {
+		quoted = append(quoted, fmt.Sprintf("\"%s\"", s))
+	}
+	if sp.OnDeny == "error" {
+		return "[" + strings.Join(quoted, ", ") + "]"
+	}
+
+	var out strings.Builder
+	out.WriteString("{\"permissions\": [" + strings.Join(quoted, ", ") + "], ")
+	out.WriteString(sp.behaviorJSON())
+	out.WriteString("}")
+	return out.String()
+}
+
+func (sp *SecurityPolicy) behaviorJSON() string {
+	out := fmt.Sprintf("\"onDeny\": \"%s\"", sp.OnDeny)
+	if sp.Mask != "" {
+		out += ", \"mask\": " + jsonString(sp.Mask)
+	}
+	if sp.Pattern != "" {
+		out += ", \"pattern\": " + jsonString(sp.Pattern)
+	}
+	return out
+}
+
+// Evaluate the policy by checking permission sets with allow.
+// Every checker is asked for the same sets so any-of and all-of trees behave the same with each checker.
+func (sp *SecurityPolicy) Evaluate(allow func(required []string) (bool, error)) (bool, error) {
+	if sp.IsEmpty() {
+		return true, nil
+	}
+	if sp.Requirement != nil {
+		return sp.Requirement.Evaluate(allow)
+	}
+	return allowSet(sp.Permissions, allow)
+}
+
+// Allow evaluates the policy with a SecurityChecker
+func (sp *SecurityPolicy) Allow(checker SecurityChecker) (bool, error) {
+	return sp.Evaluate(checker.Allow)
+}
+
+// Permission sets Evaluate may check, without wildcard sets.
+// Used to check every set of a request in one ContextChecker call.
+func (sp *SecurityPolicy) Sets() [][]string {
+	if sp.IsEmpty() {
+		return nil
+	}
+	if sp.Requirement != nil {
+		return sp.Requirement.Sets()
+	}
+	return checkedSets(sp.Permissions)
+}
+
+// Required permissions for error messages. Ex. [a b] or anyOf(a, allOf(b, c))
+func (sp *SecurityPolicy) String() string {
+	if sp.Requirement != nil {
+		return sp.Requirement.String()
+	}
+	return fmt.Sprintf("%v", sp.Permissions)
+}
+
+// Masked text of a partial pattern and the number of characters of the value it reveals.
+// Ex. "***-**-####" reveals the last 4 characters after "***-**-"
+type MaskPattern struct {
+	Text    string
+	Shown   int
+	Leading bool // Revealed characters are at the start of the value
+}
+
+// ParseMaskPattern reads a partial pattern. '#' marks revealed characters and
+// must be a single run at the start or the end of the pattern.
+func ParseMaskPattern(pattern string) (MaskPattern, error) {
+	text := strings.TrimLeft(pattern, "#")
+	leading := len(pattern) - len(text)
+	text = strings.TrimRight(text, "#")
+	trailing := len(pattern) - leading - len(text)
+
+	switch {
+	case leading == 0 && trailing == 0:
+		return MaskPattern{}, fmt.Errorf("pattern %q reveals no characters, use '#'", pattern)
+	case text == "":
+		return MaskPattern{}, fmt.Errorf("pattern %q masks no characters", pattern)
+	case leading > 0 && trailing > 0, strings.Contains(text, "#"):
+		return MaskPattern{}, fmt.Errorf("pattern %q may only reveal the start or the end of the value", pattern)
+	}
+
+	if leading > 0 {
+		return MaskPattern{Text: text, Shown: leading, Leading: true}, nil
+	}
+	return MaskPattern{Text: text, Shown: trailing}, nil
+}
+
+// HasWildcard returns true if the policy contains the wildcard permission "*".
+// Wildcards of a requirement tree only allow their own branch and are handled by Evaluate.
 func (sp *SecurityPolicy) HasWildcard() bool {
 	if sp == nil {
 		return false
 	}
-	for _, p := range sp.Permissions {
-		if p == "*" {
-			return true
+	return hasWildcard(sp.Permissions)
+}
+
+// Policy requiring both policies. The stricter onDeny applies, and the mask of policy on a tie.
+// Returns policy when outer is empty.
+func allOfPolicies(outer *SecurityPolicy, policy *SecurityPolicy) *SecurityPolicy {
+	if outer.IsEmpty() {
+		return policy
+	}
+
+	combined := *policy
+	combined.Name = ""
+	combined.Permissions = nil
+	combined.Requirement = &Requirement{AllOf: append(outer.requirements(), policy.requirements()...)}
+	if denyRank(outer.OnDeny) > denyRank(policy.OnDeny) {
+		combined.OnDeny, combined.Mask, combined.Pattern = outer.OnDeny, outer.Mask, outer.Pattern
+	}
+	return &combined
+}
+
+// Requirements of the policy as children of an allOf
+func (sp *SecurityPolicy) requirements() []*Requirement {
+	if sp.Requirement != nil {
+		if sp.Requirement.AllOf != nil {
+			return sp.Requirement.AllOf
 		}
+		return []*Requirement{sp.Requirement}
+	}
+	if sp.HasWildcard() {
+		return []*Requirement{{Permission: "*"}}
+	}
+	leaves := make([]*Requirement, 0, len(sp.Permissions))
+	for _, p := range sp.Permissions {
+		leaves = append(leaves, &Requirement{Permission: p})
+	}
+	return leaves
+}
+
+// Strictness of an onDeny behavior
+func denyRank(onDeny string) int {
+	switch onDeny {
+	case "error":
+		return 2
+	case "omit":
+		return 1
 	}
-	return false
+	return 0
 }
 
 // IsEmpty returns true if the policy has no permissions defined
 func (sp *SecurityPolicy) IsEmpty() bool {
-	return sp == nil || len(sp.Permissions) == 0
+	return sp == nil || (len(sp.Permissions) == 0 && sp.Requirement == nil)
 }
 
 // SecurityChecker is the interface for checking permissions at runtime.
@@ -39,6 +205,54 @@ type SecurityChecker interface {
 	Allow(required []string) (bool, error)
 }
 
+// Principal is the caller a query is built for.
+// Row filters read its attributes with $principal.<attribute>.
+type Principal interface {
+	// Attribute returns a string, bool, integer, float, nil or a slice of these
+	Attribute(name string) (any, bool)
+}
+
+// PrincipalMap is a Principal with fixed attributes
+type PrincipalMap map[string]any
+
+func (pm PrincipalMap) Attribute(name string) (any, bool) {
+	v, ok := pm[name]
+	return v, ok
+}
+
+// ContextChecker checks every permission set of a request in one call,
+// ex. one round trip to a remote authorisation service.
+type ContextChecker interface {
+	// AllowAll returns whether each permission set is granted, in the order of required.
+	// Returns error when the auth check itself fails.
+	AllowAll(ctx context.Context, required [][]string) ([]bool, error)
+}
+
+// AdaptChecker wraps a SecurityChecker as a ContextChecker.
+// Each permission set is checked with a separate Allow call.
+func AdaptChecker(checker SecurityChecker) ContextChecker {
+	return &checkerAdapter{checker: checker}
+}
+
+type checkerAdapter struct {
+	checker SecurityChecker
+}
+
+func (ca *checkerAdapter) AllowAll(ctx context.Context, required [][]string) ([]bool, error) {
+	allowed := make([]bool, len(required))
+	for i, perms := range required {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		ok, err := ca.checker.Allow(perms)
+		if err != nil {
+			return nil, err
+		}
+		allowed[i] = ok
+	}
+	return allowed, nil
+}
+
 // NormalizeSecurityValue converts string, array, or object security values
 // to a SecurityPolicy struct
 func NormalizeSecurityValue(value any) (*SecurityPolicy, error) {
@@ -70,7 +284,10 @@ func NormalizeSecurityValue(value any) (*SecurityPolicy, error) {
 		}, nil
 
 	case map[string]any:
-		// Object form: {permissions: [...], onDeny: "omit"}
+		if _, ok := v["policy"]; ok {
+			return nil, errors.New("policy references are only allowed on endpoints and fields of a service")
+		}
+		// Object form: {permissions: [...], onDeny: "omit"} or {anyOf: [...], onDeny: "omit"}
 		return parseSecurityObject(v)
 
 	default:
@@ -84,17 +301,32 @@ func parseSecurityObject(m map[string]any) (*SecurityPolicy, error) {
 		OnDeny: "error", // default
 	}
 
-	// Parse permissions (required)
-	permsAny, ok := m["permissions"]
-	if !ok {
-		return nil, errors.New("security object missing 'permissions' field")
+	// Parse permissions, anyOf or allOf (one required)
+	requirements := 0
+	if permsAny, ok := m["permissions"]; ok {
+		perms, err := parseSecurityList(permsAny)
+		if err != nil {
+			return nil, fmt.Errorf("security.permissions: %w", err)
+		}
+		policy.Permissions = perms
+		requirements++
 	}
-
-	perms, err := parseSecurityList(permsAny)
-	if err != nil {
-		return nil, fmt.Errorf("security.permissions: %w", err)
+	for _, key := range []string{"anyOf", "allOf"} {
+		if value, ok := m[key]; ok {
+			requirement, err := parseRequirement(map[string]any{key: value})
+			if err != nil {
+				return nil, fmt.Errorf("security: %w", err)
+			}
+			policy.Requirement = requirement
+			requirements++
+		}
+	}
+	if requirements == 0 {
+		return nil, errors.New("security object missing 'permissions', 'anyOf' or 'allOf' field")
+	}
+	if requirements > 1 {
+		return nil, errors.New("security object may only have one of 'permissions', 'anyOf' or 'allOf'")
 	}
-	policy.Permissions = perms
 
 	// Parse onDeny (optional)
 	if onDenyAny, ok := m["onDeny"]; ok {
@@ -102,14 +334,43 @@ func parseSecurityObject(m map[string]any) (*SecurityPolicy, error) {
 		if !ok {
 			return nil, fmt.Errorf("security.onDeny not string. got=%T", onDenyAny)
 		}
-		if onDeny != "error" && onDeny != "omit" {
-			return nil, fmt.Errorf("security.onDeny must be 'error' or 'omit'. got=%s", onDeny)
+		switch onDeny {
+		case "error", "omit", "mask", "partial":
+		default:
+			return nil, fmt.Errorf("security.onDeny must be 'error', 'omit', 'mask' or 'partial'. got=%s", onDeny)
 		}
 		policy.OnDeny = onDeny
 	}
 
+	if maskAny, ok := m["mask"]; ok {
+		mask, ok := maskAny.(string)
+		if !ok {
+			return nil, fmt.Errorf("security.mask not string. got=%T", maskAny)
+		}
+		if policy.OnDeny != "mask" {
+			return nil, fmt.Errorf("security.mask requires onDeny 'mask'. got=%s", policy.OnDeny)
+		}
+		policy.Mask = mask
+	}
+
+	if patternAny, ok := m["pattern"]; ok {
+		pattern, ok := patternAny.(string)
+		if !ok {
+			return nil, fmt.Errorf("security.pattern not string. got=%T", patternAny)
+		}
+		if policy.OnDeny != "partial" {
+			return nil, fmt.Errorf("security.pattern requires onDeny 'partial'. got=%s", policy.OnDeny)
+		}
+		if _, err := ParseMaskPattern(pattern); err != nil {
+			return nil, fmt.Errorf("security.pattern: %w", err)
+		}
+		policy.Pattern = pattern
+	} else if policy.OnDeny == "partial" {
+		return nil, errors.New("security.onDeny 'partial' requires a 'pattern'")
+	}
+
 	// Validate no unexpected keys
-	expectedKeys := []string{"permissions", "onDeny"}
+	expectedKeys := []string{"permissions", "anyOf", "allOf", "onDeny", "mask", "pattern"}
 	for key := range m {
 		found := false
 		for _, expected := range expectedKeys {
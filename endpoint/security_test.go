@@ -1,6 +1,7 @@
 package endpoint
 
 import (
+	"encoding/json"
 	"testing"
 )
 
@@ -92,6 +93,96 @@ func TestNormalizeSecurityValue_InvalidOnDeny(t *testing.T) {
 	}
 }
 
+func TestNormalizeSecurityValue_Masks(t *testing.T) {
+	tests := []struct {
+		input    map[string]any
+		expected SecurityPolicy
+	}{
+		{
+			map[string]any{"permissions": []any{"ssn.view"}, "onDeny": "mask"},
+			SecurityPolicy{Permissions: []string{"ssn.view"}, OnDeny: "mask"},
+		},
+		{
+			map[string]any{"permissions": []any{"ssn.view"}, "onDeny": "mask", "mask": "***"},
+			SecurityPolicy{Permissions: []string{"ssn.view"}, OnDeny: "mask", Mask: "***"},
+		},
+		{
+			map[string]any{"permissions": []any{"ssn.view"}, "onDeny": "partial", "pattern": "***-**-####"},
+			SecurityPolicy{Permissions: []string{"ssn.view"}, OnDeny: "partial", Pattern: "***-**-####"},
+		},
+	}
+
+	for _, tt := range tests {
+		policy, err := NormalizeSecurityValue(tt.input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if policy.OnDeny != tt.expected.OnDeny || policy.Mask != tt.expected.Mask || policy.Pattern != tt.expected.Pattern {
+			t.Errorf("wrong policy. expected=%+v, got=%+v", tt.expected, *policy)
+		}
+		if !policy.Masks() {
+			t.Errorf("expected %s policy to mask", policy.OnDeny)
+		}
+	}
+}
+
+func TestNormalizeSecurityValue_InvalidMasks(t *testing.T) {
+	tests := []map[string]any{
+		{"permissions": []any{"p"}, "onDeny": "partial"},
+		{"permissions": []any{"p"}, "onDeny": "partial", "pattern": "****"},
+		{"permissions": []any{"p"}, "onDeny": "partial", "pattern": "####"},
+		{"permissions": []any{"p"}, "onDeny": "partial", "pattern": "##**##"},
+		{"permissions": []any{"p"}, "onDeny": "partial", "pattern": "*#*##"},
+		{"permissions": []any{"p"}, "onDeny": "mask", "pattern": "**##"},
+		{"permissions": []any{"p"}, "onDeny": "omit", "mask": "***"},
+		{"permissions": []any{"p"}, "onDeny": "mask", "mask": 0},
+	}
+
+	for _, input := range tests {
+		if _, err := NormalizeSecurityValue(input); err == nil {
+			t.Errorf("expected error for %v", input)
+		}
+	}
+}
+
+func TestParseMaskPattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected MaskPattern
+	}{
+		{"***-**-####", MaskPattern{Text: "***-**-", Shown: 4}},
+		{"##******", MaskPattern{Text: "******", Shown: 2, Leading: true}},
+	}
+
+	for _, tt := range tests {
+		pattern, err := ParseMaskPattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if pattern != tt.expected {
+			t.Errorf("wrong pattern for %s. expected=%+v, got=%+v", tt.pattern, tt.expected, pattern)
+		}
+	}
+}
+
+func TestSecurityPolicy_JSON(t *testing.T) {
+	tests := []struct {
+		policy   SecurityPolicy
+		expected string
+	}{
+		{SecurityPolicy{Permissions: []string{"a", "b"}, OnDeny: "error"}, `["a", "b"]`},
+		{SecurityPolicy{Permissions: []string{"a"}, OnDeny: "omit"}, `{"permissions": ["a"], "onDeny": "omit"}`},
+		{SecurityPolicy{Permissions: []string{"a"}, OnDeny: "mask", Mask: "n/a"}, `{"permissions": ["a"], "onDeny": "mask", "mask": "n/a"}`},
+		{SecurityPolicy{Permissions: []string{"a"}, OnDeny: "partial", Pattern: "***-####"}, `{"permissions": ["a"], "onDeny": "partial", "pattern": "***-####"}`},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.JSON(); got != tt.expected {
+			t.Errorf("wrong json. expected=%s, got=%s", tt.expected, got)
+		}
+	}
+}
+
 func TestNormalizeSecurityValue_MissingPermissions(t *testing.T) {
 	input := map[string]any{
 		"onDeny": "error",
@@ -200,3 +291,175 @@ func TestPermissiveChecker(t *testing.T) {
 		t.Error("PermissiveChecker should allow all permissions")
 	}
 }
+
+func TestNormalizeSecurityValue_Requirements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		json     string
+	}{
+		{
+			`{"anyOf": ["billing:read", {"allOf": ["admin", "phi:read"]}]}`,
+			"anyOf(billing:read, allOf(admin, phi:read))",
+			`{"anyOf": ["billing:read", {"allOf": ["admin", "phi:read"]}]}`,
+		},
+		{
+			`{"allOf": ["a", {"anyOf": ["b", "c"]}], "onDeny": "omit"}`,
+			"allOf(a, anyOf(b, c))",
+			`{"allOf": ["a", {"anyOf": ["b", "c"]}], "onDeny": "omit"}`,
+		},
+		{
+			`{"anyOf": [" a ", "b"], "onDeny": "mask", "mask": "n/a"}`,
+			"anyOf(a, b)",
+			`{"anyOf": ["a", "b"], "onDeny": "mask", "mask": "n/a"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		var value any
+		if err := json.Unmarshal([]byte(tt.input), &value); err != nil {
+			t.Fatalf("invalid test json: %v", err)
+		}
+		policy, err := NormalizeSecurityValue(value)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if policy.String() != tt.expected {
+			t.Errorf("wrong requirement. expected=%s, got=%s", tt.expected, policy.String())
+		}
+		if policy.JSON() != tt.json {
+			t.Errorf("wrong json. expected=%s, got=%s", tt.json, policy.JSON())
+		}
+
+		// JSON output parses back into the same policy
+		if err := json.Unmarshal([]byte(policy.JSON()), &value); err != nil {
+			t.Fatalf("invalid policy json %s: %v", policy.JSON(), err)
+		}
+		reparsed, err := NormalizeSecurityValue(value)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if reparsed.JSON() != policy.JSON() {
+			t.Errorf("json not round tripped. expected=%s, got=%s", policy.JSON(), reparsed.JSON())
+		}
+	}
+}
+
+func TestNormalizeSecurityValue_InvalidRequirements(t *testing.T) {
+	tests := []string{
+		`{"anyOf": []}`,
+		`{"anyOf": "a"}`,
+		`{"anyOf": ["a", ""]}`,
+		`{"anyOf": ["a", 1]}`,
+		`{"anyOf": [{"oneOf": ["a"]}]}`,
+		`{"anyOf": [{"anyOf": ["a"], "allOf": ["b"]}]}`,
+		`{"anyOf": ["a"], "permissions": ["b"]}`,
+		`{"anyOf": ["a"], "allOf": ["b"]}`,
+	}
+
+	for _, input := range tests {
+		var value any
+		if err := json.Unmarshal([]byte(input), &value); err != nil {
+			t.Fatalf("invalid test json: %v", err)
+		}
+		if _, err := NormalizeSecurityValue(value); err == nil {
+			t.Errorf("expected error for %s", input)
+		}
+	}
+}
+
+func TestSecurityPolicy_Evaluate(t *testing.T) {
+	policy := &SecurityPolicy{
+		OnDeny: "error",
+		Requirement: &Requirement{AnyOf: []*Requirement{
+			{Permission: "billing:read"},
+			{AllOf: []*Requirement{{Permission: "admin"}, {Permission: "phi:read"}}},
+		}},
+	}
+
+	grants := func(perms ...string) map[string]struct{} {
+		m := map[string]struct{}{}
+		for _, p := range perms {
+			m[p] = struct{}{}
+		}
+		return m
+	}
+
+	tests := []struct {
+		name    string
+		grants  map[string]struct{}
+		allowed bool
+	}{
+		{"first branch", grants("billing:read"), true},
+		{"second branch", grants("admin", "phi:read"), true},
+		{"partial second branch", grants("admin"), false},
+		{"none", grants(), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			static := NewStaticChecker(tt.grants)
+			role := NewRoleChecker(static.Allow)
+			for _, checker := range []SecurityChecker{static, role} {
+				allowed, err := policy.Allow(checker)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if allowed != tt.allowed {
+					t.Errorf("%T: expected allowed=%t, got=%t", checker, tt.allowed, allowed)
+				}
+			}
+		})
+	}
+
+	allowed, err := policy.Allow(NewPermissiveChecker())
+	if err != nil || !allowed {
+		t.Errorf("expected permissive checker to allow. got=%t, %v", allowed, err)
+	}
+
+	expected := [][]string{{"billing:read"}, {"admin", "phi:read"}}
+	sets := policy.Sets()
+	if len(sets) != len(expected) {
+		t.Fatalf("wrong sets. expected=%v, got=%v", expected, sets)
+	}
+	for i := range expected {
+		if permissionSet(sets[i]) != permissionSet(expected[i]) {
+			t.Errorf("wrong set %d. expected=%v, got=%v", i, expected[i], sets[i])
+		}
+	}
+
+	wildcard := &SecurityPolicy{Requirement: &Requirement{AnyOf: []*Requirement{{Permission: "*"}, {Permission: "a"}}}}
+	allowed, err = wildcard.Allow(NewStaticChecker(grants()))
+	if err != nil || !allowed {
+		t.Errorf("expected wildcard branch to allow. got=%t, %v", allowed, err)
+	}
+
+	// A wildcard inside allOf only satisfies itself
+	for _, tree := range []*Requirement{
+		{AllOf: []*Requirement{{Permission: "*"}, {Permission: "phi:read"}}},
+		{AllOf: []*Requirement{{Permission: "*"}, {AnyOf: []*Requirement{{Permission: "phi:read"}}}}},
+	} {
+		policy := &SecurityPolicy{Requirement: tree}
+		allowed, err = policy.Allow(NewStaticChecker(grants()))
+		if err != nil || allowed {
+			t.Errorf("%s: expected to be denied without phi:read. got=%t, %v", tree, allowed, err)
+		}
+		allowed, err = policy.Allow(NewStaticChecker(grants("phi:read")))
+		if err != nil || !allowed {
+			t.Errorf("%s: expected to be allowed with phi:read. got=%t, %v", tree, allowed, err)
+		}
+		if sets := policy.Sets(); len(sets) != 1 || permissionSet(sets[0]) != `["phi:read"]` {
+			t.Errorf("%s: expected the set [phi:read]. got=%v", tree, sets)
+		}
+	}
+
+	allWildcards := &SecurityPolicy{Requirement: &Requirement{AllOf: []*Requirement{{Permission: "*"}, {Permission: "*"}}}}
+	if allowed, err = allWildcards.Allow(NewStaticChecker(grants())); err != nil || !allowed || allWildcards.Sets() != nil {
+		t.Errorf("expected an allOf of wildcards to allow without sets. got=%t, %v, %v", allowed, err, allWildcards.Sets())
+	}
+}
+
+func permissionSet(perms []string) string {
+	b, _ := json.Marshal(perms)
+	return string(b)
+}
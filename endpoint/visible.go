@@ -0,0 +1,227 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Team-Solutions-Dental/dyre/object/objectType"
+)
+
+// Access of a field for a principal
+const (
+	FieldVisible = "visible"
+	FieldMasked  = "masked"
+	FieldOmitted = "omitted"
+	FieldDenied  = "denied" // Selecting the field errors
+)
+
+// Service as seen by one principal. Endpoints the principal is denied are left out.
+type VisibleService struct {
+	Endpoints     map[string]*VisibleEndpoint
+	EndpointNames []string
+}
+
+type VisibleEndpoint struct {
+	Name      string
+	Fields    []VisibleField
+	JoinNames []string // Joins to visible endpoints
+	endpoint  *Endpoint
+}
+
+type VisibleField struct {
+	Name string
+	// Type of the returned value. Placeholders and partial masks are strings
+	Type     objectType.Type
+	Nullable bool
+	Access   string
+	// Classification of the field. Ex. "phi"
+	Classification string
+}
+
+// Visible and masked fields are returned when selected
+func (vf *VisibleField) Selectable() bool {
+	return vf.Access == FieldVisible || vf.Access == FieldMasked
+}
+
+func (vf *VisibleField) TS() string {
+	field := Field{Name: vf.Name, FieldType: vf.Type, Nullable: vf.Nullable}
+	return field.TS()
+}
+
+// Names of the fields the principal can select
+func (ve *VisibleEndpoint) FieldNames() []string {
+	var names []string
+	for _, f := range ve.Fields {
+		if f.Selectable() {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// TypeScript interface of the selectable fields and visible joins
+func (ve *VisibleEndpoint) TS() string {
+	var out bytes.Buffer
+	out.WriteString("interface " + ve.Name + " { ")
+	for _, f := range ve.Fields {
+		if !f.Selectable() {
+			continue
+		}
+		out.WriteString("\n  ")
+		out.WriteString(f.TS())
+	}
+	for _, j := range ve.JoinNames {
+		join := ve.endpoint.Joins[j]
+		out.WriteString("\n  ")
+		out.WriteString(join.TS())
+	}
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+func (vs *VisibleService) TS() string {
+	interfaces := make([]string, 0, len(vs.EndpointNames))
+	for _, name := range vs.EndpointNames {
+		interfaces = append(interfaces, vs.Endpoints[name].TS())
+	}
+	return strings.Join(interfaces, "\n\n")
+}
+
+// Service filtered to what the principal of the checker may access.
+// A nil checker allows every policy like a query without a checker.
+func (s *Service) VisibleTo(checker SecurityChecker) (*VisibleService, error) {
+	if checker == nil {
+		return s.visible(nil)
+	}
+	return s.visible(checker.Allow)
+}
+
+// VisibleTo with every permission set of the service checked in one AllowAll call
+func (s *Service) VisibleToContext(ctx context.Context, checker ContextChecker) (*VisibleService, error) {
+	if checker == nil {
+		return s.visible(nil)
+	}
+
+	var required [][]string
+	index := map[string]int{}
+	add := func(policy *SecurityPolicy) {
+		for _, perms := range policy.Sets() {
+			key := strings.Join(perms, "\x00")
+			if _, ok := index[key]; !ok {
+				index[key] = len(required)
+				required = append(required, perms)
+			}
+		}
+	}
+	for _, name := range s.EndpointNames {
+		ep := s.Endpoints[name]
+		add(ep.Security)
+		for _, policy := range ep.Operations.Policies() {
+			add(policy)
+		}
+		for _, f := range ep.FieldNames {
+			field := ep.Fields[f]
+			add(ep.FieldPolicy(&field))
+		}
+	}
+
+	allowed := []bool{}
+	if len(required) > 0 {
+		var err error
+		allowed, err = checker.AllowAll(ctx, required)
+		if err != nil {
+			return nil, err
+		}
+		if len(allowed) != len(required) {
+			return nil, fmt.Errorf("checker returned %d results for %d permission sets", len(allowed), len(required))
+		}
+	}
+
+	return s.visible(func(perms []string) (bool, error) {
+		i, ok := index[strings.Join(perms, "\x00")]
+		if !ok {
+			return false, fmt.Errorf("permission set %v was not checked", perms)
+		}
+		return allowed[i], nil
+	})
+}
+
+// Nil allow skips permission checks
+func (s *Service) visible(allow func(required []string) (bool, error)) (*VisibleService, error) {
+	denied := func(policy *SecurityPolicy) (bool, error) {
+		if allow == nil || policy.IsEmpty() {
+			return false, nil
+		}
+		allowed, err := policy.Evaluate(allow)
+		return !allowed, err
+	}
+
+	vs := &VisibleService{Endpoints: map[string]*VisibleEndpoint{}}
+	for _, name := range s.EndpointNames {
+		ep := s.Endpoints[name]
+
+		// Endpoints with a masking policy are queried with their fields masked
+		deny, err := denied(ep.Security)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %s: %w", ep.Name, err)
+		}
+		if deny && !ep.Security.Masks() {
+			continue
+		}
+
+		ve := &VisibleEndpoint{Name: ep.Name, endpoint: ep}
+		for _, f := range ep.FieldNames {
+			field := ep.Fields[f]
+			vf := VisibleField{Name: field.Name, Type: field.FieldType, Nullable: field.Nullable, Access: FieldVisible, Classification: field.Classification}
+
+			policy := ep.FieldPolicy(&field)
+			deny, err := denied(policy)
+			if err != nil {
+				return nil, fmt.Errorf("field %s.%s: %w", ep.Name, field.Name, err)
+			}
+
+			switch {
+			case policy == nil && s.Settings.DenyByDefault:
+				vf.Access = FieldDenied
+			case !deny:
+			case policy.OnDeny == "omit":
+				vf.Access = FieldOmitted
+			case policy.OnDeny == "partial":
+				vf.Access, vf.Type = FieldMasked, objectType.STRING
+			case policy.OnDeny == "mask" && policy.Mask != "":
+				vf.Access, vf.Type, vf.Nullable = FieldMasked, objectType.STRING, false
+			case policy.OnDeny == "mask":
+				vf.Access, vf.Nullable = FieldMasked, true
+			default:
+				vf.Access = FieldDenied
+			}
+			ve.Fields = append(ve.Fields, vf)
+		}
+
+		vs.Endpoints[ep.Name] = ve
+		vs.EndpointNames = append(vs.EndpointNames, ep.Name)
+	}
+
+	for _, ve := range vs.Endpoints {
+		for _, j := range ve.endpoint.JoinNames {
+			join := ve.endpoint.Joins[j]
+			child := join.ChildEndpoint()
+			if child == nil || vs.Endpoints[child.Name] == nil {
+				continue
+			}
+			// Joins denied by an operation policy are refused or omitted
+			deny, err := denied(ve.endpoint.JoinPolicy(j, child.Name))
+			if err != nil {
+				return nil, fmt.Errorf("join %s.%s: %w", ve.Name, j, err)
+			}
+			if !deny {
+				ve.JoinNames = append(ve.JoinNames, j)
+			}
+		}
+	}
+
+	return vs, nil
+}
@@ -0,0 +1,171 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Team-Solutions-Dental/dyre/object/objectType"
+)
+
+func testNewVisibleService(t *testing.T) *Service {
+	service, err := ParseJSON([]byte(`
+[
+  {
+    "name": "Patients",
+    "tableName": "Patients",
+    "joins": [{ "endpoint": "Invoices", "on": "PatientID" }, { "endpoint": "Notes", "on": "PatientID" }],
+    "fields": [
+      "PatientID",
+      {"name": "SSN", "security": {"permissions": ["phi:read"], "onDeny": "partial", "pattern": "***-**-####"}},
+      {"name": "Phone", "security": {"permissions": ["phi:read"], "onDeny": "mask", "mask": "hidden"}},
+      {"name": "Balance", "type": "float", "security": {"permissions": ["billing:read"], "onDeny": "mask"}},
+      {"name": "Email", "security": {"permissions": ["contact:read"], "onDeny": "omit"}},
+      {"name": "Diagnosis", "security": {"anyOf": ["doctor", "phi:read"]}}
+    ]
+  },
+  {
+    "name": "Invoices",
+    "tableName": "Invoices",
+    "security": "billing:read",
+    "fields": ["PatientID", {"name": "Amount", "type": "float"}]
+  },
+  {
+    "name": "Notes",
+    "tableName": "Notes",
+    "fields": ["PatientID", "Text"]
+  }
+]`))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	return service
+}
+
+func TestVisibleTo(t *testing.T) {
+	service := testNewVisibleService(t)
+
+	vs, err := service.VisibleTo(NewStaticChecker(map[string]struct{}{"doctor": {}}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(vs.EndpointNames) != 2 || vs.Endpoints["Invoices"] != nil {
+		t.Fatalf("expected Invoices to be left out. got=%v", vs.EndpointNames)
+	}
+
+	patients := vs.Endpoints["Patients"]
+	expected := []VisibleField{
+		{Name: "PatientID", Type: objectType.STRING, Nullable: true, Access: FieldVisible},
+		{Name: "SSN", Type: objectType.STRING, Nullable: true, Access: FieldMasked},
+		{Name: "Phone", Type: objectType.STRING, Access: FieldMasked},
+		{Name: "Balance", Type: objectType.FLOAT, Nullable: true, Access: FieldMasked},
+		{Name: "Email", Type: objectType.STRING, Nullable: true, Access: FieldOmitted},
+		{Name: "Diagnosis", Type: objectType.STRING, Nullable: true, Access: FieldVisible},
+	}
+	if len(patients.Fields) != len(expected) {
+		t.Fatalf("wrong fields. expected=%v, got=%v", expected, patients.Fields)
+	}
+	for i := range expected {
+		if patients.Fields[i] != expected[i] {
+			t.Errorf("wrong field %d. expected=%+v, got=%+v", i, expected[i], patients.Fields[i])
+		}
+	}
+
+	if len(patients.JoinNames) != 1 || patients.JoinNames[0] != "Notes" {
+		t.Errorf("expected only the Notes join. got=%v", patients.JoinNames)
+	}
+
+	ts := "interface Patients { \n  PatientID?: string;\n  SSN?: string;\n  Phone: string;\n  Balance?: number;\n  Diagnosis?: string;\n  Notes?: Notes[];\n}"
+	if patients.TS() != ts {
+		t.Errorf("wrong TypeScript.\nexpected=%s\ngot=     %s", ts, patients.TS())
+	}
+}
+
+func TestVisibleTo_Denied(t *testing.T) {
+	service := testNewVisibleService(t)
+	service.Settings.DenyByDefault = true
+
+	vs, err := service.VisibleTo(NewStaticChecker(map[string]struct{}{"billing:read": {}}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	access := map[string]string{}
+	for _, f := range vs.Endpoints["Patients"].Fields {
+		access[f.Name] = f.Access
+	}
+	expected := map[string]string{
+		"PatientID": FieldDenied,
+		"SSN":       FieldMasked,
+		"Phone":     FieldMasked,
+		"Balance":   FieldVisible,
+		"Email":     FieldOmitted,
+		"Diagnosis": FieldDenied,
+	}
+	for name, want := range expected {
+		if access[name] != want {
+			t.Errorf("wrong access of %s. expected=%s, got=%s", name, want, access[name])
+		}
+	}
+
+	// Invoices fields inherit the endpoint policy
+	if names := vs.Endpoints["Invoices"].FieldNames(); len(names) != 2 {
+		t.Errorf("expected Invoices fields to be visible. got=%v", names)
+	}
+	if names := vs.Endpoints["Notes"].FieldNames(); len(names) != 0 {
+		t.Errorf("expected unannotated Notes fields to be denied. got=%v", names)
+	}
+}
+
+type countingChecker struct {
+	grants map[string]bool
+	calls  int
+}
+
+func (cc *countingChecker) AllowAll(ctx context.Context, required [][]string) ([]bool, error) {
+	cc.calls++
+	allowed := make([]bool, len(required))
+	for i, perms := range required {
+		allowed[i] = true
+		for _, p := range perms {
+			allowed[i] = allowed[i] && cc.grants[p]
+		}
+	}
+	return allowed, nil
+}
+
+func TestVisibleToContext(t *testing.T) {
+	service := testNewVisibleService(t)
+	checker := &countingChecker{grants: map[string]bool{"phi:read": true, "billing:read": true}}
+
+	vs, err := service.VisibleToContext(context.Background(), checker)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if checker.calls != 1 {
+		t.Errorf("expected 1 AllowAll call. got=%d", checker.calls)
+	}
+
+	names := vs.Endpoints["Patients"].FieldNames()
+	expected := []string{"PatientID", "SSN", "Phone", "Balance", "Diagnosis"}
+	if len(names) != len(expected) {
+		t.Fatalf("wrong field names. expected=%v, got=%v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("wrong field name %d. expected=%s, got=%s", i, expected[i], names[i])
+		}
+	}
+	if len(vs.Endpoints["Patients"].JoinNames) != 2 {
+		t.Errorf("expected both joins. got=%v", vs.Endpoints["Patients"].JoinNames)
+	}
+
+	// No checker shows the full schema like a query without a checker
+	vs, err = service.VisibleToContext(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(vs.EndpointNames) != 3 || len(vs.Endpoints["Patients"].FieldNames()) != 6 {
+		t.Errorf("expected every endpoint and field. got=%v", vs.Endpoints["Patients"].FieldNames())
+	}
+}
@@ -95,6 +95,10 @@ func (l *Lexer) NextToken() token.Token {
 		}
 	case '@':
 		tok = newToken(token.REFERENCE, l.ch)
+	case '$':
+		tok.Type = token.VARIABLE
+		tok.Literal = l.readVariable()
+		return tok
 	case '\'':
 		tok.Type = token.STRING
 		tok.Literal = l.readString()
@@ -123,6 +127,17 @@ func newToken(tokenType token.TokenType, ch byte) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
+// $ followed by a dotted path. Ex. $principal.clinics
+func (l *Lexer) readVariable() string {
+	position := l.position
+	l.readChar()
+
+	for isLetter(l.ch) || isDigit(l.ch) || l.ch == '.' {
+		l.readChar()
+	}
+	return l.input[position:l.position]
+}
+
 // Make sure first letter is alpha. Following can include digits
 func (l *Lexer) readIdentifier() string {
 	position := l.position
@@ -45,6 +45,34 @@ func TestNextToken(t *testing.T) {
 	}
 }
 
+func TestPrincipalToken(t *testing.T) {
+	input := `@('ClinicID') IN $principal.clinics;`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.REFERENCE, "@"},
+		{token.LPAREN, "("},
+		{token.STRING, "ClinicID"},
+		{token.RPAREN, ")"},
+		{token.IN, "IN"},
+		{token.VARIABLE, "$principal.clinics"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("test[%d] - expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
 // func TestNextToken(t *testing.T) {
 //
 // 	input := `=+(){},;`
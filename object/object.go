@@ -2,8 +2,10 @@ package object
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/Team-Solutions-Dental/dyre/object/objectType"
+	"github.com/Team-Solutions-Dental/dyre/sql/sqlExpr"
 )
 
 type Object interface {
@@ -14,13 +16,26 @@ type Object interface {
 
 type Expression struct {
 	ExpressionType objectType.Type
-	Value          string
+	Node           sqlExpr.Node
 	HasNull        bool
 }
 
 func (e *Expression) Type() objectType.Type { return e.ExpressionType }
 func (e *Expression) Nullable() bool        { return e.HasNull }
-func (e *Expression) String() string        { return e.Value }
+func (e *Expression) String() string {
+	if e.Node == nil {
+		return ""
+	}
+	return e.Node.String()
+}
+
+// SQL expression node of an object. Literal objects are rendered as literals.
+func NodeOf(obj Object) sqlExpr.Node {
+	if e, ok := obj.(*Expression); ok {
+		return e.Node
+	}
+	return &sqlExpr.Literal{Value: obj.String()}
+}
 
 type Integer struct {
 	Value int64
@@ -73,6 +88,21 @@ func (s *String) Type() objectType.Type { return objectType.STRING }
 func (s *String) Nullable() bool        { return false }
 func (s *String) String() string        { return fmt.Sprintf("'%s'", s.Value) }
 
+// List of literals. Ex. the right side of IN
+type List struct {
+	Elements []Object
+}
+
+func (l *List) Type() objectType.Type { return objectType.LIST }
+func (l *List) Nullable() bool        { return false }
+func (l *List) String() string {
+	elements := make([]string, len(l.Elements))
+	for i, e := range l.Elements {
+		elements[i] = e.String()
+	}
+	return "(" + strings.Join(elements, ", ") + ")"
+}
+
 type BuiltinFunction func(args ...Object) Object
 
 type Builtin struct {
@@ -3,6 +3,7 @@ package objectRef
 import (
 	"fmt"
 	"maps"
+	"slices"
 )
 
 const (
@@ -67,6 +68,11 @@ func (lr *LocalReferences) List() []string {
 	return list
 }
 
+// Sorted ids of all references
+func (lr *LocalReferences) IDs() []string {
+	return slices.Sorted(maps.Keys(lr.store))
+}
+
 func (lr *LocalReferences) Append(subRef *LocalReferences) {
 	maps.Copy(lr.store, subRef.store)
 }
@@ -12,6 +12,7 @@ const (
 	NULL       = "NULL"
 	ERROR      = "ERROR"
 	BUILTIN    = "BUILTIN"
+	LIST       = "LIST"
 )
 
 type Type string
@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/Team-Solutions-Dental/dyre/ast"
 	"github.com/Team-Solutions-Dental/dyre/lexer"
@@ -26,6 +27,7 @@ var precedences = map[token.TokenType]int{
 	token.OR:       CONDITION,
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
+	token.IN:       EQUALS,
 	token.LT:       LESSGREATER,
 	token.LTE:      LESSGREATER,
 	token.GT:       LESSGREATER,
@@ -75,6 +77,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.GT, p.parseColumnPrefixExpression)
 	p.registerPrefix(token.GTE, p.parseColumnPrefixExpression)
 	p.registerPrefix(token.REFERENCE, p.parseReference)
+	p.registerPrefix(token.VARIABLE, p.parseVariable)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.ASC, p.parseOrderExpression)
 	p.registerPrefix(token.DESC, p.parseOrderExpression)
@@ -92,6 +95,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.GTE, p.parseInfixExpression)
 	p.registerInfix(token.AND, p.parseInfixExpression)
 	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.IN, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 
 	return p
@@ -394,6 +398,22 @@ func (p *Parser) parseReference() ast.Expression {
 
 }
 
+// parse $principal.attribute or $param.name
+func (p *Parser) parseVariable() ast.Expression {
+	if name, ok := strings.CutPrefix(p.curToken.Literal, "$param."); ok && name != "" && !strings.Contains(name, ".") {
+		return &ast.Parameter{Token: p.curToken, Name: name}
+	}
+
+	name, ok := strings.CutPrefix(p.curToken.Literal, "$principal.")
+	if !ok || name == "" || strings.Contains(name, ".") {
+		msg := fmt.Sprintf("expected $principal.<attribute> or $param.<name>. got=%s", p.curToken.Literal)
+		p.parserErrors = append(p.parserErrors, msg)
+		return nil
+	}
+
+	return &ast.PrincipalAttribute{Token: p.curToken, Name: name}
+}
+
 // Casts a prefix expression as an infix expression assuming a column is being referenced
 // Col: != NULL -> Col: @ != NULL
 func (p *Parser) parseColumnPrefixExpression() ast.Expression {
@@ -629,3 +629,58 @@ func TestGroupFunction(t *testing.T) {
 	}
 
 }
+
+func TestParameter(t *testing.T) {
+	p := New(lexer.New(`@('Created') > $param.since`))
+	query := p.ParseQuery()
+	checkParserErrors(t, p)
+
+	stmt := query.Statements[0].(*ast.ExpressionStatement)
+	gt, ok := stmt.Expression.(*ast.InfixExpression)
+	if !ok || gt.Operator != ">" {
+		t.Fatalf("exp not > *ast.InfixExpression. got=%T", stmt.Expression)
+	}
+	param, ok := gt.Right.(*ast.Parameter)
+	if !ok || param.Name != "since" {
+		t.Fatalf("exp not *ast.Parameter since. got=%#v", gt.Right)
+	}
+
+	for _, invalid := range []string{`$user.since`, `$param.`, `$param.a.b`} {
+		p := New(lexer.New(invalid))
+		p.ParseQuery()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser error for %s", invalid)
+		}
+	}
+}
+
+func TestPrincipalAttribute(t *testing.T) {
+	input := `@('ClinicID') IN $principal.clinics`
+
+	l := lexer.New(input)
+	p := New(l)
+	query := p.ParseQuery()
+	checkParserErrors(t, p)
+
+	stmt := query.Statements[0].(*ast.ExpressionStatement)
+	in, ok := stmt.Expression.(*ast.InfixExpression)
+	if !ok || in.Operator != "IN" {
+		t.Fatalf("exp not IN *ast.InfixExpression. got=%T", stmt.Expression)
+	}
+
+	attr, ok := in.Right.(*ast.PrincipalAttribute)
+	if !ok {
+		t.Fatalf("exp not *ast.PrincipalAttribute. got=%T", in.Right)
+	}
+	if attr.Name != "clinics" {
+		t.Errorf("attribute not %q. got=%q", "clinics", attr.Name)
+	}
+
+	for _, invalid := range []string{`$user.clinics`, `$principal.`, `$principal.a.b`} {
+		p := New(lexer.New(invalid))
+		p.ParseQuery()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser error for %s", invalid)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Team-Solutions-Dental/dyre/sql/sqlExpr"
+)
+
+// Named query rendered in the WITH clause of the top level query.
+// Sub queries cannot hold a WITH clause, so every CTE of the query tree is hoisted.
+type CTE struct {
+	Name    string
+	Columns []string
+	Query   sqlExpr.Statement
+}
+
+func (c *CTE) Statement() string {
+	if len(c.Columns) == 0 {
+		return fmt.Sprintf("%s AS ( %s )", c.Name, c.Query.String())
+	}
+	var columns []string
+	for _, col := range c.Columns {
+		columns = append(columns, fmt.Sprintf("[%s]", col))
+	}
+	return fmt.Sprintf("%s (%s) AS ( %s )", c.Name, strings.Join(columns, ", "), c.Query.String())
+}
+
+// CTEs of the query and every joined query.
+// CTEs are named by their content so a repeated name is only rendered once.
+func (q *Query) AllCTEs() []*CTE {
+	var ctes []*CTE
+	seen := map[string]bool{}
+	add := func(c *CTE) {
+		if seen[c.Name] {
+			return
+		}
+		seen[c.Name] = true
+		ctes = append(ctes, c)
+	}
+
+	for _, c := range q.CTEs {
+		add(c)
+	}
+	for _, j := range q.JoinStatements {
+		for _, c := range j.Child_Query.AllCTEs() {
+			add(c)
+		}
+	}
+
+	return ctes
+}
+
+func withConstructor(ctes []*CTE) string {
+	if len(ctes) == 0 {
+		return ""
+	}
+
+	var statements []string
+	for _, c := range ctes {
+		statements = append(statements, c.Statement())
+	}
+	return "WITH " + strings.Join(statements, ", ") + " "
+}
+
+// Collects the stages of a query rendered in CTE mode
+type cteRenderer struct {
+	ctes  []*CTE
+	names map[string]bool
+}
+
+// Add a stage named after its alias and return the unique CTE name.
+// Ex. Invoices_cte, Invoices_cte2
+func (r *cteRenderer) add(alias string, query string) string {
+	name := alias + "_cte"
+	for i := 2; r.names[name]; i++ {
+		name = fmt.Sprintf("%s_cte%d", alias, i)
+	}
+	r.names[name] = true
+	r.ctes = append(r.ctes, &CTE{Name: name, Query: renderedStatement(query)})
+	return name
+}
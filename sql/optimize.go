@@ -0,0 +1,91 @@
+package sql
+
+import (
+	"fmt"
+
+	"github.com/Team-Solutions-Dental/dyre/object"
+	"github.com/Team-Solutions-Dental/dyre/sql/sqlExpr"
+)
+
+// Rewrite the query tree into simpler equivalent SQL.
+// Plain projection join children are joined as base tables,
+// and filters on aliased columns are inlined so the alias wrapper is removed.
+func (q *Query) Optimize() {
+	for _, j := range q.JoinStatements {
+		j.Child_Query.Optimize()
+		if !j.IsApply() && j.Child_Query.plainProjection() {
+			j.Flattened = true
+		}
+	}
+
+	q.inlineAliasWhere()
+}
+
+// Query only selects columns of its table, so joining the table directly is equivalent
+func (q *Query) plainProjection() bool {
+	if len(q.WhereStatements) > 0 || len(q.AliasWhereStatements) > 0 || len(q.JoinStatements) > 0 ||
+		len(q.GroupByStatements) > 0 || len(q.HavingStatements) > 0 || len(q.OrderBy) > 0 || len(q.CTEs) > 0 {
+		return false
+	}
+
+	if q.Limit != nil && *q.Limit > 0 {
+		return false
+	}
+
+	for _, ss := range q.SelectStatements {
+		sf, ok := ss.(*SelectField)
+		if !ok || *sf.TableName != q.TableName {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Replace references to the alias stage with the expression they select
+// and move the filters into the table query.
+func (q *Query) inlineAliasWhere() {
+	if len(q.AliasWhereStatements) == 0 || !q.BracketedColumns {
+		return
+	}
+
+	selected := map[string]sqlExpr.Node{}
+	for _, ss := range q.SelectStatements {
+		switch ss := ss.(type) {
+		case *SelectField:
+			selected[ss.Name()] = &sqlExpr.Column{Table: *ss.TableName, Name: *ss.FieldName}
+		case *SelectExpression:
+			selected[ss.Name()] = &sqlExpr.Paren{Inner: object.NodeOf(ss.Expression)}
+		default:
+			return
+		}
+	}
+
+	var inlined []sqlExpr.Node
+	for _, stmnt := range q.AliasWhereStatements {
+		missing := false
+		out := sqlExpr.Transform(stmnt, func(n sqlExpr.Node) sqlExpr.Node {
+			col, ok := n.(*sqlExpr.Column)
+			if !ok || col.Table != q.TableAlias {
+				return n
+			}
+			expr, ok := selected[col.Name]
+			if !ok {
+				missing = true
+				return n
+			}
+			return expr
+		})
+		if missing {
+			return
+		}
+		inlined = append(inlined, out)
+	}
+
+	q.WhereStatements = append(q.WhereStatements, inlined...)
+	q.AliasWhereStatements = nil
+}
+
+func (js *JoinStatement) flattenedJoin() string {
+	return fmt.Sprintf(" %s JOIN %s AS %s ON %s", *js.JoinType, js.Child_Query.From, *js.Alias, js.onConstructor())
+}
@@ -7,43 +7,66 @@ import (
 	"github.com/Team-Solutions-Dental/dyre/object"
 	"github.com/Team-Solutions-Dental/dyre/object/objectRef"
 	"github.com/Team-Solutions-Dental/dyre/object/objectType"
+	"github.com/Team-Solutions-Dental/dyre/sql/sqlExpr"
 )
 
 type Query struct {
 	SelectStatements     []SelectStatement
-	AliasWhereStatements []string
+	AliasWhereStatements []sqlExpr.Node
 	TableAlias           string
 	Limit                *int
 	From                 string
 	TableName            string
-	WhereStatements      []string
+	WhereStatements      []sqlExpr.Node
 	JoinStatements       []*JoinStatement
-	GroupByStatements    []string
-	HavingStatements     []string
+	GroupByStatements    []sqlExpr.Node
+	HavingStatements     []sqlExpr.Node
 	OrderBy              []*OrderByStatement
 	RefLevel             int
 	BracketedColumns     bool
+	CTEs                 []*CTE
+	// Render joined queries and alias stages as CTEs instead of nested sub queries
+	CTEMode bool
 }
 
+// Top level query with the CTEs of the whole query tree
 func (q *Query) ConstructQuery() string {
+	if q.CTEMode {
+		r := &cteRenderer{ctes: q.AllCTEs(), names: map[string]bool{}}
+		for _, c := range r.ctes {
+			r.names[c.Name] = true
+		}
+		query := q.render(r)
+		return withConstructor(r.ctes) + query
+	}
+	return withConstructor(q.AllCTEs()) + q.statement()
+}
+
+// Query without a WITH clause, used when nesting as a sub query
+func (q *Query) statement() string {
+	return q.render(nil)
+}
+
+// Render the query. Stages are nested sub queries when r is nil.
+func (q *Query) render(r *cteRenderer) string {
 	switch q.RefLevel {
 	case objectRef.LITERAL:
-		return q.tableQuery()
+		return q.tableQuery(r)
 	case objectRef.FIELD:
-		return q.tableQuery()
+		return q.tableQuery(r)
 	case objectRef.EXPRESSION:
 		if len(q.AliasWhereStatements) == 0 {
-			return q.tableQuery()
+			return q.tableQuery(r)
 		}
-		return q.aliasQuery()
+		return q.aliasQuery(r)
 	case objectRef.GROUP:
-		return q.groupQuery()
+		return q.groupQuery(r)
 	default:
-		return q.tableQuery()
+		return q.tableQuery(r)
 	}
 }
 
-func (q *Query) tableQuery() string {
+func (q *Query) tableQuery(r *cteRenderer) string {
 	var query string = "SELECT "
 
 	if q.Limit != nil && *q.Limit > 0 {
@@ -55,7 +78,7 @@ func (q *Query) tableQuery() string {
 	query = query + " FROM " + q.From
 
 	if len(q.JoinStatements) > 0 {
-		query = query + joinConstructor(q.JoinStatements)
+		query = query + joinConstructor(q.JoinStatements, r)
 	}
 
 	if len(q.WhereStatements) > 0 {
@@ -69,7 +92,7 @@ func (q *Query) tableQuery() string {
 	return query
 }
 
-func (q *Query) aliasQuery() string {
+func (q *Query) aliasQuery(r *cteRenderer) string {
 	var query string = "SELECT "
 
 	if q.Limit != nil && *q.Limit > 0 {
@@ -83,7 +106,12 @@ func (q *Query) aliasQuery() string {
 
 	query = query + strings.Join(selectList, ", ")
 
-	query = query + fmt.Sprintf(" FROM ( %s ) AS %s", q.aliasTableQuery(), q.TableAlias)
+	if r != nil {
+		name := r.add(q.TableAlias+"_base", q.aliasTableQuery(r))
+		query = query + fmt.Sprintf(" FROM %s AS %s", name, q.TableAlias)
+	} else {
+		query = query + fmt.Sprintf(" FROM ( %s ) AS %s", q.aliasTableQuery(r), q.TableAlias)
+	}
 
 	if len(q.AliasWhereStatements) > 0 {
 		query = query + whereConstructor(q.AliasWhereStatements)
@@ -96,7 +124,7 @@ func (q *Query) aliasQuery() string {
 	return query
 }
 
-func (q *Query) aliasTableQuery() string {
+func (q *Query) aliasTableQuery(r *cteRenderer) string {
 	var query string = "SELECT "
 
 	query = query + selectConstructor(q.SelectStatements)
@@ -104,7 +132,7 @@ func (q *Query) aliasTableQuery() string {
 	query = query + " FROM " + q.From
 
 	if len(q.JoinStatements) > 0 {
-		query = query + joinConstructor(q.JoinStatements)
+		query = query + joinConstructor(q.JoinStatements, r)
 	}
 
 	if len(q.WhereStatements) > 0 {
@@ -114,7 +142,7 @@ func (q *Query) aliasTableQuery() string {
 	return query
 }
 
-func (q *Query) groupQuery() string {
+func (q *Query) groupQuery(r *cteRenderer) string {
 	var query string = "SELECT "
 
 	if q.Limit != nil && *q.Limit > 0 {
@@ -126,7 +154,7 @@ func (q *Query) groupQuery() string {
 	query = query + " FROM " + q.From
 
 	if len(q.JoinStatements) > 0 {
-		query = query + joinConstructor(q.JoinStatements)
+		query = query + joinConstructor(q.JoinStatements, r)
 	}
 
 	if len(q.WhereStatements) > 0 {
@@ -172,7 +200,7 @@ func (q *Query) JoinedStatements() []SelectStatement {
 	for _, js := range q.JoinStatements {
 		for _, ss := range js.Child_Query.SelectStatements {
 			// Ignore child joined on since parent should be referenced instead
-			if ss.Name() == *js.Child_On {
+			if js.isChildOn(ss.Name()) {
 				continue
 			}
 			fieldName := ss.Name()
@@ -181,6 +209,7 @@ func (q *Query) JoinedStatements() []SelectStatement {
 				FieldName: &fieldName,
 				TableName: js.Alias,
 				ObjType:   ss.ObjectType(),
+				HasNull:   ss.Nullable() || js.ChildNullable(),
 			}
 			output = append(output, &joinedSelect)
 		}
@@ -188,20 +217,30 @@ func (q *Query) JoinedStatements() []SelectStatement {
 	return output
 }
 
+// Find a joined statement by name.
+// Names may be qualified by the join alias. Ex. Dentist.Name
 func (q *Query) GetJoinedStatement(input string) (*SelectField, bool) {
+	alias, name, qualified := strings.Cut(input, ".")
+	if !qualified {
+		name = input
+	}
 	for _, js := range q.JoinStatements {
+		if qualified && *js.Alias != alias {
+			continue
+		}
 		for _, ss := range js.Child_Query.SelectStatements {
 			// Ignore child joined on since parent should be referenced instead
-			if ss.Name() == *js.Child_On {
+			if js.isChildOn(ss.Name()) {
 				continue
 			}
-			if input == ss.Name() {
+			if name == ss.Name() {
 				fieldName := ss.Name()
 				joinedSelect := SelectField{
 					Query:     q,
 					FieldName: &fieldName,
 					TableName: js.Alias,
 					ObjType:   ss.ObjectType(),
+					HasNull:   ss.Nullable() || js.ChildNullable(),
 				}
 				return &joinedSelect, true
 			}
@@ -306,38 +345,130 @@ func (sge *SelectGroupExpression) Statement() string {
 type JoinStatement struct {
 	Parent_Query *Query
 	Child_Query  *Query
-	Parent_On    *string
-	Child_On     *string
+	Conditions   []JoinCondition
 	JoinType     *string
 	Alias        *string
+	// Child is joined as its base table. Set by Optimize
+	Flattened bool
+}
+
+// A single equality between a parent column and a child column
+type JoinCondition struct {
+	Parent_On string
+	Child_On  string
+}
+
+// Apply joins correlate the child query to the parent instead of using ON
+func (js *JoinStatement) IsApply() bool {
+	return *js.JoinType == "CROSS APPLY" || *js.JoinType == "OUTER APPLY"
+}
+
+// Child columns can be NULL when the child is the outer side of the join
+func (js *JoinStatement) ChildNullable() bool {
+	switch *js.JoinType {
+	case "LEFT", "FULL", "OUTER APPLY":
+		return true
+	default:
+		return false
+	}
+}
+
+// Parent columns can be NULL when the parent is the outer side of the join
+func (js *JoinStatement) ParentNullable() bool {
+	switch *js.JoinType {
+	case "RIGHT", "FULL":
+		return true
+	default:
+		return false
+	}
+}
+
+// Names of the child columns joined on
+func (js *JoinStatement) ChildOns() []string {
+	var ons []string
+	for _, c := range js.Conditions {
+		ons = append(ons, c.Child_On)
+	}
+	return ons
+}
+
+func (js *JoinStatement) isChildOn(name string) bool {
+	for _, c := range js.Conditions {
+		if c.Child_On == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (js *JoinStatement) parentColumn(c JoinCondition) *sqlExpr.Column {
+	return &sqlExpr.Column{Table: js.Parent_Query.TableName, Name: c.Parent_On, Plain: !js.Parent_Query.BracketedColumns}
 }
 
-func (js *JoinStatement) parentIrOn() string {
-	if js.Parent_Query.BracketedColumns {
-		return fmt.Sprintf("%s.[%s]", js.Parent_Query.TableName, *js.Parent_On)
+// Conditions joining the parent to the child alias. Ex. Customers.[CustomerID] = Invoices.[CustomerID]
+func (js *JoinStatement) onConditions() []sqlExpr.Node {
+	var conditions []sqlExpr.Node
+	for _, c := range js.Conditions {
+		child := &sqlExpr.Column{Table: *js.Alias, Name: c.Child_On, Plain: !js.Child_Query.BracketedColumns}
+		conditions = append(conditions, &sqlExpr.Condition{Operator: "=", Left: js.parentColumn(c), Right: child})
 	}
-	return fmt.Sprintf("%s.%s", js.Parent_Query.TableName, *js.Parent_On)
+	return conditions
 }
 
-func (js *JoinStatement) joinIrOn() string {
-	if js.Child_Query.BracketedColumns {
-		return fmt.Sprintf("%s.[%s]", *js.Alias, *js.Child_On)
+func (js *JoinStatement) onConstructor() string {
+	var conditions []string
+	for _, c := range js.onConditions() {
+		conditions = append(conditions, c.String())
 	}
-	return fmt.Sprintf("%s.%s", *js.Alias, *js.Child_On)
+	return strings.Join(conditions, " AND ")
+}
+
+// Child query filtered to the current parent row
+func (js *JoinStatement) correlatedQuery() *Query {
+	child := *js.Child_Query
+	child.WhereStatements = append([]sqlExpr.Node{}, js.Child_Query.WhereStatements...)
+	for _, c := range js.Conditions {
+		childOn := &sqlExpr.Column{Table: child.TableName, Name: c.Child_On, Plain: !child.BracketedColumns}
+		child.WhereStatements = append(child.WhereStatements,
+			&sqlExpr.Condition{Operator: "=", Left: childOn, Right: js.parentColumn(c)})
+	}
+	return &child
+}
+
+// Correlated sub query used as a semi join filter with EXISTS.
+// Does not add rows or columns to the parent. Rendered with the expression it is used in.
+func (js *JoinStatement) ExistsQuery() sqlExpr.Statement {
+	return &existsQuery{join: js}
 }
 
 // TODO: Append select statements from joins
-func joinConstructor(joins []*JoinStatement) string {
+func joinConstructor(joins []*JoinStatement, r *cteRenderer) string {
 	var joinArr []string
 	for _, j := range joins {
+		// Apply joins are correlated to the parent row so they stay inline
+		if j.IsApply() {
+			joinArr = append(joinArr, fmt.Sprintf(" %s ( %s ) AS %s", *j.JoinType, j.correlatedQuery().statement(), *j.Alias))
+			continue
+		}
+
+		if j.Flattened {
+			joinArr = append(joinArr, j.flattenedJoin())
+			continue
+		}
+
+		if r != nil {
+			name := r.add(*j.Alias, j.Child_Query.render(r))
+			joinArr = append(joinArr, fmt.Sprintf(" %s JOIN %s AS %s ON %s", *j.JoinType, name, *j.Alias, j.onConstructor()))
+			continue
+		}
 
-		joinArr = append(joinArr, fmt.Sprintf(" %s JOIN ( %s ) AS %s ON %s = %s", *j.JoinType, j.Child_Query.ConstructQuery(), *j.Alias, j.parentIrOn(), j.joinIrOn()))
+		joinArr = append(joinArr, fmt.Sprintf(" %s JOIN ( %s ) AS %s ON %s", *j.JoinType, j.Child_Query.statement(), *j.Alias, j.onConstructor()))
 	}
 
 	return strings.Join(joinArr, " ")
 }
 
-func whereConstructor(statements []string) string {
+func whereConstructor(statements []sqlExpr.Node) string {
 	where := ""
 	if len(statements) < 1 {
 		return where
@@ -349,12 +480,12 @@ func whereConstructor(statements []string) string {
 	}
 	where = fmt.Sprintf(" WHERE %s", statements[0])
 	for i := 1; i < len(statements); i++ {
-		where = where + " AND " + statements[i]
+		where = where + " AND " + statements[i].String()
 	}
 	return where
 }
 
-func havingConstructor(statements []string) string {
+func havingConstructor(statements []sqlExpr.Node) string {
 	where := ""
 	if len(statements) < 1 {
 		return where
@@ -366,15 +497,15 @@ func havingConstructor(statements []string) string {
 	}
 	where = fmt.Sprintf(" HAVING %s", statements[0])
 	for i := 1; i < len(statements); i++ {
-		where = where + " AND " + statements[i]
+		where = where + " AND " + statements[i].String()
 	}
 	return where
 }
 
-func groupByConstructor(statements []string) string {
+func groupByConstructor(statements []sqlExpr.Node) string {
 	var groupByStrings []string
 	for _, s := range statements {
-		groupByStrings = append(groupByStrings, s)
+		groupByStrings = append(groupByStrings, s.String())
 	}
 
 	return " GROUP BY " + strings.Join(groupByStrings, ", ")
@@ -0,0 +1,239 @@
+package sqlExpr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Node of a SQL expression tree.
+// Expressions are kept as nodes until the query is rendered with String.
+type Node interface {
+	String() string
+}
+
+// Query nested in an expression. Rendered with String when the expression is rendered.
+// Ex. *sql.Query or the members of a recursive CTE
+type Statement interface {
+	String() string
+	// Expressions of the statement, searched by Columns
+	Nodes() []Node
+}
+
+// Column of a table or alias. Ex. Customers.[Name]
+type Column struct {
+	Table string
+	Name  string
+	// Rendered without brackets. Ex. Customers.Name
+	Plain bool
+}
+
+func (c *Column) String() string {
+	if c.Plain {
+		return c.Table + "." + c.Name
+	}
+	return fmt.Sprintf("%s.[%s]", c.Table, c.Name)
+}
+
+// Rendered literal value. Ex. 1, 'text', NULL
+type Literal struct {
+	Value string
+}
+
+func (l *Literal) String() string { return l.Value }
+
+// Named parameter bound when the query is executed. Ex. @since
+type Parameter struct {
+	Name string
+}
+
+func (p *Parameter) String() string { return "@" + p.Name }
+
+// SQL keyword or type name passed to a function. Ex. year, date
+type Keyword struct {
+	Word string
+}
+
+func (k *Keyword) String() string { return k.Word }
+
+// Parenthesised binary operation. Ex. (a = b), (a LIKE b), (a IS NULL)
+type Binary struct {
+	Operator string
+	Left     Node
+	Right    Node
+}
+
+func (b *Binary) String() string {
+	return fmt.Sprintf("(%s %s %s)", b.Left.String(), b.Operator, b.Right.String())
+}
+
+// Operation without parentheses, used for join, correlation and recursion conditions
+type Condition struct {
+	Operator string
+	Left     Node
+	Right    Node
+}
+
+func (c *Condition) String() string {
+	return fmt.Sprintf("%s %s %s", c.Left.String(), c.Operator, c.Right.String())
+}
+
+// Prefix operation. Ex. -a
+type Prefix struct {
+	Operator string
+	Right    Node
+}
+
+func (p *Prefix) String() string { return p.Operator + p.Right.String() }
+
+// Function call. Ex. LEN(a), DATEPART(year, a)
+type Call struct {
+	Name string
+	Args []Node
+}
+
+func (c *Call) String() string {
+	args := make([]string, len(c.Args))
+	for i, a := range c.Args {
+		args[i] = a.String()
+	}
+	return fmt.Sprintf("%s(%s)", c.Name, strings.Join(args, ", "))
+}
+
+// CAST( a AS type )
+type Cast struct {
+	Expression Node
+	Type       string
+}
+
+func (c *Cast) String() string {
+	return fmt.Sprintf("CAST( %s AS %s )", c.Expression.String(), c.Type)
+}
+
+// a AT TIME ZONE zone
+type AtTimeZone struct {
+	Expression Node
+	Zone       Node
+}
+
+func (a *AtTimeZone) String() string {
+	return fmt.Sprintf("%s AT TIME ZONE %s", a.Expression.String(), a.Zone.String())
+}
+
+// Expression wrapped in parentheses
+type Paren struct {
+	Inner Node
+}
+
+func (p *Paren) String() string { return "(" + p.Inner.String() + ")" }
+
+// Scalar sub query. Ex. (SELECT MAX(a) FROM b)
+type SubQuery struct {
+	Query Statement
+}
+
+func (s *SubQuery) String() string { return "(" + s.Query.String() + ")" }
+
+// a IN (SELECT ...)
+type InQuery struct {
+	Left  Node
+	Query *SubQuery
+}
+
+func (i *InQuery) String() string { return fmt.Sprintf("%s IN %s", i.Left.String(), i.Query.String()) }
+
+// EXISTS ( SELECT ... ) or NOT EXISTS ( SELECT ... )
+type Exists struct {
+	Not   bool
+	Query Statement
+}
+
+func (e *Exists) String() string {
+	if e.Not {
+		return fmt.Sprintf("NOT EXISTS ( %s )", e.Query.String())
+	}
+	return fmt.Sprintf("EXISTS ( %s )", e.Query.String())
+}
+
+// Rebuild the tree bottom up, replacing each node with the result of fn.
+// Sub queries are not rebuilt.
+func Transform(n Node, fn func(Node) Node) Node {
+	switch n := n.(type) {
+	case *Binary:
+		n = &Binary{Operator: n.Operator, Left: Transform(n.Left, fn), Right: Transform(n.Right, fn)}
+		return fn(n)
+	case *Condition:
+		n = &Condition{Operator: n.Operator, Left: Transform(n.Left, fn), Right: Transform(n.Right, fn)}
+		return fn(n)
+	case *Prefix:
+		return fn(&Prefix{Operator: n.Operator, Right: Transform(n.Right, fn)})
+	case *Call:
+		args := make([]Node, len(n.Args))
+		for i, a := range n.Args {
+			args[i] = Transform(a, fn)
+		}
+		return fn(&Call{Name: n.Name, Args: args})
+	case *Cast:
+		return fn(&Cast{Expression: Transform(n.Expression, fn), Type: n.Type})
+	case *AtTimeZone:
+		return fn(&AtTimeZone{Expression: Transform(n.Expression, fn), Zone: Transform(n.Zone, fn)})
+	case *Paren:
+		return fn(&Paren{Inner: Transform(n.Inner, fn)})
+	case *InQuery:
+		return fn(&InQuery{Left: Transform(n.Left, fn), Query: n.Query})
+	default:
+		return fn(n)
+	}
+}
+
+// Visit each node of the tree and of its sub queries
+func walk(n Node, fn func(Node)) {
+	Transform(n, func(n Node) Node {
+		fn(n)
+		switch n := n.(type) {
+		case *SubQuery:
+			walkStatement(n.Query, fn)
+		case *InQuery:
+			walkStatement(n.Query.Query, fn)
+		case *Exists:
+			walkStatement(n.Query, fn)
+		}
+		return n
+	})
+}
+
+func walkStatement(s Statement, fn func(Node)) {
+	for _, n := range s.Nodes() {
+		walk(n, fn)
+	}
+}
+
+// Columns referenced in the tree, including those of sub queries
+func Columns(n Node) []*Column {
+	var columns []*Column
+	walk(n, func(n Node) {
+		if c, ok := n.(*Column); ok {
+			columns = append(columns, c)
+		}
+	})
+	return columns
+}
+
+// Columns referenced by the expressions of the statement
+func StatementColumns(s Statement) []*Column {
+	var columns []*Column
+	for _, n := range s.Nodes() {
+		columns = append(columns, Columns(n)...)
+	}
+	return columns
+}
+
+// Parameters of the statement and of its sub queries
+func StatementParameters(s Statement) []*Parameter {
+	var params []*Parameter
+	walkStatement(s, func(n Node) {
+		if p, ok := n.(*Parameter); ok {
+			params = append(params, p)
+		}
+	})
+	return params
+}
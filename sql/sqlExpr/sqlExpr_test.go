@@ -0,0 +1,80 @@
+package sqlExpr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		node     Node
+		expected string
+	}{
+		{&Binary{Operator: "=", Left: &Column{Table: "T", Name: "a"}, Right: &Literal{Value: "'x'"}}, "(T.[a] = 'x')"},
+		{&Prefix{Operator: "-", Right: &Column{Table: "T", Name: "a"}}, "-T.[a]"},
+		{&Call{Name: "DATEPART", Args: []Node{&Keyword{Word: "year"}, &Column{Table: "T", Name: "d"}}}, "DATEPART(year, T.[d])"},
+		{&Cast{Expression: &Column{Table: "T", Name: "a"}, Type: "float"}, "CAST( T.[a] AS float )"},
+		{&AtTimeZone{Expression: &Column{Table: "T", Name: "d"}, Zone: &Literal{Value: "'UTC'"}}, "T.[d] AT TIME ZONE 'UTC'"},
+		{&Column{Table: "T", Name: "a", Plain: true}, "T.a"},
+		{&InQuery{Left: &Column{Table: "T", Name: "a"}, Query: &SubQuery{Query: &testStatement{sql: "SELECT 1"}}}, "T.[a] IN (SELECT 1)"},
+		{&Exists{Not: true, Query: &testStatement{sql: "SELECT 1"}}, "NOT EXISTS ( SELECT 1 )"},
+	}
+
+	for _, tt := range tests {
+		if tt.node.String() != tt.expected {
+			t.Errorf("expected %s. got=%s", tt.expected, tt.node.String())
+		}
+	}
+}
+
+// Sub query selecting its nodes
+type testStatement struct {
+	sql   string
+	nodes []Node
+}
+
+func (ts *testStatement) String() string { return ts.sql }
+func (ts *testStatement) Nodes() []Node  { return ts.nodes }
+
+func TestTransform(t *testing.T) {
+	tree := &Binary{Operator: "AND",
+		Left:  &Binary{Operator: ">", Left: &Column{Table: "A", Name: "x"}, Right: &Literal{Value: "1"}},
+		Right: &Call{Name: "LEN", Args: []Node{&Column{Table: "A", Name: "y"}}},
+	}
+
+	out := Transform(tree, func(n Node) Node {
+		if c, ok := n.(*Column); ok && c.Name == "x" {
+			return &Paren{Inner: &Binary{Operator: "+", Left: &Column{Table: "T", Name: "x"}, Right: &Literal{Value: "1"}}}
+		}
+		return n
+	})
+
+	expected := "((((T.[x] + 1)) > 1) AND LEN(A.[y]))"
+	if out.String() != expected {
+		t.Errorf("expected %s. got=%s", expected, out.String())
+	}
+	if tree.String() != "((A.[x] > 1) AND LEN(A.[y]))" {
+		t.Errorf("Transform modified the original tree. got=%s", tree.String())
+	}
+
+	columns := Columns(out)
+	if len(columns) != 2 || columns[0].Table != "T" || columns[1].Name != "y" {
+		t.Errorf("unexpected columns %v", columns)
+	}
+}
+
+func TestColumns_SubQueries(t *testing.T) {
+	sub := &testStatement{sql: "SELECT B.[y] FROM B", nodes: []Node{&Column{Table: "B", Name: "y"}}}
+	tree := &Binary{Operator: "AND",
+		Left:  &InQuery{Left: &Column{Table: "A", Name: "x"}, Query: &SubQuery{Query: sub}},
+		Right: &Exists{Query: &testStatement{sql: "SELECT 1", nodes: []Node{&Column{Table: "C", Name: "z"}}}},
+	}
+
+	var names []string
+	for _, c := range Columns(tree) {
+		names = append(names, c.Table+"."+c.Name)
+	}
+	if strings.Join(names, ",") != "A.x,B.y,C.z" {
+		t.Errorf("expected columns of the sub queries. got=%v", names)
+	}
+}
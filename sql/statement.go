@@ -0,0 +1,113 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Team-Solutions-Dental/dyre/object"
+	"github.com/Team-Solutions-Dental/dyre/sql/sqlExpr"
+)
+
+// Query rendered as a sub query, without a WITH clause
+func (q *Query) String() string {
+	return q.statement()
+}
+
+// Expressions of the query and of its joined queries
+func (q *Query) Nodes() []sqlExpr.Node {
+	var nodes []sqlExpr.Node
+	for _, ss := range q.SelectStatements {
+		switch ss := ss.(type) {
+		case *SelectField:
+			nodes = append(nodes, &sqlExpr.Column{Table: *ss.TableName, Name: *ss.FieldName})
+		case *SelectGroupField:
+			nodes = append(nodes, &sqlExpr.Column{Table: *ss.TableName, Name: *ss.FieldName})
+		case *SelectExpression:
+			nodes = append(nodes, object.NodeOf(ss.Expression))
+		case *SelectGroupExpression:
+			nodes = append(nodes, object.NodeOf(ss.Expression))
+		}
+	}
+	nodes = append(nodes, q.WhereStatements...)
+	nodes = append(nodes, q.AliasWhereStatements...)
+	nodes = append(nodes, q.GroupByStatements...)
+	nodes = append(nodes, q.HavingStatements...)
+	for _, js := range q.JoinStatements {
+		nodes = append(nodes, js.Child_Query.Nodes()...)
+		nodes = append(nodes, js.onConditions()...)
+	}
+	return nodes
+}
+
+// Correlated sub query of a semi join. Ex. SELECT 1 FROM ( child ) AS alias WHERE parent.[key] = alias.[key]
+type existsQuery struct {
+	join *JoinStatement
+}
+
+func (e *existsQuery) String() string {
+	js := e.join
+	return fmt.Sprintf("SELECT 1 FROM ( %s ) AS %s WHERE %s", js.Child_Query.statement(), *js.Alias, js.onConstructor())
+}
+
+func (e *existsQuery) Nodes() []sqlExpr.Node {
+	return append(e.join.Child_Query.Nodes(), e.join.onConditions()...)
+}
+
+// SELECT of expressions built outside a Query. Ex. the members of a recursive CTE
+type Select struct {
+	Columns []sqlExpr.Node
+	From    string
+	Joins   []*InnerJoin
+	Where   []sqlExpr.Node
+}
+
+type InnerJoin struct {
+	Table string
+	On    sqlExpr.Node
+}
+
+func (s *Select) String() string {
+	columns := make([]string, len(s.Columns))
+	for i, c := range s.Columns {
+		columns[i] = c.String()
+	}
+
+	query := "SELECT " + strings.Join(columns, ", ") + " FROM " + s.From
+	for _, j := range s.Joins {
+		query = query + fmt.Sprintf(" INNER JOIN %s ON %s", j.Table, j.On.String())
+	}
+	return query + whereConstructor(s.Where)
+}
+
+func (s *Select) Nodes() []sqlExpr.Node {
+	nodes := append([]sqlExpr.Node{}, s.Columns...)
+	for _, j := range s.Joins {
+		nodes = append(nodes, j.On)
+	}
+	return append(nodes, s.Where...)
+}
+
+// Statements combined with UNION ALL. Ex. the anchor and recursive member of a CTE
+type UnionAll []sqlExpr.Statement
+
+func (u UnionAll) String() string {
+	statements := make([]string, len(u))
+	for i, s := range u {
+		statements[i] = s.String()
+	}
+	return strings.Join(statements, " UNION ALL ")
+}
+
+func (u UnionAll) Nodes() []sqlExpr.Node {
+	var nodes []sqlExpr.Node
+	for _, s := range u {
+		nodes = append(nodes, s.Nodes()...)
+	}
+	return nodes
+}
+
+// Stage rendered by the CTE renderer while the query is rendered
+type renderedStatement string
+
+func (r renderedStatement) String() string        { return string(r) }
+func (r renderedStatement) Nodes() []sqlExpr.Node { return nil }
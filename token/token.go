@@ -51,8 +51,10 @@ const (
 	AND   = "AND"
 	OR    = "OR"
 	NULL  = "NULL"
+	IN    = "IN"
 
 	REFERENCE = "@"
+	VARIABLE  = "$"
 
 	GROUP = "GROUP"
 
@@ -66,6 +68,7 @@ var keywords = map[string]TokenType{
 	"NULL":  NULL,
 	"AND":   AND,
 	"OR":    OR,
+	"IN":    IN,
 	"ASC":   ASC,
 	"DESC":  DESC,
 	// Column Functions
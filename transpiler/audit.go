@@ -0,0 +1,257 @@
+package transpiler
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Team-Solutions-Dental/dyre/endpoint"
+	"github.com/Team-Solutions-Dental/dyre/object"
+	"github.com/Team-Solutions-Dental/dyre/sql"
+	"github.com/Team-Solutions-Dental/dyre/sql/sqlExpr"
+)
+
+// Record of the data a query reads, for access audits.
+// Selected columns are returned by the query. Referenced columns are only
+// used to filter, sort, group or join rows, including by row filters.
+type AuditRecord struct {
+	Time       time.Time       `json:"time"`
+	Subject    string          `json:"subject,omitempty"`
+	Tenant     any             `json:"tenant,omitempty"`
+	Endpoint   string          `json:"endpoint"`
+	Export     bool            `json:"export,omitempty"`
+	Joins      []AuditJoin     `json:"joins,omitempty"`
+	Selected   []AuditColumn   `json:"selected,omitempty"`
+	Referenced []AuditColumn   `json:"referenced,omitempty"`
+	Omitted    []AuditColumn   `json:"omitted,omitempty"`
+	Masked     []AuditColumn   `json:"masked,omitempty"`
+	Decisions  []AuditDecision `json:"decisions,omitempty"`
+}
+
+type AuditColumn struct {
+	Endpoint       string `json:"endpoint"`
+	Field          string `json:"field"`
+	Classification string `json:"classification,omitempty"`
+}
+
+// Endpoint joined into the query
+type AuditJoin struct {
+	Path     string `json:"path"` // Join aliases from the primary endpoint. Ex. Invoices/Payments
+	Endpoint string `json:"endpoint"`
+	Kind     string `json:"kind"` // "join" or "exists"
+	// Join omitted due to security. Its columns are not read
+	Omitted bool `json:"omitted,omitempty"`
+}
+
+// Permission set the request was evaluated on
+type AuditDecision struct {
+	Permissions []string `json:"permissions"`
+	Allowed     bool     `json:"allowed"`
+}
+
+// Audit record of the evaluated query
+// Run Evaluate Query First!
+func (pir *PrimaryIR) Audit() (*AuditRecord, error) {
+	if !pir.evaluated {
+		return nil, errors.New("Query must be evaluated before it is audited")
+	}
+
+	record := pir.auditRecord()
+	if pir.security != nil {
+		record.Subject = pir.security.subject
+	}
+	return record, nil
+}
+
+// Audit record of a request served by the plan.
+// Plans are shared by the principals of a class, so the caller is named by subject.
+func (p *Plan) Audit(subject string) *AuditRecord {
+	record := p.ir.auditRecord()
+	record.Subject = subject
+	return record
+}
+
+func (ir *IR) auditRecord() *AuditRecord {
+	record := &AuditRecord{Time: time.Now().UTC(), Endpoint: ir.endpoint.Name}
+	ir.audit(record, "", nil)
+	record.Selected = uniqueColumns(record.Selected, nil)
+	record.Referenced = uniqueColumns(record.Referenced, record.Selected)
+
+	if ir.security != nil {
+		record.Tenant = ir.security.tenant
+		record.Export = ir.security.export
+
+		// Sets prefetched for the endpoint tree but never consulted are not decisions of the request
+		keys := make([]string, 0, len(ir.security.used))
+		for key := range ir.security.used {
+			if _, ok := ir.security.decided[key]; ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			record.Decisions = append(record.Decisions,
+				AuditDecision{Permissions: strings.Split(key, "\x00"), Allowed: ir.security.decided[key]})
+		}
+	}
+
+	return record
+}
+
+// Returned are the select names the parent returns. Nil returns every select.
+// Columns of selects that are not returned, like join keys, are referenced.
+func (ir *IR) audit(record *AuditRecord, path string, returned map[string]bool) {
+	selected := map[string]bool{}
+	referenced := map[string]bool{}
+	output := func(s sql.SelectStatement) map[string]bool {
+		if returned == nil || returned[s.Name()] {
+			return selected
+		}
+		return referenced
+	}
+
+	// Columns of the endpoint table or of a join alias
+	var addNode func(n sqlExpr.Node, into map[string]bool)
+	addNode = func(n sqlExpr.Node, into map[string]bool) {
+		for _, c := range sqlExpr.Columns(n) {
+			if c.Table == ir.endpoint.TableName {
+				if _, ok := ir.endpoint.Fields[c.Name]; ok {
+					into[c.Name] = true
+				}
+				continue
+			}
+			ir.auditJoined(record, c.Table+"."+c.Name)
+		}
+	}
+
+	for _, s := range ir.sql.SelectStatements {
+		switch s := s.(type) {
+		case *sql.SelectField:
+			if *s.TableName == ir.endpoint.TableName {
+				output(s)[*s.FieldName] = true
+			}
+		case *sql.SelectGroupField:
+			if *s.TableName == ir.endpoint.TableName {
+				output(s)[*s.FieldName] = true
+			}
+		case *sql.SelectExpression:
+			addNode(object.NodeOf(s.Expression), output(s))
+		case *sql.SelectGroupExpression:
+			addNode(object.NodeOf(s.Expression), output(s))
+		}
+	}
+	// Masked values are listed as masked and not as read
+	for field := range ir.maskedFields {
+		delete(selected, field)
+	}
+
+	var filters []sqlExpr.Node
+	filters = append(filters, ir.sql.WhereStatements...)
+	filters = append(filters, ir.sql.AliasWhereStatements...)
+	filters = append(filters, ir.sql.GroupByStatements...)
+	filters = append(filters, ir.sql.HavingStatements...)
+	for _, n := range filters {
+		addNode(n, referenced)
+	}
+	for _, ob := range ir.sql.OrderBy {
+		if _, ok := ir.endpoint.Fields[ob.FieldName]; ok {
+			referenced[ob.FieldName] = true
+		} else {
+			ir.auditJoined(record, ob.FieldName)
+		}
+	}
+
+	for _, j := range append(append([]*joinIR{}, ir.joins...), ir.semiJoins...) {
+		for _, on := range j.ons {
+			referenced[on.Parent] = true
+		}
+	}
+
+	record.Selected = appendColumns(record.Selected, ir.endpoint, selected, nil)
+	record.Referenced = appendColumns(record.Referenced, ir.endpoint, referenced, selected)
+	record.Omitted = appendColumns(record.Omitted, ir.endpoint, ir.omittedFields, nil)
+	record.Masked = appendColumns(record.Masked, ir.endpoint, ir.maskedFields, nil)
+
+	for _, j := range ir.joins {
+		// Joined selects are returned under their own name by the parent
+		joinReturned := map[string]bool{}
+		for _, s := range ir.sql.SelectStatements {
+			if sf, ok := s.(*sql.SelectField); ok && *sf.TableName == j.alias && (returned == nil || returned[sf.Name()]) {
+				joinReturned[sf.Name()] = true
+			}
+		}
+		ir.auditJoin(record, path, j, "join", joinReturned)
+	}
+	for _, j := range ir.omittedJoins {
+		ir.auditJoin(record, path, j, "join", nil)
+	}
+	// Exists filters only test rows, nothing of the child is returned
+	for _, j := range ir.semiJoins {
+		ir.auditJoin(record, path, j, "exists", map[string]bool{})
+	}
+}
+
+func (ir *IR) auditJoin(record *AuditRecord, path string, j *joinIR, kind string, returned map[string]bool) {
+	joinPath := j.alias
+	if path != "" {
+		joinPath = path + "/" + j.alias
+	}
+	record.Joins = append(record.Joins, AuditJoin{Path: joinPath, Endpoint: j.childIR.endpoint.Name, Kind: kind, Omitted: j.childIR.omitted})
+	if j.childIR.omitted {
+		return
+	}
+
+	j.childIR.audit(record, joinPath, returned)
+	for _, on := range j.ons {
+		record.Referenced = appendColumns(record.Referenced, j.childIR.endpoint, map[string]bool{on.Child: true}, nil)
+	}
+}
+
+// Joined column used by the parent, ex. 'Visits.Notes'. Recorded as referenced by the joined endpoint.
+func (ir *IR) auditJoined(record *AuditRecord, name string) {
+	alias, field, ok := strings.Cut(name, ".")
+	if !ok {
+		return
+	}
+	for _, j := range ir.joins {
+		if j.alias != alias || j.childIR.omitted {
+			continue
+		}
+		if _, ok := j.childIR.endpoint.Fields[field]; ok {
+			record.Referenced = appendColumns(record.Referenced, j.childIR.endpoint, map[string]bool{field: true}, nil)
+		}
+	}
+}
+
+// Append the fields in sorted order, skipping those in skip
+func appendColumns(columns []AuditColumn, ep *endpoint.Endpoint, fields map[string]bool, skip map[string]bool) []AuditColumn {
+	names := make([]string, 0, len(fields))
+	for field, ok := range fields {
+		if ok && !skip[field] {
+			names = append(names, field)
+		}
+	}
+	sort.Strings(names)
+
+	for _, field := range names {
+		columns = append(columns, AuditColumn{Endpoint: ep.Name, Field: field, Classification: ep.Fields[field].Classification})
+	}
+	return columns
+}
+
+// Columns without duplicates and without those in skip, in first seen order
+func uniqueColumns(columns []AuditColumn, skip []AuditColumn) []AuditColumn {
+	seen := map[AuditColumn]bool{}
+	for _, c := range skip {
+		seen[c] = true
+	}
+	var unique []AuditColumn
+	for _, c := range columns {
+		if !seen[c] {
+			seen[c] = true
+			unique = append(unique, c)
+		}
+	}
+	return unique
+}
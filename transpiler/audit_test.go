@@ -0,0 +1,158 @@
+package transpiler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Team-Solutions-Dental/dyre/endpoint"
+)
+
+func testNewAudited(t *testing.T) *endpoint.Service {
+	service, err := endpoint.ParseJSON([]byte(`
+[
+  {
+    "name": "Patients",
+    "tableName": "Patients",
+    "joins": [{ "endpoint": "Visits", "on": "PatientID" }, { "endpoint": "Claims", "on": "PatientID" }],
+    "fields": [
+      "PatientID",
+      "Name",
+      {"name": "DOB", "type": "date", "classification": "phi"},
+      {"name": "SSN", "classification": "pii", "security": {"permissions": ["phi:ssn"], "onDeny": "partial", "pattern": "***-**-####"}},
+      {"name": "Email", "classification": "pii", "security": {"permissions": ["phi:contact"], "onDeny": "omit"}}
+    ]
+  },
+  {
+    "name": "Visits",
+    "tableName": "Visits",
+    "fields": ["VisitID", "PatientID", "Diagnosis"]
+  },
+  {
+    "name": "Claims",
+    "tableName": "Claims",
+    "fields": ["ClaimID", "PatientID", "Status"]
+  }
+]`))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	return service
+}
+
+func TestAudit(t *testing.T) {
+	service := testNewAudited(t)
+	checker := endpoint.AdaptChecker(endpoint.NewStaticChecker(map[string]struct{}{}))
+
+	ir, err := NewWithOptions("Name: SSN: Email: DOB: > '2000-01-01'; exists('Claims', 'Status: != null;');",
+		service.Endpoints["Patients"], Options{Checker: checker, Subject: "dr-1", Tenant: 7})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	join, err := ir.AUTOJOIN("LEFT", "Visits")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = join.Query("VisitID:"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err = ir.Audit(); err == nil {
+		t.Errorf("expected an error auditing a query that was not evaluated")
+	}
+	if _, err = ir.EvaluateQuery(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	record, err := ir.Audit()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if record.Subject != "dr-1" || record.Tenant != 7 || record.Endpoint != "Patients" {
+		t.Errorf("wrong record header. got=%+v", record)
+	}
+
+	expectedJoins := []AuditJoin{
+		{Path: "Visits", Endpoint: "Visits", Kind: "join"},
+		{Path: "Claims", Endpoint: "Claims", Kind: "exists"},
+	}
+	if !reflect.DeepEqual(record.Joins, expectedJoins) {
+		t.Errorf("wrong joins.\nexpected=%v\ngot=     %v", expectedJoins, record.Joins)
+	}
+
+	expectedSelected := []AuditColumn{
+		{"Patients", "DOB", "phi"}, {"Patients", "Name", ""}, {"Visits", "VisitID", ""},
+	}
+	if !reflect.DeepEqual(record.Selected, expectedSelected) {
+		t.Errorf("wrong selected.\nexpected=%v\ngot=     %v", expectedSelected, record.Selected)
+	}
+
+	expectedReferenced := []AuditColumn{
+		{"Patients", "PatientID", ""}, {"Visits", "PatientID", ""},
+		{"Claims", "PatientID", ""}, {"Claims", "Status", ""},
+	}
+	if !reflect.DeepEqual(record.Referenced, expectedReferenced) {
+		t.Errorf("wrong referenced.\nexpected=%v\ngot=     %v", expectedReferenced, record.Referenced)
+	}
+
+	if !reflect.DeepEqual(record.Omitted, []AuditColumn{{"Patients", "Email", "pii"}}) {
+		t.Errorf("wrong omitted. got=%v", record.Omitted)
+	}
+	if !reflect.DeepEqual(record.Masked, []AuditColumn{{"Patients", "SSN", "pii"}}) {
+		t.Errorf("wrong masked. got=%v", record.Masked)
+	}
+
+	expectedDecisions := []AuditDecision{
+		{Permissions: []string{"phi:contact"}, Allowed: false},
+		{Permissions: []string{"phi:ssn"}, Allowed: false},
+	}
+	if !reflect.DeepEqual(record.Decisions, expectedDecisions) {
+		t.Errorf("wrong decisions.\nexpected=%v\ngot=     %v", expectedDecisions, record.Decisions)
+	}
+}
+
+func TestAudit_Plan(t *testing.T) {
+	service := testNewAudited(t)
+	checker := endpoint.AdaptChecker(endpoint.NewStaticChecker(map[string]struct{}{}))
+
+	ir, err := NewWithOptions("Name: Email:", service.Endpoints["Patients"], Options{Checker: checker, Subject: "dr-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	plan, err := ir.Compile()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	record := plan.Audit("dr-2")
+	if record.Subject != "dr-2" || record.Endpoint != "Patients" {
+		t.Errorf("wrong record header. got=%+v", record)
+	}
+	if !reflect.DeepEqual(record.Omitted, []AuditColumn{{"Patients", "Email", "pii"}}) {
+		t.Errorf("wrong omitted. got=%v", record.Omitted)
+	}
+
+	// phi:ssn is checked with the endpoint but SSN is not queried
+	expectedDecisions := []AuditDecision{{Permissions: []string{"phi:contact"}, Allowed: false}}
+	if !reflect.DeepEqual(record.Decisions, expectedDecisions) {
+		t.Errorf("wrong decisions.\nexpected=%v\ngot=     %v", expectedDecisions, record.Decisions)
+	}
+}
+
+func TestAudit_WithoutSecurity(t *testing.T) {
+	ir, err := New("ClaimID: Status: == 'open';", testNewAudited(t).Endpoints["Claims"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = ir.EvaluateQuery(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	record, err := ir.Audit()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []AuditColumn{{"Claims", "ClaimID", ""}, {"Claims", "Status", ""}}
+	if !reflect.DeepEqual(record.Selected, expected) || record.Referenced != nil || record.Decisions != nil {
+		t.Errorf("wrong record. got=%+v", record)
+	}
+}
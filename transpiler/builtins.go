@@ -1,11 +1,10 @@
 package transpiler
 
 import (
-	"fmt"
-
 	"github.com/Team-Solutions-Dental/dyre/object"
 	"github.com/Team-Solutions-Dental/dyre/object/objectRef"
 	"github.com/Team-Solutions-Dental/dyre/object/objectType"
+	"github.com/Team-Solutions-Dental/dyre/sql/sqlExpr"
 )
 
 var builtins = map[string]func(ir *IR, local *objectRef.LocalReferences, args ...object.Object) object.Object{
@@ -19,7 +18,8 @@ var builtins = map[string]func(ir *IR, local *objectRef.LocalReferences, args ..
 		switch {
 		case arg.Type() == objectType.STRING:
 			return &object.Expression{ExpressionType: objectType.INTEGER,
-				Value: fmt.Sprintf("LEN(%s)", args[0])}
+				HasNull: anyNullable(arg),
+				Node:    &sqlExpr.Call{Name: "LEN", Args: []sqlExpr.Node{object.NodeOf(args[0])}}}
 		default:
 			return newError("Invalid Type. %s %s", arg.Type(), arg.String())
 		}
@@ -43,7 +43,8 @@ var builtins = map[string]func(ir *IR, local *objectRef.LocalReferences, args ..
 		}
 
 		return &object.Expression{ExpressionType: objectType.EXPRESSION,
-			Value: fmt.Sprintf("CAST( %s AS %s )", expression, castTo.Value)}
+			HasNull: anyNullable(expression),
+			Node:    &sqlExpr.Cast{Expression: object.NodeOf(expression), Type: castTo.Value}}
 
 	},
 	"timezone": func(ir *IR, local *objectRef.LocalReferences, args ...object.Object) object.Object {
@@ -59,7 +60,8 @@ var builtins = map[string]func(ir *IR, local *objectRef.LocalReferences, args ..
 		}
 
 		return &object.Expression{ExpressionType: objectType.DATE,
-			Value: fmt.Sprintf("%s AT TIME ZONE %s", expression, zone.String())}
+			HasNull: anyNullable(expression),
+			Node:    &sqlExpr.AtTimeZone{Expression: object.NodeOf(expression), Zone: object.NodeOf(zone)}}
 	},
 	"datepart": func(ir *IR, local *objectRef.LocalReferences, args ...object.Object) object.Object {
 		if len(args) != 2 {
@@ -72,7 +74,8 @@ var builtins = map[string]func(ir *IR, local *objectRef.LocalReferences, args ..
 		}
 
 		return &object.Expression{ExpressionType: objectType.DATE,
-			Value: fmt.Sprintf("DATEPART(%s, %s)", datepart.Value, args[1])}
+			HasNull: anyNullable(args[1]),
+			Node:    &sqlExpr.Call{Name: "DATEPART", Args: []sqlExpr.Node{&sqlExpr.Keyword{Word: datepart.Value}, object.NodeOf(args[1])}}}
 	},
 	"dateadd": func(ir *IR, local *objectRef.LocalReferences, args ...object.Object) object.Object {
 		if len(args) != 3 {
@@ -90,7 +93,8 @@ var builtins = map[string]func(ir *IR, local *objectRef.LocalReferences, args ..
 		}
 
 		return &object.Expression{ExpressionType: objectType.DATE,
-			Value: fmt.Sprintf("DATEADD(%s, %s, %s)", interval.Value, num.String(), args[2])}
+			HasNull: anyNullable(args[2]),
+			Node:    &sqlExpr.Call{Name: "DATEADD", Args: []sqlExpr.Node{&sqlExpr.Keyword{Word: interval.Value}, object.NodeOf(num), object.NodeOf(args[2])}}}
 	},
 	"convert": func(ir *IR, local *objectRef.LocalReferences, args ...object.Object) object.Object {
 		if len(args) < 2 {
@@ -108,12 +112,14 @@ var builtins = map[string]func(ir *IR, local *objectRef.LocalReferences, args ..
 
 		if len(args) == 2 {
 			return &object.Expression{ExpressionType: objectType.DATE,
-				Value: fmt.Sprintf("CONVERT(%s, %s)", convert.Value, args[1])}
+				HasNull: anyNullable(args[1]),
+				Node:    &sqlExpr.Call{Name: "CONVERT", Args: []sqlExpr.Node{&sqlExpr.Keyword{Word: convert.Value}, object.NodeOf(args[1])}}}
 		}
 
 		if len(args) == 3 {
 			return &object.Expression{ExpressionType: objectType.DATE,
-				Value: fmt.Sprintf("CONVERT(%s, %s, %s)", convert.Value, args[1], args[2])}
+				HasNull: anyNullable(args[1]),
+				Node:    &sqlExpr.Call{Name: "CONVERT", Args: []sqlExpr.Node{&sqlExpr.Keyword{Word: convert.Value}, object.NodeOf(args[1]), object.NodeOf(args[2])}}}
 		}
 
 		return nil
@@ -128,7 +134,8 @@ var builtins = map[string]func(ir *IR, local *objectRef.LocalReferences, args ..
 		switch {
 		case arg.Type() == objectType.STRING:
 			return &object.Expression{ExpressionType: objectType.DATE,
-				Value: fmt.Sprintf("CONVERT(date, %s, 23)", args[0])}
+				HasNull: anyNullable(arg),
+				Node:    &sqlExpr.Call{Name: "CONVERT", Args: []sqlExpr.Node{&sqlExpr.Keyword{Word: "date"}, object.NodeOf(args[0]), &sqlExpr.Literal{Value: "23"}}}}
 		default:
 			return newError("Invalid Type. %s %s", arg.Type(), arg.String())
 		}
@@ -143,11 +150,43 @@ var builtins = map[string]func(ir *IR, local *objectRef.LocalReferences, args ..
 		switch {
 		case arg.Type() == objectType.STRING:
 			return &object.Expression{ExpressionType: objectType.DATETIME,
-				Value: fmt.Sprintf("CONVERT(date, %s, 127)", args[0])}
+				HasNull: anyNullable(arg),
+				Node:    &sqlExpr.Call{Name: "CONVERT", Args: []sqlExpr.Node{&sqlExpr.Keyword{Word: "date"}, object.NodeOf(args[0]), &sqlExpr.Literal{Value: "127"}}}}
 		default:
 			return newError("Invalid Type. %s %s", arg.Type(), arg.String())
 		}
 	},
+	// descendants(id)
+	"descendants": func(ir *IR, local *objectRef.LocalReferences, args ...object.Object) object.Object {
+		return hierarchyMembers(ir, local, "descendants", args...)
+	},
+	// ancestors(id)
+	"ancestors": func(ir *IR, local *objectRef.LocalReferences, args ...object.Object) object.Object {
+		return hierarchyMembers(ir, local, "ancestors", args...)
+	},
+	// depth()
+	"depth": func(ir *IR, local *objectRef.LocalReferences, args ...object.Object) object.Object {
+		return hierarchyDepth(ir, local, args...)
+	},
+	// daysago(days)
+	"daysago": func(ir *IR, local *objectRef.LocalReferences, args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+
+		days, ok := args[0].(*object.Integer)
+		if !ok {
+			return newError("Invalid Argument Type (Expect Int). %s %s", args[0].Type(), args[0].String())
+		}
+
+		return &object.Expression{ExpressionType: objectType.DATE,
+			Node: &sqlExpr.Call{Name: "DATEADD", Args: []sqlExpr.Node{
+				&sqlExpr.Keyword{Word: "day"},
+				&sqlExpr.Prefix{Operator: "-", Right: object.NodeOf(days)},
+				&sqlExpr.Call{Name: "CAST", Args: []sqlExpr.Node{
+					&sqlExpr.Condition{Operator: "AS", Left: &sqlExpr.Call{Name: "GETDATE"}, Right: &sqlExpr.Keyword{Word: "date"}}}},
+			}}}
+	},
 	//
 	"like": func(ir *IR, local *objectRef.LocalReferences, args ...object.Object) object.Object {
 		if len(args) != 2 {
@@ -160,9 +199,51 @@ var builtins = map[string]func(ir *IR, local *objectRef.LocalReferences, args ..
 		switch {
 		case column.Type() == objectType.STRING:
 			return &object.Expression{ExpressionType: objectType.BOOLEAN,
-				Value: fmt.Sprintf("(%s LIKE %s)", column.String(), comparison.String())}
+				HasNull: anyNullable(column, comparison),
+				Node:    &sqlExpr.Binary{Operator: "LIKE", Left: object.NodeOf(column), Right: object.NodeOf(comparison)}}
 		default:
 			return newError("Invalid Type. %s %s", column.Type(), column.String())
 		}
 	},
 }
+
+// Builtins return NULL when any of their inputs are NULL
+func anyNullable(args ...object.Object) bool {
+	for _, arg := range args {
+		if arg != nil && arg.Nullable() {
+			return true
+		}
+	}
+	return false
+}
+
+// Semi joins evaluate a child query which itself uses builtins,
+// so they are registered at init to avoid an initialization cycle.
+func init() {
+	// exists(join, query)
+	builtins["exists"] = func(ir *IR, local *objectRef.LocalReferences, args ...object.Object) object.Object {
+		return existsBuiltin(ir, local, false, args...)
+	}
+	// notexists(join, query)
+	builtins["notexists"] = func(ir *IR, local *objectRef.LocalReferences, args ...object.Object) object.Object {
+		return existsBuiltin(ir, local, true, args...)
+	}
+}
+
+func existsBuiltin(ir *IR, local *objectRef.LocalReferences, negate bool, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	join, ok := args[0].(*object.String)
+	if !ok {
+		return newError("Invalid Argument Type (Expect String). %s %s", args[0].Type(), args[0].String())
+	}
+
+	query, ok := args[1].(*object.String)
+	if !ok {
+		return newError("Invalid Argument Type (Expect String). %s %s", args[1].Type(), args[1].String())
+	}
+
+	return ir.semiJoin(join.Value, query.Value, negate, local)
+}
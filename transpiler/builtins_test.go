@@ -23,6 +23,8 @@ func TestBuiltinFunctions(t *testing.T) {
 			"SELECT (CONVERT(year, Types.[DateTimeN])) AS [year] FROM dbo.Types"}, // convert function
 		{"AS('utc', timezone(@('DateTimeN'), 'UTC')):",
 			"SELECT (Types.[DateTimeN] AT TIME ZONE 'UTC') AS [utc] FROM dbo.Types"}, // timezone function
+		{"DateN: > daysago(30);",
+			"SELECT Types.[DateN] FROM dbo.Types WHERE (Types.[DateN] > DATEADD(day, -30, CAST(GETDATE() AS date)))"}, // daysago function
 	}
 
 	for _, tt := range tests {
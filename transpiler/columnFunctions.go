@@ -65,11 +65,17 @@ var columnFunctions = map[string]func(ir *IR, args ...object.Object) object.Obje
 			return newError("Cannot exclude already defined field '%s'", string_obj.Value)
 		}
 
-		ir.currentSelectStatement = &sql.SelectField{
+		excluded := &sql.SelectField{
 			Query:     ir.sql,
 			FieldName: &string_obj.Value,
 			TableName: &ir.endpoint.TableName,
 		}
+		if field, ok := ir.endpoint.Fields[string_obj.Value]; ok {
+			excluded.ObjType = field.FieldType
+			excluded.HasNull = field.Nullable || ir.outerParent()
+		}
+
+		ir.currentSelectStatement = excluded
 		return nil
 	},
 }
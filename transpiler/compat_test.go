@@ -0,0 +1,61 @@
+package transpiler
+
+import (
+	"testing"
+)
+
+// Output of the string based SQL rendering, which the expression tree must reproduce byte for byte
+func TestSQLCompatibility(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Int: > 5; Str: == 'a' OR @ == 'b';",
+			"SELECT Types.[Int], Types.[Str] FROM dbo.Types WHERE (Types.[Int] > 5) AND ((Types.[Str] = 'a') OR (Types.[Str] = 'b'))"},
+		{"IntN: == NULL; StrN: != NULL;",
+			"SELECT Types.[IntN], Types.[StrN] FROM dbo.Types WHERE (Types.[IntN] IS NULL) AND (Types.[StrN] IS NOT NULL)"},
+		{"AS('calc', (@('Int') + 2) * 3 - 1): @ > 10;",
+			"SELECT Types.[calc] FROM ( SELECT ((((Types.[Int] + 2) * 3) - 1)) AS [calc] FROM dbo.Types ) AS Types WHERE (Types.[calc] > 10)"},
+		{"Bool: == !TRUE;",
+			"SELECT Types.[Bool] FROM dbo.Types WHERE (Types.[Bool] = !1)"},
+		{"AS('neg', -@('Int')):",
+			"SELECT (-Types.[Int]) AS [neg] FROM dbo.Types"},
+		{"Int: >= 1 AND @ <= 10; AS('half', @('Float') / 2): @ > 1;",
+			"SELECT Types.[Int], Types.[half] FROM ( SELECT Types.[Int], ((Types.[Float] / 2)) AS [half] FROM dbo.Types WHERE ((Types.[Int] >= 1) AND (Types.[Int] <= 10)) ) AS Types WHERE (Types.[half] > 1)"},
+		{"EXCLUDE('Int'): Str:",
+			"SELECT Types.[Str] FROM dbo.Types"},
+		{"GROUP('Str'): COUNT('n', @('Int')): SUM('s', @('Int')): @ > 5;",
+			"SELECT Types.[Str], COUNT(Types.[Int]) AS [n], SUM(Types.[Int]) AS [s] FROM dbo.Types GROUP BY Types.[Str] HAVING (Types.[Int] > 5)"},
+		{"GROUP('g', datepart('year', @('DateTimeN'))): AVG('a', @('Float')):",
+			"SELECT (DATEPART(year, Types.[DateTimeN])) AS [g], AVG(Types.[Float]) AS [a] FROM dbo.Types GROUP BY DATEPART(year, Types.[DateTimeN])"},
+		{"GROUP('Str'): MIN('mi', @('Int')): MAX('ma', @('Int')):",
+			"SELECT Types.[Str], MIN(Types.[Int]) AS [mi], MAX(Types.[Int]) AS [ma] FROM dbo.Types GROUP BY Types.[Str]"},
+		{"StrN: like(@, 'x%') AND len(@) > 2;",
+			"SELECT Types.[StrN] FROM dbo.Types WHERE ((Types.[StrN] LIKE 'x%') AND (LEN(Types.[StrN]) > 2))"},
+		{"DateTimeN: > dateadd('day', 7, date('2025-01-01'));",
+			"SELECT Types.[DateTimeN] FROM dbo.Types WHERE (Types.[DateTimeN] > DATEADD(day, 7, CONVERT(date, '2025-01-01', 23)))"},
+		{"AS('c', convert('varchar', @('Int'), 1)): AS('t', timezone(@('DateTimeN'), 'UTC')):",
+			"SELECT (CONVERT(varchar, Types.[Int], 1)) AS [c], (Types.[DateTimeN] AT TIME ZONE 'UTC') AS [t] FROM dbo.Types"},
+		{"AS('x', cast(@('Int'), 'float')): @ > 1;",
+			"SELECT Types.[x] FROM ( SELECT (CAST( Types.[Int] AS float )) AS [x] FROM dbo.Types ) AS Types WHERE (Types.[x] > 1)"},
+		{"DateN: > daysago(30);",
+			"SELECT Types.[DateN] FROM dbo.Types WHERE (Types.[DateN] > DATEADD(day, -30, CAST(GETDATE() AS date)))"},
+	}
+
+	for _, tt := range tests {
+		ir, err := testNewTypes(tt.input)
+		if err != nil {
+			t.Fatalf("Query test error. [%s] %s\n", tt.input, err.Error())
+		}
+
+		sql_statement, err := ir.EvaluateQuery()
+		if err != nil {
+			t.Errorf("Query test error. [%s] %s\n", tt.input, err.Error())
+			continue
+		}
+
+		if sql_statement != tt.expected {
+			t.Errorf("Query output changed. [%s]\n%s\n%s\n", tt.input, sql_statement, tt.expected)
+		}
+	}
+}
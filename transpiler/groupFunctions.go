@@ -5,6 +5,7 @@ import (
 	"github.com/Team-Solutions-Dental/dyre/object/objectRef"
 	"github.com/Team-Solutions-Dental/dyre/object/objectType"
 	"github.com/Team-Solutions-Dental/dyre/sql"
+	"github.com/Team-Solutions-Dental/dyre/sql/sqlExpr"
 )
 
 var groupFunctions = map[string]func(ir *IR, local *objectRef.LocalReferences, args ...object.Object) object.Object{
@@ -52,10 +53,11 @@ var groupFunctions = map[string]func(ir *IR, local *objectRef.LocalReferences, a
 
 		out := &object.Expression{
 			ExpressionType: objectType.INTEGER,
-			Value:          expression.String(),
+			HasNull:        expression.Nullable(),
+			Node:           object.NodeOf(expression),
 		}
 
-		expr := &sql.SelectGroupExpression{Query: ir.sql, Fn: &fn, Alias: &name_obj.Value, Expression: out}
+		expr := &sql.SelectGroupExpression{Query: ir.sql, Fn: &fn, Alias: &name_obj.Value, Expression: out, HasNull: aggregateNullable(fn, expression)}
 
 		local.Set(expr.Statement(), objectRef.GROUP)
 
@@ -94,10 +96,11 @@ var groupFunctions = map[string]func(ir *IR, local *objectRef.LocalReferences, a
 
 		out := &object.Expression{
 			ExpressionType: objectType.INTEGER,
-			Value:          expression.String(),
+			HasNull:        expression.Nullable(),
+			Node:           object.NodeOf(expression),
 		}
 
-		expr := &sql.SelectGroupExpression{Query: ir.sql, Fn: &fn, Alias: &name_obj.Value, Expression: out}
+		expr := &sql.SelectGroupExpression{Query: ir.sql, Fn: &fn, Alias: &name_obj.Value, Expression: out, HasNull: aggregateNullable(fn, expression)}
 		local.Set(expr.Statement(), objectRef.GROUP)
 
 		ir.currentSelectStatement = expr
@@ -135,10 +138,11 @@ var groupFunctions = map[string]func(ir *IR, local *objectRef.LocalReferences, a
 
 		out := &object.Expression{
 			ExpressionType: objectType.INTEGER,
-			Value:          expression.String(),
+			HasNull:        expression.Nullable(),
+			Node:           object.NodeOf(expression),
 		}
 
-		expr := &sql.SelectGroupExpression{Query: ir.sql, Fn: &fn, Alias: &name_obj.Value, Expression: out}
+		expr := &sql.SelectGroupExpression{Query: ir.sql, Fn: &fn, Alias: &name_obj.Value, Expression: out, HasNull: aggregateNullable(fn, expression)}
 		local.Set(expr.Statement(), objectRef.GROUP)
 
 		ir.currentSelectStatement = expr
@@ -176,10 +180,11 @@ var groupFunctions = map[string]func(ir *IR, local *objectRef.LocalReferences, a
 
 		out := &object.Expression{
 			ExpressionType: objectType.INTEGER,
-			Value:          expression.String(),
+			HasNull:        expression.Nullable(),
+			Node:           object.NodeOf(expression),
 		}
 
-		expr := &sql.SelectGroupExpression{Query: ir.sql, Fn: &fn, Alias: &name_obj.Value, Expression: out}
+		expr := &sql.SelectGroupExpression{Query: ir.sql, Fn: &fn, Alias: &name_obj.Value, Expression: out, HasNull: aggregateNullable(fn, expression)}
 		local.Set(expr.Statement(), objectRef.GROUP)
 
 		ir.currentSelectStatement = expr
@@ -217,10 +222,11 @@ var groupFunctions = map[string]func(ir *IR, local *objectRef.LocalReferences, a
 
 		out := &object.Expression{
 			ExpressionType: objectType.INTEGER,
-			Value:          expression.String(),
+			HasNull:        expression.Nullable(),
+			Node:           object.NodeOf(expression),
 		}
 
-		expr := &sql.SelectGroupExpression{Query: ir.sql, Fn: &fn, Alias: &name_obj.Value, Expression: out}
+		expr := &sql.SelectGroupExpression{Query: ir.sql, Fn: &fn, Alias: &name_obj.Value, Expression: out, HasNull: aggregateNullable(fn, expression)}
 		local.Set(expr.Statement(), objectRef.GROUP)
 
 		ir.currentSelectStatement = expr
@@ -242,6 +248,10 @@ func groupColumn(ir *IR, local *objectRef.LocalReferences, args ...object.Object
 		return newError("Cannot group already defined field '%s'", name.Value)
 	}
 
+	if errObj := ir.refuseDenied(name.Value); errObj != nil {
+		return errObj
+	}
+
 	//groupSelect := &sql.SelectGroupField{FieldName: &name.Value, TableName: &ir.endpoint.TableName}
 	groupSelect := &sql.SelectGroupField{Query: ir.sql}
 
@@ -253,7 +263,7 @@ func groupColumn(ir *IR, local *objectRef.LocalReferences, args ...object.Object
 		groupSelect.FieldName = &name.Value
 		groupSelect.TableName = &ir.endpoint.TableName
 		groupSelect.ObjType = field.Type()
-		groupSelect.HasNull = field.Nullable
+		groupSelect.HasNull = field.Nullable || ir.outerParent()
 	} else if joined_ok {
 		local.Set(joined.Statement(), objectRef.GROUP)
 		groupSelect.Query = ir.sql
@@ -267,7 +277,7 @@ func groupColumn(ir *IR, local *objectRef.LocalReferences, args ...object.Object
 
 	ir.currentSelectStatement = groupSelect
 	ir.sql.SelectStatements = append(ir.sql.SelectStatements, groupSelect)
-	ir.sql.GroupByStatements = append(ir.sql.GroupByStatements, groupSelect.Statement())
+	ir.sql.GroupByStatements = append(ir.sql.GroupByStatements, &sqlExpr.Column{Table: *groupSelect.TableName, Name: *groupSelect.FieldName})
 
 	return nil
 }
@@ -289,7 +299,15 @@ func groupExpression(ir *IR, local *objectRef.LocalReferences, args ...object.Ob
 	local.Set(args[1].String(), objectRef.GROUP)
 	ir.currentSelectStatement = groupSelect
 	ir.sql.SelectStatements = append(ir.sql.SelectStatements, groupSelect)
-	ir.sql.GroupByStatements = append(ir.sql.GroupByStatements, args[1].String())
+	ir.sql.GroupByStatements = append(ir.sql.GroupByStatements, object.NodeOf(args[1]))
 
 	return nil
 }
+
+// COUNT is never NULL. Other aggregates are NULL when every input is NULL
+func aggregateNullable(fn string, expression object.Object) bool {
+	if fn == "COUNT" {
+		return false
+	}
+	return expression.Nullable()
+}
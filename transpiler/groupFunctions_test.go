@@ -1,7 +1,10 @@
 package transpiler
 
 import (
+	"strings"
 	"testing"
+
+	"github.com/Team-Solutions-Dental/dyre/endpoint"
 )
 
 func TestGroupFunctions(t *testing.T) {
@@ -92,3 +95,100 @@ func TestGroupJoins(t *testing.T) {
 		}
 	}
 }
+
+func TestAggregatedJoins(t *testing.T) {
+	tests := []struct {
+		input_x  string
+		input_xy string
+		expected string
+	}{
+		{"x:", "COUNT('n', @('y')):SUM('s', @('b')):",
+			"SELECT X.[x], XYN.[n], XYN.[s] FROM dbo.X LEFT JOIN ( SELECT COUNT(XY.[y]) AS [n], SUM(XY.[b]) AS [s], XY.[a] FROM dbo.XY GROUP BY XY.[a] ) AS XYN ON X.[a] = XYN.[a]"},
+		{"x:", "GROUP('a'):COUNT('n', @('y')):",
+			"SELECT X.[x], XYN.[n] FROM dbo.X LEFT JOIN ( SELECT XY.[a], COUNT(XY.[y]) AS [n] FROM dbo.XY GROUP BY XY.[a] ) AS XYN ON X.[a] = XYN.[a]"},
+	}
+
+	for _, tt := range tests {
+		// Defined in transpiler_test.go
+		x, err := testNewXYZ(tt.input_x)
+		if err != nil {
+			t.Fatalf("testNewXYZ. %s\n", err.Error())
+		}
+
+		_, err = x.LEFTJOIN("XYN").ON("a", "a").Query(tt.input_xy)
+		if err != nil {
+			t.Fatalf("LEFTJOIN XY. %s\n", err.Error())
+		}
+
+		sql_statement, err := x.EvaluateQuery()
+		if err != nil {
+			t.Errorf("x.EvaluateQuery() %s\n", err.Error())
+		}
+
+		if sql_statement != tt.expected {
+			t.Errorf("Aggregated join failed. [%s] [%s]\n%s \n%s\n ", tt.input_x, tt.input_xy, sql_statement, tt.expected)
+		}
+	}
+
+	x, err := testNewXYZ("x:")
+	if err != nil {
+		t.Fatalf("testNewXYZ. %s\n", err.Error())
+	}
+	_, err = x.LEFTJOIN("XYN").ON("a", "a").Query("GROUP('b'):COUNT('a', @('y')):")
+	if err != nil {
+		t.Fatalf("LEFTJOIN XY. %s\n", err.Error())
+	}
+	_, err = x.EvaluateQuery()
+	if err == nil || !strings.Contains(err.Error(), "must be a grouped field") {
+		t.Errorf("expected grouped key error. got=%v", err)
+	}
+}
+
+func TestGroupFanOut(t *testing.T) {
+	tests := []struct {
+		input_x  string
+		input_xy string
+		expected string
+	}{
+		{"GROUP('x'):SUM('s', @('a')):", "y:", "SUM of 'a' would repeat rows across one-to-many join 'XYN'"},
+		{"GROUP('x'):COUNT('n', @('d')):", "y:", "COUNT of 'd' would repeat rows across one-to-many join 'XYN'"},
+		{"GROUP('x'):COUNT('n', @('XYN.y')):", "y:", ""},
+		{"GROUP('x'):SUM('s', @('a')):", "COUNT('n', @('y')):", ""},
+		{"GROUP('x'):SUM('s', @('a')):", "GROUP('a'):COUNT('n', @('y')):", ""},
+		// Grouped by more than the join key the child still has many rows per key
+		{"GROUP('x'):SUM('s', @('a')):", "GROUP('a'):GROUP('b'):COUNT('n', @('y')):", "SUM of 'a' would repeat rows across one-to-many join 'XYN'"},
+	}
+
+	for _, tt := range tests {
+		// Defined in transpiler_test.go
+		x, err := testNewXYZ(tt.input_x)
+		if err != nil {
+			t.Fatalf("testNewXYZ. %s\n", err.Error())
+		}
+
+		_, err = x.LEFTJOIN("XYN").ON("a", "a").CARDINALITY(endpoint.OneToMany).Query(tt.input_xy)
+		if err != nil {
+			t.Fatalf("LEFTJOIN XY. %s\n", err.Error())
+		}
+
+		_, err = x.EvaluateQuery()
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("Unexpected error. [%s] [%s] %s", tt.input_x, tt.input_xy, err.Error())
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("Expected error %q. [%s] [%s] got=%v", tt.expected, tt.input_x, tt.input_xy, err)
+		}
+	}
+
+	x, err := testNewXYZ("x:")
+	if err != nil {
+		t.Fatalf("testNewXYZ. %s\n", err.Error())
+	}
+	_, err = x.LEFTJOIN("XYN").ON("a", "a").CARDINALITY("some").Query("y:")
+	if err == nil || !strings.Contains(err.Error(), "invalid cardinality") {
+		t.Errorf("expected invalid cardinality error. got=%v", err)
+	}
+}
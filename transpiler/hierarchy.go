@@ -0,0 +1,139 @@
+package transpiler
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/Team-Solutions-Dental/dyre/endpoint"
+	"github.com/Team-Solutions-Dental/dyre/object"
+	"github.com/Team-Solutions-Dental/dyre/object/objectRef"
+	"github.com/Team-Solutions-Dental/dyre/object/objectType"
+	"github.com/Team-Solutions-Dental/dyre/sql"
+	"github.com/Team-Solutions-Dental/dyre/sql/sqlExpr"
+)
+
+// Hierarchy of the endpoint with access checked on its id and parent fields
+func (ir *IR) hierarchy() (*endpoint.Hierarchy, object.Object) {
+	h := ir.endpoint.Hierarchy
+	if h == nil {
+		return nil, newError("Endpoint %s has no hierarchy", ir.endpoint.Name)
+	}
+
+	for _, name := range []string{h.ID, h.Parent} {
+		field := ir.endpoint.Fields[name]
+		result := ir.checkFieldSecurity(&field)
+		if isError(result) {
+			return nil, result
+		}
+		if ir.omittedFields[name] {
+			return nil, newError("Hierarchy of %s requires omitted field %s", ir.endpoint.Name, name)
+		}
+		if ir.maskedFields[name] {
+			return nil, newError("Hierarchy of %s requires masked field %s", ir.endpoint.Name, name)
+		}
+	}
+
+	return h, nil
+}
+
+// Recursive CTE of ([ID], [Depth]) rows.
+// anchor selects the first level. Each next level selects the next column of rows whose on column matches the CTE ID.
+// Recursion stops at the hierarchy MaxDepth. Both levels only select rows of the tenant which pass the row filter.
+func (ir *IR) hierarchyCTE(name string, anchor *sql.Select, next string, on string) *sql.CTE {
+	table := ir.endpoint.TableName
+	depth := &sqlExpr.Column{Table: name, Name: "Depth"}
+	recursive := &sql.Select{
+		Columns: []sqlExpr.Node{
+			&sqlExpr.Column{Table: table, Name: next},
+			&sqlExpr.Condition{Operator: "+", Left: depth, Right: &sqlExpr.Literal{Value: "1"}},
+		},
+		From: ir.sql.From,
+		Joins: []*sql.InnerJoin{{Table: name,
+			On: &sqlExpr.Condition{Operator: "=", Left: &sqlExpr.Column{Table: table, Name: on}, Right: &sqlExpr.Column{Table: name, Name: "ID"}}}},
+		Where: append([]sqlExpr.Node{
+			&sqlExpr.Condition{Operator: "<", Left: depth, Right: &sqlExpr.Literal{Value: fmt.Sprintf("%d", ir.endpoint.Hierarchy.MaxDepth)}},
+		}, ir.tableFilters...),
+	}
+
+	return &sql.CTE{
+		Name:    name,
+		Columns: []string{"ID", "Depth"},
+		Query:   sql.UnionAll{anchor, recursive},
+	}
+}
+
+// First level of a hierarchy CTE. Selects the column of rows matching where at depth.
+func (ir *IR) hierarchyAnchor(column string, depth int, where sqlExpr.Node) *sql.Select {
+	return &sql.Select{
+		Columns: []sqlExpr.Node{&sqlExpr.Column{Table: ir.endpoint.TableName, Name: column}, &sqlExpr.Literal{Value: fmt.Sprintf("%d", depth)}},
+		From:    ir.sql.From,
+		Where:   append([]sqlExpr.Node{where}, ir.tableFilters...),
+	}
+}
+
+// descendants(id) and ancestors(id) filter rows related to the given id
+func hierarchyMembers(ir *IR, local *objectRef.LocalReferences, fn string, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	h, errObj := ir.hierarchy()
+	if errObj != nil {
+		return errObj
+	}
+
+	switch args[0].(type) {
+	case *object.Integer, *object.String:
+	default:
+		return newError("Invalid Argument Type (Expect Int or String). %s %s", args[0].Type(), args[0].String())
+	}
+	id := object.NodeOf(args[0])
+
+	hash := fnv.New32a()
+	hash.Write([]byte(id.String()))
+	name := fmt.Sprintf("%s_%s_%08x", ir.endpoint.TableName, fn, hash.Sum32())
+
+	table := ir.endpoint.TableName
+	var cte *sql.CTE
+	switch fn {
+	case "descendants":
+		anchor := ir.hierarchyAnchor(h.ID, 1, &sqlExpr.Condition{Operator: "=", Left: &sqlExpr.Column{Table: table, Name: h.Parent}, Right: id})
+		cte = ir.hierarchyCTE(name, anchor, h.ID, h.Parent)
+	case "ancestors":
+		anchor := ir.hierarchyAnchor(h.Parent, 1, &sqlExpr.Condition{Operator: "=", Left: &sqlExpr.Column{Table: table, Name: h.ID}, Right: id})
+		cte = ir.hierarchyCTE(name, anchor, h.Parent, h.ID)
+	}
+	ir.sql.CTEs = append(ir.sql.CTEs, cte)
+
+	local.Set(h.ID, objectRef.FIELD)
+	return &object.Expression{ExpressionType: objectType.BOOLEAN,
+		Node: &sqlExpr.InQuery{
+			Left:  &sqlExpr.Column{Table: table, Name: h.ID},
+			Query: &sqlExpr.SubQuery{Query: &sql.Select{Columns: []sqlExpr.Node{&sqlExpr.Column{Table: name, Name: "ID"}}, From: name}},
+		}}
+}
+
+// depth() of each row from its root, NULL beyond the maximum depth
+func hierarchyDepth(ir *IR, local *objectRef.LocalReferences, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+
+	h, errObj := ir.hierarchy()
+	if errObj != nil {
+		return errObj
+	}
+
+	table := ir.endpoint.TableName
+	name := table + "_depth"
+	anchor := ir.hierarchyAnchor(h.ID, 0, &sqlExpr.Condition{Operator: "IS", Left: &sqlExpr.Column{Table: table, Name: h.Parent}, Right: &sqlExpr.Literal{Value: "NULL"}})
+	ir.sql.CTEs = append(ir.sql.CTEs, ir.hierarchyCTE(name, anchor, h.ID, h.Parent))
+
+	local.Set(h.ID, objectRef.FIELD)
+	return &object.Expression{ExpressionType: objectType.INTEGER, HasNull: true,
+		Node: &sqlExpr.SubQuery{Query: &sql.Select{
+			Columns: []sqlExpr.Node{&sqlExpr.Call{Name: "MIN", Args: []sqlExpr.Node{&sqlExpr.Column{Table: name, Name: "Depth"}}}},
+			From:    name,
+			Where:   []sqlExpr.Node{&sqlExpr.Condition{Operator: "=", Left: &sqlExpr.Column{Table: name, Name: "ID"}, Right: &sqlExpr.Column{Table: table, Name: h.ID}}},
+		}}}
+}
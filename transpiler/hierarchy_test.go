@@ -0,0 +1,147 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Team-Solutions-Dental/dyre/endpoint"
+)
+
+func testNewOrgs(input string) (*PrimaryIR, error) {
+	configJSON := `[
+		{"name": "Orgs", "tableName": "Orgs", "schemaName": "dbo",
+		 "fields": [{"name": "OrgID", "type": "int", "nullable": false}, {"name": "ParentID", "type": "int"}, "Name"],
+		 "hierarchy": {"id": "OrgID", "parent": "ParentID", "maxDepth": 5}},
+		{"name": "Flat", "tableName": "Flat", "schemaName": "dbo", "fields": ["Name"]}
+	]`
+	configured, err := endpoint.ParseJSON([]byte(configJSON))
+	if err != nil {
+		return nil, err
+	}
+
+	return New(input, configured.Endpoints["Orgs"])
+}
+
+func TestHierarchyFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Name: descendants(1);",
+			"WITH Orgs_descendants_340ca71c ([ID], [Depth]) AS ( SELECT Orgs.[OrgID], 1 FROM dbo.Orgs WHERE Orgs.[ParentID] = 1 UNION ALL SELECT Orgs.[OrgID], Orgs_descendants_340ca71c.[Depth] + 1 FROM dbo.Orgs INNER JOIN Orgs_descendants_340ca71c ON Orgs.[ParentID] = Orgs_descendants_340ca71c.[ID] WHERE Orgs_descendants_340ca71c.[Depth] < 5 ) SELECT Orgs.[Name] FROM dbo.Orgs WHERE Orgs.[OrgID] IN (SELECT Orgs_descendants_340ca71c.[ID] FROM Orgs_descendants_340ca71c)"},
+		{"Name: ancestors(1);",
+			"WITH Orgs_ancestors_340ca71c ([ID], [Depth]) AS ( SELECT Orgs.[ParentID], 1 FROM dbo.Orgs WHERE Orgs.[OrgID] = 1 UNION ALL SELECT Orgs.[ParentID], Orgs_ancestors_340ca71c.[Depth] + 1 FROM dbo.Orgs INNER JOIN Orgs_ancestors_340ca71c ON Orgs.[OrgID] = Orgs_ancestors_340ca71c.[ID] WHERE Orgs_ancestors_340ca71c.[Depth] < 5 ) SELECT Orgs.[Name] FROM dbo.Orgs WHERE Orgs.[OrgID] IN (SELECT Orgs_ancestors_340ca71c.[ID] FROM Orgs_ancestors_340ca71c)"},
+		{"Name: AS('Level', depth()):",
+			"WITH Orgs_depth ([ID], [Depth]) AS ( SELECT Orgs.[OrgID], 0 FROM dbo.Orgs WHERE Orgs.[ParentID] IS NULL UNION ALL SELECT Orgs.[OrgID], Orgs_depth.[Depth] + 1 FROM dbo.Orgs INNER JOIN Orgs_depth ON Orgs.[ParentID] = Orgs_depth.[ID] WHERE Orgs_depth.[Depth] < 5 ) SELECT Orgs.[Name], ((SELECT MIN(Orgs_depth.[Depth]) FROM Orgs_depth WHERE Orgs_depth.[ID] = Orgs.[OrgID])) AS [Level] FROM dbo.Orgs"},
+	}
+
+	for _, tt := range tests {
+		ir, err := testNewOrgs(tt.input)
+		if err != nil {
+			t.Fatalf("Query test error. [%s] %s\n", tt.input, err.Error())
+		}
+
+		evaluated, err := ir.EvaluateQuery()
+		if err != nil {
+			t.Errorf("Query test error. [%s] %s\n", tt.input, err.Error())
+			continue
+		}
+
+		if evaluated != tt.expected {
+			t.Errorf("Hierarchy failed. [%s]\n%s\n%s\n", tt.input, evaluated, tt.expected)
+		}
+	}
+}
+
+func TestHierarchyInJoin(t *testing.T) {
+	ir, err := testNewOrgs("Name:")
+	if err != nil {
+		t.Fatalf("testNewOrgs. %s\n", err.Error())
+	}
+
+	_, err = ir.LEFTJOIN("Orgs").AS("Parent").ON("ParentID", "OrgID").Query("AS('ParentName', @('Name')): depth() > 1;")
+	if err != nil {
+		t.Fatalf("LEFTJOIN Orgs. %s\n", err.Error())
+	}
+
+	evaluated, err := ir.EvaluateQuery()
+	if err != nil {
+		t.Fatalf("EvaluateQuery. %s\n", err.Error())
+	}
+
+	// CTEs of joined queries are hoisted to the top level query
+	if !strings.HasPrefix(evaluated, "WITH Orgs_depth ([ID], [Depth]) AS (") || strings.Count(evaluated, "WITH") != 1 {
+		t.Errorf("expected a single hoisted WITH clause. got=%s", evaluated)
+	}
+}
+
+func TestHierarchyErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Name: descendants(@('OrgID'));", "Expect Int or String"},
+		{"Name: descendants();", "wrong number of arguments"},
+		{"Name: depth(1) > 0;", "wrong number of arguments"},
+	}
+
+	for _, tt := range tests {
+		ir, err := testNewOrgs(tt.input)
+		if err != nil {
+			t.Fatalf("Query test error. [%s] %s\n", tt.input, err.Error())
+		}
+
+		_, err = ir.EvaluateQuery()
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("Expected error containing %q for [%s]. got=%v", tt.expected, tt.input, err)
+		}
+	}
+
+	ir, err := testNewOrgs("Name:")
+	if err != nil {
+		t.Fatalf("testNewOrgs. %s\n", err.Error())
+	}
+	_, err = ir.INNERJOIN("Flat").ON("Name", "Name").Query("Name: depth() > 1;")
+	if err != nil {
+		t.Fatalf("INNERJOIN Flat. %s\n", err.Error())
+	}
+	_, err = ir.EvaluateQuery()
+	if err == nil || !strings.Contains(err.Error(), "Endpoint Flat has no hierarchy") {
+		t.Errorf("expected missing hierarchy error. got=%v", err)
+	}
+}
+
+func TestHierarchyTableFilters(t *testing.T) {
+	service, err := endpoint.ParseJSON([]byte(`[
+		{"name": "Orgs", "tableName": "Orgs",
+		 "fields": [{"name": "OrgID", "type": "int", "nullable": false}, {"name": "ParentID", "type": "int"}, "TenantID", "Region"],
+		 "rowFilter": "@('Region') == $principal.region",
+		 "hierarchy": {"id": "OrgID", "parent": "ParentID", "maxDepth": 5}}
+	]`))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if err = service.SetTenantColumns(map[string]string{"Orgs": "TenantID"}); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	ir, err := NewWithOptions("OrgID: descendants(1);", service.Endpoints["Orgs"],
+		Options{Tenant: 7, Principal: endpoint.PrincipalMap{"region": "east"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	evaluated, err := ir.EvaluateQuery()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Both the anchor and the recursive member only reach rows of the tenant which pass the row filter
+	expected := "WITH Orgs_descendants_340ca71c ([ID], [Depth]) AS ( " +
+		"SELECT Orgs.[OrgID], 1 FROM Orgs WHERE Orgs.[ParentID] = 1 AND (Orgs.[TenantID] = 7) AND (Orgs.[Region] = 'east') UNION ALL " +
+		"SELECT Orgs.[OrgID], Orgs_descendants_340ca71c.[Depth] + 1 FROM Orgs INNER JOIN Orgs_descendants_340ca71c ON Orgs.[ParentID] = Orgs_descendants_340ca71c.[ID] " +
+		"WHERE Orgs_descendants_340ca71c.[Depth] < 5 AND (Orgs.[TenantID] = 7) AND (Orgs.[Region] = 'east') ) " +
+		"SELECT Orgs.[OrgID] FROM Orgs WHERE (Orgs.[TenantID] = 7) AND (Orgs.[Region] = 'east') AND Orgs.[OrgID] IN (SELECT Orgs_descendants_340ca71c.[ID] FROM Orgs_descendants_340ca71c)"
+	if evaluated != expected {
+		t.Errorf("wrong sql.\nexpected=%s\ngot=     %s", expected, evaluated)
+	}
+}
@@ -1,9 +1,16 @@
 package transpiler
 
 import (
+	"errors"
 	"fmt"
+	"github.com/Team-Solutions-Dental/dyre/ast"
 	"github.com/Team-Solutions-Dental/dyre/endpoint"
+	"github.com/Team-Solutions-Dental/dyre/object"
+	"github.com/Team-Solutions-Dental/dyre/object/objectRef"
+	"github.com/Team-Solutions-Dental/dyre/object/objectType"
 	"github.com/Team-Solutions-Dental/dyre/sql"
+	"github.com/Team-Solutions-Dental/dyre/sql/sqlExpr"
+	"github.com/Team-Solutions-Dental/dyre/utils"
 	"strings"
 )
 
@@ -19,13 +26,14 @@ func (ir *IR) AUTOJOIN(joinPrefix string, joinEndpointName string) (*joinIR, err
 	}
 
 	autojoin := &joinIR{
-		joinType: joinPrefix,
-		parentIR: ir,
-		name:     joinEndpointName,
-		parentOn: endpointJoin.Parent_ON,
-		childOn:  endpointJoin.Child_ON,
-		endpoint: endpointJoin.ChildEndpoint(),
-		alias:    joinEndpointName,
+		joinType:    joinPrefix,
+		parentIR:    ir,
+		name:        endpointJoin.EndpointName(),
+		ons:         append([]endpoint.JoinOn{}, endpointJoin.Keys()...),
+		filter:      endpointJoin.Filter,
+		endpoint:    endpointJoin.ChildEndpoint(),
+		alias:       endpointJoin.Name(),
+		cardinality: endpointJoin.Cardinality,
 	}
 
 	return autojoin, nil
@@ -45,6 +53,35 @@ func (ir *IR) LEFTJOIN(req string) *joinType {
 	return join
 }
 
+func (ir *IR) RIGHTJOIN(req string) *joinType {
+	join := &joinType{joinType: "RIGHT", parentIR: ir, name: req}
+
+	return join
+}
+
+func (ir *IR) FULLJOIN(req string) *joinType {
+	join := &joinType{joinType: "FULL", parentIR: ir, name: req}
+
+	return join
+}
+
+// Join a child query evaluated per parent row.
+// Parent rows without child rows are removed.
+// The child query can use LIMIT and OrderBy. Ex. latest 3 appointments per patient
+func (ir *IR) CROSSAPPLY(req string) *joinType {
+	join := &joinType{joinType: "CROSS APPLY", parentIR: ir, name: req}
+
+	return join
+}
+
+// Join a child query evaluated per parent row.
+// Parent rows without child rows are kept with NULL child columns.
+func (ir *IR) OUTERAPPLY(req string) *joinType {
+	join := &joinType{joinType: "OUTER APPLY", parentIR: ir, name: req}
+
+	return join
+}
+
 func (ir *IR) LIMIT(input int) *IR {
 	ir.sql.Limit = &input
 	return ir
@@ -54,31 +91,80 @@ type joinType struct {
 	joinType string
 	parentIR *IR
 	name     string
+	alias    string
+}
+
+// Reference the joined endpoint by an alias.
+// Ex. INNERJOIN("Providers").AS("Dentist")
+func (jt *joinType) AS(alias string) *joinType {
+	jt.alias = alias
+	return jt
 }
 
 func (jt *joinType) ON(parent_on, on string) *joinIR {
+	alias := jt.alias
+	if alias == "" {
+		alias = jt.name
+	}
 	return &joinIR{
 		joinType: jt.joinType,
 		parentIR: jt.parentIR,
-		parentOn: parent_on,
-		childOn:  on,
+		ons:      []endpoint.JoinOn{{Parent: parent_on, Child: on}},
 		name:     jt.name,
-		alias:    jt.name,
+		alias:    alias,
 	}
 }
 
 type joinIR struct {
-	name     string
-	alias    string
-	parentIR *IR
-	childIR  *SubIR
-	endpoint *endpoint.Endpoint
-	parentOn string
-	childOn  string
-	joinType string
+	name      string
+	alias     string
+	parentIR  *IR
+	childIR   *SubIR
+	endpoint  *endpoint.Endpoint
+	ons       []endpoint.JoinOn
+	filter    string
+	filterAST *ast.RequestStatements
+	joinType  string
+	statement *sql.JoinStatement
+	// Relationship from parent to child rows. Ex. endpoint.OneToMany
+	cardinality string
+}
+
+// Reference the joined endpoint by an alias
+func (js *joinIR) AS(alias string) *joinIR {
+	js.alias = alias
+	return js
+}
+
+// Add an additional key pair to the join
+// Ex. ON("ClinicID", "ClinicID").AND("PatientID", "PatientID")
+func (js *joinIR) AND(parent_on, on string) *joinIR {
+	js.ons = append(js.ons, endpoint.JoinOn{Parent: parent_on, Child: on})
+	return js
+}
+
+// Add a fixed dyre expression to the child of the join
+// Ex. FILTER("@('Active') == TRUE")
+func (js *joinIR) FILTER(filter string) *joinIR {
+	if js.filter == "" {
+		js.filter = filter
+	} else {
+		js.filter = js.filter + ";" + filter
+	}
+	return js
+}
+
+// Set the relationship from parent to child rows
+// Ex. CARDINALITY(endpoint.OneToMany)
+func (js *joinIR) CARDINALITY(cardinality string) *joinIR {
+	js.cardinality = cardinality
+	return js
 }
 
 func (js *joinIR) Query(query string) (*SubIR, error) {
+	if !endpoint.ValidCardinality(js.cardinality) {
+		return nil, fmt.Errorf("Join %s has invalid cardinality '%s'", js.alias, js.cardinality)
+	}
 
 	ep, err := js.parentIR.endpoint.Service.GetEndpoint(js.name)
 	if err != nil {
@@ -87,21 +173,63 @@ func (js *joinIR) Query(query string) (*SubIR, error) {
 
 	js.endpoint = ep
 
-	js.childIR, err = newSubIRWithSecurity(query, js.endpoint, js.parentIR.securityChecker)
-	if err != nil {
-		return nil, err
+	if js.alias == js.parentIR.endpoint.TableName {
+		return nil, fmt.Errorf("Join alias '%s' conflicts with table '%s'. Provide a different alias", js.alias, js.parentIR.endpoint.TableName)
+	}
+
+	for _, j := range append(append([]*joinIR{}, js.parentIR.joins...), js.parentIR.omittedJoins...) {
+		if j.alias == js.alias {
+			return nil, fmt.Errorf("Join alias '%s' already used on endpoint '%s'", js.alias, js.parentIR.endpoint.Name)
+		}
+	}
+
+	omit, errObj := js.parentIR.checkJoinOperation(js.alias, js.name)
+	if errObj != nil {
+		return nil, errors.New(errObj.(*object.Error).Message)
+	}
+	if omit {
+		js.childIR = omittedSubIR(js.endpoint, js.parentIR.security)
+	} else {
+		js.childIR, err = newSubIRWithSecurity(query, js.endpoint, js.parentIR.security)
+		if err != nil {
+			return nil, err
+		}
+		js.childIR.nestKeys = js.parentIR.nestKeys
+	}
+
+	if js.isApply() {
+		if js.endpoint.TableName == js.parentIR.endpoint.TableName {
+			return nil, fmt.Errorf("Apply join '%s' cannot correlate table '%s' to itself", js.alias, js.endpoint.TableName)
+		}
+		js.childIR.lateral = true
+	}
+
+	// Omitted joins are not rendered, so they neither filter nor repeat parent rows
+	if js.childIR.omitted {
+		js.parentIR.omittedJoins = append(js.parentIR.omittedJoins, js)
+		return js.childIR, nil
+	}
+
+	if js.filter != "" {
+		js.filterAST, err = parse(js.filter)
+		if err != nil {
+			return nil, fmt.Errorf("Join %s filter, %w", js.alias, err)
+		}
 	}
 
+	js.addTenantOn()
 	js.parentIR.joins = append(js.parentIR.joins, js)
 
 	joinStmnt := &sql.JoinStatement{
 		JoinType:     &js.joinType,
 		Parent_Query: js.parentIR.sql,
 		Child_Query:  js.childIR.sql,
-		Parent_On:    &js.parentOn,
-		Child_On:     &js.childOn,
-		Alias:        &js.name,
+		Alias:        &js.alias,
 	}
+	for _, on := range js.ons {
+		joinStmnt.Conditions = append(joinStmnt.Conditions, sql.JoinCondition{Parent_On: on.Parent, Child_On: on.Child})
+	}
+	js.statement = joinStmnt
 
 	// if js.parentIR.sql.SelectStatements == nil {
 	//
@@ -118,27 +246,225 @@ func (js *joinIR) Query(query string) (*SubIR, error) {
 	return js.childIR, nil
 }
 
-// Make sure that the select statement needed for joining is on the child table
+func (js *joinIR) isApply() bool {
+	return js.joinType == "CROSS APPLY" || js.joinType == "OUTER APPLY"
+}
+
+// Evaluate the order by of an apply join child
+func (js *joinIR) evalOrderBy() object.Object {
+	if js.childIR.orderByAST == nil {
+		return nil
+	}
+
+	if js.childIR.sql.Limit == nil || *js.childIR.sql.Limit <= 0 {
+		return newError("Order By on apply join '%s' requires a LIMIT", js.alias)
+	}
+
+	return evalOrderBy(js.childIR.orderByAST, &js.childIR.IR)
+}
+
+// Child rows are not collapsed to one per parent row.
+// A child grouped by nothing but the join keys has one row per key so it does not multiply parent rows.
+func (js *joinIR) multipliesRows() bool {
+	return endpoint.ToMany(js.cardinality) && !(js.childIR.grouped() && js.groupedByOns())
+}
+
+// Every GROUP BY of the child is a join key. Check adds the keys missing from the GROUP BY.
+func (js *joinIR) groupedByOns() bool {
+	ons := js.childOns()
+	for _, n := range js.childIR.sql.GroupByStatements {
+		column, ok := n.(*sqlExpr.Column)
+		if !ok || !utils.Array_Contains(ons, column.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// Refuse aggregates of parent fields across joins that repeat parent rows
+func (ir *IR) checkFanOut(fn string, refs *objectRef.LocalReferences) object.Object {
+	for _, j := range ir.joins {
+		if !j.multipliesRows() {
+			continue
+		}
+		for _, id := range refs.IDs() {
+			if _, ok := ir.endpoint.Fields[id]; ok {
+				return newError("%s of '%s' would repeat rows across %s join '%s'", fn, id, j.cardinality, j.alias)
+			}
+		}
+	}
+	return nil
+}
+
+// Names of the child columns joined on
+func (js *joinIR) childOns() []string {
+	var ons []string
+	for _, on := range js.ons {
+		ons = append(ons, on.Child)
+	}
+	return ons
+}
+
+// Evaluate the fixed join filter as where statements on the child table
+func (js *joinIR) evalFilter() object.Object {
+	if js.filterAST == nil {
+		return nil
+	}
+
+	// Filters cannot use the @ shorthand of the child query
+	current := js.childIR.currentSelectStatement
+	js.childIR.currentSelectStatement = nil
+	js.childIR.trusted = true
+	defer func() {
+		js.childIR.currentSelectStatement = current
+		js.childIR.trusted = false
+	}()
+
+	for _, stmnt := range js.filterAST.Statements {
+		if _, ok := stmnt.(*ast.ExpressionStatement); !ok {
+			return newError("Join %s filter may only contain expressions. got=%s", js.alias, stmnt.String())
+		}
+	}
+
+	return eval(js.filterAST, &js.childIR.IR, objectRef.NewLocalReferences())
+}
+
+// Make sure that the select statements needed for joining are on the child table
 func (js *joinIR) Check() error {
-	childLoc := js.childIR.sql.SelectStatementLocation(js.childOn)
-	if childLoc < 0 {
-		childField := js.childIR.endpoint.Fields[js.childOn]
-		ss := childField.SelectStatement()
-		ss.Query = js.childIR.sql
-		js.childIR.sql.SelectStatements = append(js.childIR.sql.SelectStatements, ss)
-	}
-
-	parentLoc := js.parentIR.sql.SelectStatementLocation(js.parentOn)
-	if parentLoc < 0 {
-		_, ok := js.parentIR.endpoint.Fields[js.parentOn]
-		if !ok {
-			return fmt.Errorf("No field '%s' found to join on endpoint '%s'", js.parentOn, js.parentIR.endpoint.Name)
+	if len(js.ons) == 0 {
+		return fmt.Errorf("Join '%s' has no columns to join on", js.alias)
+	}
+
+	for _, on := range js.ons {
+		childLoc := js.childIR.sql.SelectStatementLocation(on.Child)
+		if childLoc < 0 {
+			childField, ok := js.childIR.endpoint.Fields[on.Child]
+			if !ok {
+				return fmt.Errorf("No field '%s' found to join on endpoint '%s'", on.Child, js.childIR.endpoint.Name)
+			}
+			if js.childIR.grouped() {
+				// Pre-aggregated child is grouped by the join key so the parent keeps one row per key
+				groupSelect := &sql.SelectGroupField{
+					Query:     js.childIR.sql,
+					FieldName: &childField.Name,
+					TableName: &js.childIR.endpoint.TableName,
+					ObjType:   childField.Type(),
+					HasNull:   childField.Nullable,
+				}
+				js.childIR.sql.SelectStatements = append(js.childIR.sql.SelectStatements, groupSelect)
+				js.childIR.sql.GroupByStatements = append(js.childIR.sql.GroupByStatements, &sqlExpr.Column{Table: *groupSelect.TableName, Name: *groupSelect.FieldName})
+				continue
+			}
+			ss := childField.SelectStatement()
+			ss.Query = js.childIR.sql
+			js.childIR.sql.SelectStatements = append(js.childIR.sql.SelectStatements, ss)
+		} else if js.childIR.maskedFields[on.Child] {
+			return fmt.Errorf("Join '%s' key '%s' is masked", js.alias, on.Child)
+		} else if js.childIR.grouped() && js.childIR.sql.SelectStatements[childLoc].Type() != "GROUP_FIELD" {
+			return fmt.Errorf("Join '%s' key '%s' must be a grouped field", js.alias, on.Child)
+		}
+
+		parentLoc := js.parentIR.sql.SelectStatementLocation(on.Parent)
+		if parentLoc < 0 {
+			_, ok := js.parentIR.endpoint.Fields[on.Parent]
+			if !ok {
+				return fmt.Errorf("No field '%s' found to join on endpoint '%s'", on.Parent, js.parentIR.endpoint.Name)
+			}
 		}
 	}
 
 	return nil
 }
 
+// Filter the parent on the existence of rows in a configured join.
+// The child query is evaluated as a SubIR but is never joined into the parent.
+// Ex. exists('Appointments', 'Date: > daysago(365);')
+func (ir *IR) semiJoin(joinName string, query string, negate bool, local *objectRef.LocalReferences) object.Object {
+	endpointJoin, ok := ir.endpoint.Joins[joinName]
+	if !ok {
+		return newError("Endpoint %s does not contain join %s", ir.endpoint.Name, joinName)
+	}
+
+	if endpointJoin.ChildEndpoint() == nil {
+		return newError("Join %s has no endpoint", joinName)
+	}
+
+	js := &joinIR{
+		joinType: "EXISTS",
+		parentIR: ir,
+		name:     endpointJoin.EndpointName(),
+		ons:      append([]endpoint.JoinOn{}, endpointJoin.Keys()...),
+		filter:   endpointJoin.Filter,
+		endpoint: endpointJoin.ChildEndpoint(),
+		alias:    endpointJoin.Name(),
+	}
+
+	if js.alias == ir.endpoint.TableName {
+		return newError("Join alias '%s' conflicts with table '%s'", js.alias, ir.endpoint.TableName)
+	}
+
+	omit, errObj := ir.checkJoinOperation(js.alias, js.name)
+	if errObj != nil {
+		return errObj
+	}
+	if omit {
+		return newError("Cannot filter on omitted join %s", js.alias)
+	}
+
+	var err error
+	js.childIR, err = newSubIRWithSecurity(query, js.endpoint, ir.security)
+	if err != nil {
+		return newError("%s", err.Error())
+	}
+
+	if js.childIR.omitted {
+		return newError("Cannot filter on omitted endpoint %s", js.endpoint.Name)
+	}
+
+	if js.filter != "" {
+		js.filterAST, err = parse(js.filter)
+		if err != nil {
+			return newError("Join %s filter, %s", js.alias, err.Error())
+		}
+	}
+
+	result := js.childIR.evalTable()
+	if isError(result) {
+		return result
+	}
+
+	result = js.evalFilter()
+	if isError(result) {
+		return result
+	}
+
+	js.addTenantOn()
+	js.statement = &sql.JoinStatement{
+		JoinType:     &js.joinType,
+		Parent_Query: ir.sql,
+		Child_Query:  js.childIR.sql,
+		Alias:        &js.alias,
+	}
+	for _, on := range js.ons {
+		js.statement.Conditions = append(js.statement.Conditions, sql.JoinCondition{Parent_On: on.Parent, Child_On: on.Child})
+		local.Set(on.Parent, objectRef.FIELD)
+	}
+
+	err = js.Check()
+	if err != nil {
+		return newError("%s", err.Error())
+	}
+
+	ir.sql.CTEs = append(ir.sql.CTEs, js.childIR.sql.AllCTEs()...)
+	for _, rf := range js.childIR.rowFilters {
+		ir.rowFilters = append(ir.rowFilters, rf.under(js.alias))
+	}
+	ir.semiJoins = append(ir.semiJoins, js)
+
+	return &object.Expression{ExpressionType: objectType.BOOLEAN,
+		Node: &sqlExpr.Exists{Not: negate, Query: js.statement.ExistsQuery()}}
+}
+
 func JoinPrefixEval(input string) (string, error) {
 	input = strings.ToUpper(input)
 	switch input {
@@ -150,6 +476,10 @@ func JoinPrefixEval(input string) (string, error) {
 		return "RIGHT", nil
 	case "FULL":
 		return "FULL", nil
+	case "CROSS APPLY", "CROSSAPPLY":
+		return "CROSS APPLY", nil
+	case "OUTER APPLY", "OUTERAPPLY":
+		return "OUTER APPLY", nil
 	default:
 		return "INNER", fmt.Errorf("Invalid Join Prefix %s", input)
 	}
@@ -1,6 +1,7 @@
 package transpiler
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/Team-Solutions-Dental/dyre/endpoint"
@@ -120,3 +121,392 @@ func TestDoubleJoins(t *testing.T) {
 	}
 
 }
+
+func TestCompositeJoins(t *testing.T) {
+	tests := []struct {
+		input_parent string
+		input_join   string
+		filter       string
+		expected     string
+	}{
+		{"intx:string:", "bool:", "",
+			"SELECT Parent.[intx], Parent.[string], Join.[bool] FROM dbo.Parent INNER JOIN ( SELECT JoinTable.[bool], JoinTable.[inty], JoinTable.[str] FROM dbo.JoinTable ) AS Join ON Parent.[intx] = Join.[inty] AND Parent.[string] = Join.[str]",
+		},
+		{"intx:", "bool:", "@('bool') == TRUE",
+			"SELECT Parent.[intx], Join.[bool] FROM dbo.Parent INNER JOIN ( SELECT JoinTable.[bool], JoinTable.[inty], JoinTable.[str] FROM dbo.JoinTable WHERE (JoinTable.[bool] = 1) ) AS Join ON Parent.[intx] = Join.[inty] AND Parent.[string] = Join.[str]",
+		},
+	}
+
+	for _, tt := range tests {
+		parent_ir, err := testNewParent(tt.input_parent)
+		if err != nil {
+			t.Fatalf("Query test error. %s\n", err)
+		}
+		addTestJoinColumn(parent_ir.endpoint.Service.Endpoints["Join"], "str", objectType.STRING)
+
+		join := parent_ir.INNERJOIN("Join").ON("intx", "inty").AND("string", "str")
+		if tt.filter != "" {
+			join.FILTER(tt.filter)
+		}
+		_, err = join.Query(tt.input_join)
+		if err != nil {
+			t.Fatalf("Query test error. [%s] %v\n", tt.input_parent, err)
+		}
+
+		evaluated, err := parent_ir.EvaluateQuery()
+		if err != nil {
+			t.Errorf("Test Composite Join Error. %s\n", err.Error())
+		}
+
+		if evaluated != tt.expected {
+			t.Errorf("Test Composite Join Failed. [%s] [%s]\n%s \n%s\n ", tt.input_parent, tt.input_join, evaluated, tt.expected)
+		}
+	}
+}
+
+func TestAutoJoinFromConfig(t *testing.T) {
+	configJSON := `[
+		{"name": "Parent", "tableName": "Parent", "schemaName": "dbo", "fields": [{"name": "intx", "type": "int"}, "string"],
+		 "joins": [{"endpoint": "Join", "on": [["intx", "inty"], ["string", "str"]], "filter": "@('bool') == FALSE"}]},
+		{"name": "Join", "tableName": "JoinTable", "schemaName": "dbo", "fields": [{"name": "inty", "type": "int"}, {"name": "bool", "type": "bool"}, "str"]}
+	]`
+	configured, err := endpoint.ParseJSON([]byte(configJSON))
+	if err != nil {
+		t.Fatalf("ParseJSON error. %s\n", err)
+	}
+
+	ir, err := New("intx:", configured.Endpoints["Parent"])
+	if err != nil {
+		t.Fatalf("Query test error. %s\n", err)
+	}
+	join, err := ir.AUTOJOIN("LEFT", "Join")
+	if err != nil {
+		t.Fatalf("AUTOJOIN error. %s\n", err)
+	}
+	_, err = join.Query("bool:")
+	if err != nil {
+		t.Fatalf("AUTOJOIN query error. %s\n", err)
+	}
+
+	evaluated, err := ir.EvaluateQuery()
+	if err != nil {
+		t.Fatalf("AUTOJOIN evaluate error. %s\n", err)
+	}
+
+	expected := "SELECT Parent.[intx], Join.[bool] FROM dbo.Parent LEFT JOIN ( SELECT JoinTable.[bool], JoinTable.[inty], JoinTable.[str] FROM dbo.JoinTable WHERE (JoinTable.[bool] = 0) ) AS Join ON Parent.[intx] = Join.[inty] AND Parent.[string] = Join.[str]"
+	if evaluated != expected {
+		t.Errorf("AUTOJOIN failed.\n%s\n%s\n", evaluated, expected)
+	}
+}
+
+func TestJoinMissingKey(t *testing.T) {
+	parent_ir, err := testNewParent("intx:")
+	if err != nil {
+		t.Fatalf("Query test error. %s\n", err)
+	}
+
+	_, err = parent_ir.INNERJOIN("Join").ON("intx", "inty").AND("string", "missing").Query("bool:")
+	if err != nil {
+		t.Fatalf("Query test error. %s\n", err)
+	}
+
+	_, err = parent_ir.EvaluateQuery()
+	if err == nil || !strings.Contains(err.Error(), "No field 'missing'") {
+		t.Errorf("expected missing join key error. got=%v", err)
+	}
+}
+
+func addTestJoinColumn(ep *endpoint.Endpoint, name string, objType objectType.Type) {
+	ep.FieldNames = append(ep.FieldNames, name)
+	ep.Fields[name] = endpoint.Field{Endpoint: ep, Name: name, FieldType: objType}
+}
+
+func TestJoinAliases(t *testing.T) {
+	parent_ir, err := testNewParent("intx:AS('DentistBool', @('Dentist.bool')):")
+	if err != nil {
+		t.Fatalf("Query test error. %s\n", err)
+	}
+
+	_, err = parent_ir.LEFTJOIN("Join").AS("Dentist").ON("intx", "inty").Query("bool:")
+	if err != nil {
+		t.Fatalf("Dentist join error. %s\n", err)
+	}
+	_, err = parent_ir.LEFTJOIN("Join").AS("Hygienist").ON("intx", "inty").Query("AS('HygienistBool', @('bool')):")
+	if err != nil {
+		t.Fatalf("Hygienist join error. %s\n", err)
+	}
+
+	evaluated, err := parent_ir.EvaluateQuery()
+	if err != nil {
+		t.Fatalf("Join alias evaluate error. %s\n", err)
+	}
+
+	expected := "SELECT Parent.[intx], (Dentist.[bool]) AS [DentistBool], Dentist.[bool], Hygienist.[HygienistBool] FROM dbo.Parent" +
+		" LEFT JOIN ( SELECT JoinTable.[bool], JoinTable.[inty] FROM dbo.JoinTable ) AS Dentist ON Parent.[intx] = Dentist.[inty]" +
+		"  LEFT JOIN ( SELECT (JoinTable.[bool]) AS [HygienistBool], JoinTable.[inty] FROM dbo.JoinTable ) AS Hygienist ON Parent.[intx] = Hygienist.[inty]"
+	if evaluated != expected {
+		t.Errorf("Join alias failed.\n%s\n%s\n", evaluated, expected)
+	}
+}
+
+func TestJoinAliasConflicts(t *testing.T) {
+	parent_ir, err := testNewParent("intx:")
+	if err != nil {
+		t.Fatalf("Query test error. %s\n", err)
+	}
+
+	_, err = parent_ir.INNERJOIN("Join").ON("intx", "inty").Query("bool:")
+	if err != nil {
+		t.Fatalf("Join error. %s\n", err)
+	}
+
+	_, err = parent_ir.INNERJOIN("Join").ON("intx", "inty").Query("bool:")
+	if err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Errorf("expected duplicate alias error. got=%v", err)
+	}
+
+	_, err = parent_ir.INNERJOIN("Join").AS("Parent").ON("intx", "inty").Query("bool:")
+	if err == nil || !strings.Contains(err.Error(), "conflicts with table") {
+		t.Errorf("expected table conflict error. got=%v", err)
+	}
+}
+
+func TestOuterJoins(t *testing.T) {
+	tests := []struct {
+		join     func(ir *PrimaryIR) *joinType
+		expected string
+	}{
+		{func(ir *PrimaryIR) *joinType { return ir.RIGHTJOIN("Join") },
+			"SELECT Parent.[intx], Join.[bool] FROM dbo.Parent RIGHT JOIN ( SELECT JoinTable.[bool], JoinTable.[inty] FROM dbo.JoinTable ) AS Join ON Parent.[intx] = Join.[inty]"},
+		{func(ir *PrimaryIR) *joinType { return ir.FULLJOIN("Join") },
+			"SELECT Parent.[intx], Join.[bool] FROM dbo.Parent FULL JOIN ( SELECT JoinTable.[bool], JoinTable.[inty] FROM dbo.JoinTable ) AS Join ON Parent.[intx] = Join.[inty]"},
+	}
+
+	for _, tt := range tests {
+		parent_ir, err := testNewParent("intx:")
+		if err != nil {
+			t.Fatalf("Query test error. %s\n", err)
+		}
+
+		_, err = tt.join(parent_ir).ON("intx", "inty").Query("bool:")
+		if err != nil {
+			t.Fatalf("Join error. %s\n", err)
+		}
+
+		evaluated, err := parent_ir.EvaluateQuery()
+		if err != nil {
+			t.Fatalf("Join evaluate error. %s\n", err)
+		}
+
+		if evaluated != tt.expected {
+			t.Errorf("Outer join failed.\n%s\n%s\n", evaluated, tt.expected)
+		}
+	}
+}
+
+func TestApplyJoins(t *testing.T) {
+	parent_ir, err := testNewParent("intx:")
+	if err != nil {
+		t.Fatalf("Query test error. %s\n", err)
+	}
+
+	child, err := parent_ir.CROSSAPPLY("Join").AS("Latest").ON("intx", "inty").Query("bool:")
+	if err != nil {
+		t.Fatalf("Apply join error. %s\n", err)
+	}
+	child.LIMIT(3)
+	err = child.OrderBy("inty: DESC")
+	if err != nil {
+		t.Fatalf("Apply join order by error. %s\n", err)
+	}
+
+	evaluated, err := parent_ir.EvaluateQuery()
+	if err != nil {
+		t.Fatalf("Apply join evaluate error. %s\n", err)
+	}
+
+	expected := "SELECT Parent.[intx], Latest.[bool] FROM dbo.Parent CROSS APPLY ( SELECT TOP 3 JoinTable.[bool], JoinTable.[inty] FROM dbo.JoinTable WHERE JoinTable.[inty] = Parent.[intx] ORDER BY inty DESC ) AS Latest"
+	if evaluated != expected {
+		t.Errorf("Apply join failed.\n%s\n%s\n", evaluated, expected)
+	}
+}
+
+func TestApplyJoinOrderByRequiresLimit(t *testing.T) {
+	parent_ir, err := testNewParent("intx:")
+	if err != nil {
+		t.Fatalf("Query test error. %s\n", err)
+	}
+
+	child, err := parent_ir.OUTERAPPLY("Join").ON("intx", "inty").Query("bool:")
+	if err != nil {
+		t.Fatalf("Apply join error. %s\n", err)
+	}
+	err = child.OrderBy("inty: DESC")
+	if err != nil {
+		t.Fatalf("Apply join order by error. %s\n", err)
+	}
+
+	_, err = parent_ir.EvaluateQuery()
+	if err == nil || !strings.Contains(err.Error(), "requires a LIMIT") {
+		t.Errorf("expected LIMIT error. got=%v", err)
+	}
+
+	inner, err := testNewParent("intx:")
+	if err != nil {
+		t.Fatalf("Query test error. %s\n", err)
+	}
+	child, err = inner.INNERJOIN("Join").ON("intx", "inty").Query("bool:")
+	if err != nil {
+		t.Fatalf("Join error. %s\n", err)
+	}
+	err = child.OrderBy("inty: DESC")
+	if err == nil || !strings.Contains(err.Error(), "requires an apply join") {
+		t.Errorf("expected apply join error. got=%v", err)
+	}
+}
+
+func TestOuterJoinChildNullable(t *testing.T) {
+	tests := []struct {
+		join     func(ir *PrimaryIR) *joinType
+		nullable bool
+	}{
+		{func(ir *PrimaryIR) *joinType { return ir.INNERJOIN("Join") }, false},
+		{func(ir *PrimaryIR) *joinType { return ir.LEFTJOIN("Join") }, true},
+		{func(ir *PrimaryIR) *joinType { return ir.RIGHTJOIN("Join") }, false},
+		{func(ir *PrimaryIR) *joinType { return ir.FULLJOIN("Join") }, true},
+		{func(ir *PrimaryIR) *joinType { return ir.CROSSAPPLY("Join") }, false},
+		{func(ir *PrimaryIR) *joinType { return ir.OUTERAPPLY("Join") }, true},
+	}
+
+	for _, tt := range tests {
+		parent_ir, err := testNewParent("intx:")
+		if err != nil {
+			t.Fatalf("Query test error. %s\n", err)
+		}
+
+		_, err = tt.join(parent_ir).ON("intx", "inty").Query("bool:")
+		if err != nil {
+			t.Fatalf("Join error. %s\n", err)
+		}
+
+		_, err = parent_ir.EvaluateQuery()
+		if err != nil {
+			t.Fatalf("Join evaluate error. %s\n", err)
+		}
+
+		joined := parent_ir.sql.SelectStatements[1]
+		if joined.Nullable() != tt.nullable {
+			t.Errorf("%s join child nullable. got=%t want=%t", parent_ir.joins[0].joinType, joined.Nullable(), tt.nullable)
+		}
+	}
+}
+
+func testNewPatients(input string) (*PrimaryIR, error) {
+	configJSON := `[
+		{"name": "Patients", "tableName": "Patients", "schemaName": "dbo",
+		 "fields": [{"name": "PatientID", "type": "int", "nullable": false}, "Name", {"name": "ClinicID", "type": "int"}],
+		 "joins": [
+			{"endpoint": "Appointments", "on": "PatientID"},
+			{"endpoint": "Appointments", "alias": "Missed", "on": "PatientID", "filter": "@('Status') == 'missed'"}
+		 ]},
+		{"name": "Appointments", "tableName": "Appointments", "schemaName": "dbo",
+		 "fields": [{"name": "PatientID", "type": "int"}, {"name": "Date", "type": "date"}, "Status"]}
+	]`
+	configured, err := endpoint.ParseJSON([]byte(configJSON))
+	if err != nil {
+		return nil, err
+	}
+
+	return New(input, configured.Endpoints["Patients"])
+}
+
+func TestSemiJoins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Name: exists('Appointments', 'Date: > daysago(365);');",
+			"SELECT Patients.[Name] FROM dbo.Patients WHERE EXISTS ( SELECT 1 FROM ( SELECT Appointments.[Date], Appointments.[PatientID] FROM dbo.Appointments WHERE (Appointments.[Date] > DATEADD(day, -365, CAST(GETDATE() AS date))) ) AS Appointments WHERE Patients.[PatientID] = Appointments.[PatientID] )"},
+		{"Name: notexists('Appointments', '');",
+			"SELECT Patients.[Name] FROM dbo.Patients WHERE NOT EXISTS ( SELECT 1 FROM ( SELECT Appointments.[PatientID] FROM dbo.Appointments ) AS Appointments WHERE Patients.[PatientID] = Appointments.[PatientID] )"},
+		{"Name: exists('Missed', '') AND @('ClinicID') == 1;",
+			"SELECT Patients.[Name] FROM dbo.Patients WHERE (EXISTS ( SELECT 1 FROM ( SELECT Appointments.[PatientID] FROM dbo.Appointments WHERE (Appointments.[Status] = 'missed') ) AS Missed WHERE Patients.[PatientID] = Missed.[PatientID] ) AND (Patients.[ClinicID] = 1))"},
+	}
+
+	for _, tt := range tests {
+		ir, err := testNewPatients(tt.input)
+		if err != nil {
+			t.Fatalf("Query test error. [%s] %s\n", tt.input, err.Error())
+		}
+
+		evaluated, err := ir.EvaluateQuery()
+		if err != nil {
+			t.Errorf("Query test error. [%s] %s\n", tt.input, err.Error())
+			continue
+		}
+
+		if evaluated != tt.expected {
+			t.Errorf("Semi join failed. [%s]\n%s\n%s\n", tt.input, evaluated, tt.expected)
+		}
+	}
+}
+
+func TestSemiJoinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Name: exists('Invoices', '');", "does not contain join Invoices"},
+		{"Name: exists('Appointments', 'Missing:');", "Missing"},
+		{"Name: exists('Appointments');", "wrong number of arguments"},
+	}
+
+	for _, tt := range tests {
+		ir, err := testNewPatients(tt.input)
+		if err != nil {
+			t.Fatalf("Query test error. [%s] %s\n", tt.input, err.Error())
+		}
+
+		_, err = ir.EvaluateQuery()
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("Expected error containing %q for [%s]. got=%v", tt.expected, tt.input, err)
+		}
+	}
+}
+
+func TestCTEMode(t *testing.T) {
+	// Defined in transpiler_test.go
+	x, err := testNewXYZ("x:AS('ax', @('a') + 1): @ > 2;")
+	if err != nil {
+		t.Fatalf("testNewXYZ. %s\n", err.Error())
+	}
+
+	xy, err := x.LEFTJOIN("XYN").ON("a", "a").Query("y:AS('by', @('b') * 2): @ > 1;")
+	if err != nil {
+		t.Fatalf("LEFTJOIN XY. %s\n", err.Error())
+	}
+
+	_, err = xy.INNERJOIN("YZN").ON("b", "b").Query("z:")
+	if err != nil {
+		t.Fatalf("INNERJOIN YZ. %s\n", err.Error())
+	}
+
+	_, err = x.OUTERAPPLY("YZN").AS("Latest").ON("a", "c").Query("AS('lz', @('z')):")
+	if err != nil {
+		t.Fatalf("OUTERAPPLY YZ. %s\n", err.Error())
+	}
+
+	evaluated, err := x.CTEMode(true).EvaluateQuery()
+	if err != nil {
+		t.Fatalf("x.EvaluateQuery() %s\n", err.Error())
+	}
+
+	expected := "WITH YZN_cte AS ( SELECT YZ.[z], YZ.[b] FROM dbo.YZ ), " +
+		"XYN_base_cte AS ( SELECT XY.[y], ((XY.[b] * 2)) AS [by], YZN.[z], XY.[a] FROM dbo.XY INNER JOIN YZN_cte AS YZN ON XY.[b] = YZN.[b] ), " +
+		"XYN_cte AS ( SELECT XYN.[y], XYN.[by], XYN.[z], XYN.[a] FROM XYN_base_cte AS XYN WHERE (XYN.[by] > 1) ), " +
+		"XN_base_cte AS ( SELECT X.[x], ((X.[a] + 1)) AS [ax], XYN.[y], XYN.[by], XYN.[z], Latest.[lz] FROM dbo.X LEFT JOIN XYN_cte AS XYN ON X.[a] = XYN.[a]  OUTER APPLY ( SELECT (YZ.[z]) AS [lz], YZ.[c] FROM dbo.YZ WHERE YZ.[c] = X.[a] ) AS Latest ) " +
+		"SELECT XN.[x], XN.[ax], XN.[y], XN.[by], XN.[z], XN.[lz] FROM XN_base_cte AS XN WHERE (XN.[ax] > 2)"
+	if evaluated != expected {
+		t.Errorf("CTE mode failed.\n%s\n%s\n", evaluated, expected)
+	}
+}
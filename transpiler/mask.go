@@ -0,0 +1,90 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Team-Solutions-Dental/dyre/endpoint"
+	"github.com/Team-Solutions-Dental/dyre/object"
+	"github.com/Team-Solutions-Dental/dyre/object/objectType"
+	"github.com/Team-Solutions-Dental/dyre/sql"
+	"github.com/Team-Solutions-Dental/dyre/sql/sqlExpr"
+)
+
+// Masked value of a denied field selected under the field name.
+// "mask" returns NULL or the placeholder, "partial" reveals the characters of the pattern.
+// Ex. ('***-**-' + RIGHT(Patients.[SSN], 4)) AS [SSN]
+func (ir *IR) maskedSelect(field *endpoint.Field, policy *endpoint.SecurityPolicy) *sql.SelectExpression {
+	expression := &object.Expression{ExpressionType: field.FieldType, HasNull: true, Node: &sqlExpr.Literal{Value: "NULL"}}
+
+	switch {
+	case policy.OnDeny == "partial":
+		// Pattern is validated when the endpoint is parsed
+		pattern, _ := endpoint.ParseMaskPattern(policy.Pattern)
+		text := &sqlExpr.Literal{Value: maskLiteral(pattern.Text)}
+		shown := &sqlExpr.Literal{Value: fmt.Sprintf("%d", pattern.Shown)}
+		column := &sqlExpr.Column{Table: ir.endpoint.TableName, Name: field.Name}
+		expression.ExpressionType = objectType.STRING
+		expression.HasNull = field.Nullable || ir.outerParent()
+		if pattern.Leading {
+			expression.Node = &sqlExpr.Binary{Operator: "+", Left: &sqlExpr.Call{Name: "LEFT", Args: []sqlExpr.Node{column, shown}}, Right: text}
+		} else {
+			expression.Node = &sqlExpr.Binary{Operator: "+", Left: text, Right: &sqlExpr.Call{Name: "RIGHT", Args: []sqlExpr.Node{column, shown}}}
+		}
+	case policy.Mask != "":
+		// The placeholder is returned for NULL values too so nulls are not revealed
+		expression.ExpressionType = objectType.STRING
+		expression.HasNull = ir.outerParent()
+		expression.Node = &sqlExpr.Literal{Value: maskLiteral(policy.Mask)}
+	}
+
+	name := field.Name
+	return &sql.SelectExpression{Query: ir.sql, Expression: expression, Alias: &name, HasNull: expression.HasNull}
+}
+
+func maskLiteral(text string) string {
+	return "'" + strings.ReplaceAll(text, "'", "''") + "'"
+}
+
+// Denied fields cannot be filtered, sorted or grouped so their values cannot be probed.
+// Row filters and join filters of the endpoint config may use them.
+func (ir *IR) refuseDenied(name string) object.Object {
+	if ir.trusted {
+		return nil
+	}
+	policy, errObj := ir.denied(name)
+	if errObj != nil || policy == nil {
+		return errObj
+	}
+	switch {
+	case policy.Masks():
+		return newError("Field %s is masked and cannot be filtered, sorted or grouped", name)
+	case policy.OnDeny == "omit":
+		return newError("Field %s is omitted and cannot be filtered, sorted or grouped", name)
+	}
+	return newError("permission denied for field %s: requires %s", name, policy)
+}
+
+// Policy denying the current user a field of the endpoint or of a join, ex. 'Invoices.Balance'
+func (ir *IR) denied(name string) (*endpoint.SecurityPolicy, object.Object) {
+	if field, ok := ir.endpoint.Fields[name]; ok {
+		if errObj := ir.denyUnannotated(&field); errObj != nil {
+			return nil, errObj
+		}
+		return ir.deniedPolicy(&field)
+	}
+
+	alias, child, qualified := strings.Cut(name, ".")
+	for _, j := range ir.joins {
+		if !qualified {
+			child = name
+		} else if j.alias != alias {
+			continue
+		}
+		policy, errObj := j.childIR.denied(child)
+		if policy != nil || errObj != nil {
+			return policy, errObj
+		}
+	}
+	return nil, nil
+}
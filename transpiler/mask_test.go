@@ -0,0 +1,208 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Team-Solutions-Dental/dyre/endpoint"
+	"github.com/Team-Solutions-Dental/dyre/object/objectType"
+)
+
+func testNewMasked() *endpoint.Service {
+	service := &endpoint.Service{
+		Settings: endpoint.Settings{BracketedColumns: true},
+	}
+
+	patients := &endpoint.Endpoint{
+		Service:   service,
+		Name:      "Patients",
+		TableName: "Patients",
+		Fields: map[string]endpoint.Field{
+			"PatientID": {Name: "PatientID", FieldType: objectType.INTEGER},
+			"Name":      {Name: "Name", FieldType: objectType.STRING, Nullable: true},
+			"SSN": {Name: "SSN", FieldType: objectType.STRING, Nullable: true,
+				Security: &endpoint.SecurityPolicy{Permissions: []string{"patients:ssn"}, OnDeny: "partial", Pattern: "***-**-####"}},
+			"Phone": {Name: "Phone", FieldType: objectType.STRING, Nullable: true,
+				Security: &endpoint.SecurityPolicy{Permissions: []string{"patients:phone"}, OnDeny: "mask", Mask: "(hidden)"}},
+			"Balance": {Name: "Balance", FieldType: objectType.FLOAT, Nullable: true,
+				Security: &endpoint.SecurityPolicy{Permissions: []string{"patients:balance"}, OnDeny: "mask"}},
+		},
+		FieldNames: []string{"PatientID", "Name", "SSN", "Phone", "Balance"},
+	}
+
+	visits := &endpoint.Endpoint{
+		Service:   service,
+		Name:      "Visits",
+		TableName: "Visits",
+		Fields: map[string]endpoint.Field{
+			"VisitID":   {Name: "VisitID", FieldType: objectType.INTEGER},
+			"PatientID": {Name: "PatientID", FieldType: objectType.INTEGER},
+			"Notes": {Name: "Notes", FieldType: objectType.STRING, Nullable: true,
+				Security: &endpoint.SecurityPolicy{Permissions: []string{"visits:notes"}, OnDeny: "mask"}},
+		},
+		FieldNames: []string{"VisitID", "PatientID", "Notes"},
+	}
+
+	for _, ep := range []*endpoint.Endpoint{patients, visits} {
+		for name, field := range ep.Fields {
+			field.Endpoint = ep
+			ep.Fields[name] = field
+		}
+	}
+
+	join := endpoint.Join{}
+	join.Parent_ON = "PatientID"
+	join.Child_ON = "PatientID"
+	patients.Joins = map[string]endpoint.Join{"Visits": join}
+	patients.JoinNames = []string{"Visits"}
+
+	service.Endpoints = map[string]*endpoint.Endpoint{"Patients": patients, "Visits": visits}
+	service.EndpointNames = []string{"Patients", "Visits"}
+
+	return service
+}
+
+func TestMaskedFields(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{
+			"SSN:",
+			"SELECT (('***-**-' + RIGHT(Patients.[SSN], 4))) AS [SSN] FROM Patients",
+		},
+		{
+			"Phone:",
+			"SELECT ('(hidden)') AS [Phone] FROM Patients",
+		},
+		{
+			"Name:Balance:",
+			"SELECT Patients.[Name], (NULL) AS [Balance] FROM Patients",
+		},
+	}
+
+	service := testNewMasked()
+	checker := endpoint.NewStaticChecker(map[string]struct{}{})
+
+	for _, tt := range tests {
+		ir, err := NewWithSecurity(tt.query, service.Endpoints["Patients"], checker)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sql, err := ir.EvaluateQuery()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.query, err)
+		}
+		if sql != tt.expected {
+			t.Errorf("%s: wrong sql.\nexpected=%s\ngot=     %s", tt.query, tt.expected, sql)
+		}
+	}
+}
+
+func TestMaskedFieldsAllowed(t *testing.T) {
+	checker := endpoint.NewStaticChecker(map[string]struct{}{"patients:ssn": {}})
+
+	ir, err := NewWithSecurity("SSN: == '123-45-6789';", testNewMasked().Endpoints["Patients"], checker)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sql, err := ir.EvaluateQuery()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "SELECT Patients.[SSN] FROM Patients WHERE (Patients.[SSN] = '123-45-6789')"
+	if sql != expected {
+		t.Errorf("wrong sql.\nexpected=%s\ngot=     %s", expected, sql)
+	}
+}
+
+func TestMaskedJoinedFields(t *testing.T) {
+	service := testNewMasked()
+	checker := endpoint.NewStaticChecker(map[string]struct{}{})
+
+	ir, err := NewWithSecurity("PatientID:", service.Endpoints["Patients"], checker)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = ir.LEFTJOIN("Visits").ON("PatientID", "PatientID").Query("VisitID:Notes:"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sql, err := ir.EvaluateQuery()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(sql, "(NULL) AS [Notes]") {
+		t.Errorf("expected Notes to be masked in the joined query. got=%s", sql)
+	}
+	if !strings.Contains(sql, "Visits.[Notes]") {
+		t.Errorf("expected masked Notes to be returned under the same name. got=%s", sql)
+	}
+}
+
+func TestMaskedFieldsRefused(t *testing.T) {
+	tests := []struct {
+		query   string
+		join    string
+		orderBy string
+		err     string
+	}{
+		{"SSN: == '123-45-6789';", "", "", "Field SSN is masked and cannot be filtered, sorted or grouped"},
+		{"Name: @('Phone') == '555';", "", "", "Field Phone is masked and cannot be filtered, sorted or grouped"},
+		{"Name:", "", "Balance:", "Field Balance is masked and cannot be filtered, sorted or grouped"},
+		{"GROUP('SSN'):", "", "", "Field SSN is masked and cannot be filtered, sorted or grouped"},
+		{"PatientID:", "Notes:", "Notes:", "Field Notes is masked and cannot be filtered, sorted or grouped"},
+		{"PatientID: @('Visits.Notes') == 'x';", "Notes:", "", "Field Visits.Notes is masked and cannot be filtered, sorted or grouped"},
+		{"PatientID:", "Notes: == 'x';", "", "Field Notes is masked and cannot be filtered, sorted or grouped"},
+	}
+
+	service := testNewMasked()
+	checker := endpoint.NewStaticChecker(map[string]struct{}{})
+
+	for _, tt := range tests {
+		ir, err := NewWithSecurity(tt.query, service.Endpoints["Patients"], checker)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if tt.join != "" {
+			if _, err = ir.LEFTJOIN("Visits").ON("PatientID", "PatientID").Query(tt.join); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if tt.orderBy != "" {
+			if err = ir.OrderBy(tt.orderBy); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		_, err = ir.EvaluateQuery()
+		if err == nil {
+			t.Errorf("%s: expected error %q", tt.query, tt.err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: wrong error. expected=%q, got=%q", tt.query, tt.err, err.Error())
+		}
+	}
+}
+
+func TestMaskedFieldsInRowFilter(t *testing.T) {
+	service := testNewMasked()
+	service.Endpoints["Patients"].RowFilter = "@('SSN') != null;"
+	checker := endpoint.NewStaticChecker(map[string]struct{}{})
+
+	ir, err := NewWithSecurity("Name:", service.Endpoints["Patients"], checker)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sql, err := ir.EvaluateQuery()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "SELECT Patients.[Name] FROM Patients WHERE (Patients.[SSN] IS NOT NULL)"
+	if sql != expected {
+		t.Errorf("wrong sql.\nexpected=%s\ngot=     %s", expected, sql)
+	}
+}
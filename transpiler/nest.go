@@ -0,0 +1,272 @@
+package transpiler
+
+import (
+	"fmt"
+
+	"github.com/Team-Solutions-Dental/dyre/endpoint"
+	"github.com/Team-Solutions-Dental/dyre/object"
+	"github.com/Team-Solutions-Dental/dyre/object/objectRef"
+	"github.com/Team-Solutions-Dental/dyre/utils"
+)
+
+// Position of a result column in the join tree
+type nestColumn struct {
+	path   []string // Join aliases from the primary endpoint
+	name   string
+	key    bool // Join key rows of the endpoint are grouped by
+	hidden bool // Selected only as a key. Left out of documents
+}
+
+func (nc nestColumn) under(alias string) nestColumn {
+	nc.path = append([]string{alias}, nc.path...)
+	return nc
+}
+
+// Parent columns of the joins that can repeat parent rows. Nest groups rows by them.
+func (ir *IR) nestKeyNames() []string {
+	if ir.sql.RefLevel >= objectRef.GROUP {
+		return nil
+	}
+	var names []string
+	for _, j := range ir.joins {
+		if endpoint.ToOne(j.cardinality) {
+			continue
+		}
+		for _, on := range j.ons {
+			if !utils.Array_Contains(names, on.Parent) {
+				names = append(names, on.Parent)
+			}
+		}
+	}
+	return names
+}
+
+// Select the join keys missing from the select so Nest can group rows by them
+func (ir *IR) selectNestKeys() (map[string]bool, object.Object) {
+	hidden := map[string]bool{}
+	for _, name := range ir.nestKeyNames() {
+		if ir.sql.SelectStatementLocation(name) >= 0 {
+			continue
+		}
+		field, ok := ir.endpoint.Fields[name]
+		if !ok {
+			continue
+		}
+		if errObj := ir.checkFieldSecurity(&field); errObj != nil {
+			return nil, errObj
+		}
+		if ir.omittedFields[name] || ir.maskedFields[name] {
+			return nil, newError("Nest requires join key %s of %s which is not readable", name, ir.endpoint.Name)
+		}
+		ss := field.SelectStatement()
+		ss.Query = ir.sql
+		ir.sql.SelectStatements = append(ir.sql.SelectStatements, ss)
+		hidden[name] = true
+	}
+	return hidden, nil
+}
+
+// Columns of one endpoint in the join tree
+type nestNode struct {
+	alias    string
+	columns  []int // Row index of columns returned in documents
+	names    []string
+	keys     []int // Row index of the join keys
+	keyNames []string
+	others   []int // Row index of columns outside the node and its children
+	children []*nestNode
+	ir       *IR
+	toOne    bool // Nested as an object instead of an array
+}
+
+func (nn *nestNode) child(alias string) *nestNode {
+	for _, c := range nn.children {
+		if c.alias == alias {
+			return c
+		}
+	}
+	c := &nestNode{alias: alias}
+	for _, j := range nn.ir.joins {
+		if j.alias == alias {
+			c.ir = &j.childIR.IR
+			c.toOne = endpoint.ToOne(j.cardinality)
+		}
+	}
+	nn.children = append(nn.children, c)
+	return c
+}
+
+// All columns owned by the node or its children are NULL. Ex. LEFT JOIN without a match
+func (nn *nestNode) empty(row []any) bool {
+	for _, i := range append(append([]int{}, nn.columns...), nn.keys...) {
+		if row[i] != nil {
+			return false
+		}
+	}
+	for _, c := range nn.children {
+		if !c.empty(row) {
+			return false
+		}
+	}
+	return true
+}
+
+// Row indexes owned by the node or its children
+func (nn *nestNode) subtree() map[int]bool {
+	owned := map[int]bool{}
+	for _, i := range append(append([]int{}, nn.columns...), nn.keys...) {
+		owned[i] = true
+	}
+	for _, c := range nn.children {
+		for i := range c.subtree() {
+			owned[i] = true
+		}
+	}
+	return owned
+}
+
+// Check the node has the join keys its rows are grouped by, and find the columns outside each child
+func (nn *nestNode) prepare(width int) error {
+	if nn.ir != nil {
+		for _, name := range nn.ir.nestKeyNames() {
+			if !utils.Array_Contains(nn.keyNames, name) {
+				return fmt.Errorf("Nest requires join key %s of %s. Select it or evaluate with the Nest option", name, nn.ir.endpoint.Name)
+			}
+		}
+	}
+
+	for _, c := range nn.children {
+		owned := c.subtree()
+		c.others = nil
+		for i := range width {
+			if !owned[i] {
+				c.others = append(c.others, i)
+			}
+		}
+		if err := c.prepare(width); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rowKey(row []any, columns []int) string {
+	values := make([]any, len(columns))
+	for i, col := range columns {
+		values[i] = row[col]
+	}
+	return fmt.Sprintf("%#v", values)
+}
+
+// Objects built for a node, kept in row order
+type nestObjects struct {
+	keys    map[string]*nestObject
+	objects []*nestObject
+}
+
+type nestObject struct {
+	values   map[string]any
+	children map[string]*nestObjects
+	// Values of the columns outside each child when the child was first read
+	anchors map[string]string
+}
+
+// Rows of a node with join keys are grouped into one object per key.
+// Other rows are appended as they come, so equal rows are kept.
+func (nos *nestObjects) fold(node *nestNode, row []any) {
+	var obj *nestObject
+	key := rowKey(row, node.keys)
+	if len(node.keys) > 0 {
+		obj = nos.keys[key]
+	}
+	if obj == nil {
+		obj = &nestObject{values: map[string]any{}, children: map[string]*nestObjects{}, anchors: map[string]string{}}
+		for i, col := range node.columns {
+			obj.values[node.names[i]] = row[col]
+		}
+		for _, c := range node.children {
+			obj.children[c.alias] = &nestObjects{keys: map[string]*nestObject{}}
+		}
+		if len(node.keys) > 0 {
+			nos.keys[key] = obj
+		}
+		nos.objects = append(nos.objects, obj)
+	}
+
+	for _, c := range node.children {
+		if c.empty(row) {
+			continue
+		}
+		// Other joins of the parent repeat the child rows. Only read them with the first values of the other columns
+		others := rowKey(row, c.others)
+		if anchor, ok := obj.anchors[c.alias]; !ok {
+			obj.anchors[c.alias] = others
+		} else if anchor != others {
+			continue
+		}
+		obj.children[c.alias].fold(c, row)
+	}
+}
+
+func (nos *nestObjects) documents(node *nestNode) []map[string]any {
+	docs := []map[string]any{}
+	for _, obj := range nos.objects {
+		doc := obj.values
+		for _, c := range node.children {
+			children := obj.children[c.alias].documents(c)
+			if !c.toOne {
+				doc[c.alias] = children
+			} else if len(children) > 0 {
+				doc[c.alias] = children[0]
+			} else {
+				doc[c.alias] = nil
+			}
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// Fold flat result rows into one document per parent row with an array per join.
+// To-one joins are nested as a single object or nil.
+// Parents are grouped by the join keys of their to-many joins, which the Nest option selects when they are not.
+// Rows must be in the column order of FieldNames.
+// Run Evaluate Query First!
+func (pir *PrimaryIR) Nest(rows [][]any) ([]map[string]any, error) {
+	return pir.nest(rows)
+}
+
+func (ir *IR) nest(rows [][]any) ([]map[string]any, error) {
+	if ir.sql.From == "" {
+		return nil, fmt.Errorf("Query must be evaluated before nesting")
+	}
+
+	root := &nestNode{ir: ir}
+	for i, col := range ir.columns {
+		node := root
+		for _, alias := range col.path {
+			node = node.child(alias)
+		}
+		if !col.hidden {
+			node.columns = append(node.columns, i)
+			node.names = append(node.names, col.name)
+		}
+		if col.key {
+			node.keys = append(node.keys, i)
+			node.keyNames = append(node.keyNames, col.name)
+		}
+	}
+	if err := root.prepare(len(ir.columns)); err != nil {
+		return nil, err
+	}
+
+	objects := &nestObjects{keys: map[string]*nestObject{}}
+	for r, row := range rows {
+		if len(row) != len(ir.columns) {
+			return nil, fmt.Errorf("Row %d has %d columns. want=%d", r, len(row), len(ir.columns))
+		}
+		objects.fold(root, row)
+	}
+
+	return objects.documents(root), nil
+}
@@ -0,0 +1,202 @@
+package transpiler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Team-Solutions-Dental/dyre/endpoint"
+)
+
+func TestNest(t *testing.T) {
+	// Defined in transpiler_test.go
+	x, err := testNewXYZ("x:a:")
+	if err != nil {
+		t.Fatalf("testNewXYZ. %s\n", err.Error())
+	}
+
+	xy, err := x.LEFTJOIN("XYN").ON("a", "a").Query("y:b:")
+	if err != nil {
+		t.Fatalf("LEFTJOIN XY. %s\n", err.Error())
+	}
+
+	_, err = xy.LEFTJOIN("YZN").ON("b", "b").Query("z:")
+	if err != nil {
+		t.Fatalf("LEFTJOIN YZ. %s\n", err.Error())
+	}
+
+	_, err = x.Nest(nil)
+	if err == nil {
+		t.Errorf("expected error nesting before evaluation")
+	}
+
+	_, err = x.EvaluateQuery()
+	if err != nil {
+		t.Fatalf("x.EvaluateQuery() %s\n", err.Error())
+	}
+
+	expectedNames := []string{"x", "a", "y", "b", "z"}
+	if !reflect.DeepEqual(x.FieldNames(), expectedNames) {
+		t.Fatalf("unexpected field names %v", x.FieldNames())
+	}
+
+	rows := [][]any{
+		{"x1", 1, "y1", 10, "z1"},
+		{"x1", 1, "y1", 10, "z2"},
+		{"x1", 1, "y2", 11, nil},
+		{"x2", 2, nil, nil, nil},
+	}
+
+	nested, err := x.Nest(rows)
+	if err != nil {
+		t.Fatalf("x.Nest() %s\n", err.Error())
+	}
+
+	expected := []map[string]any{
+		{"x": "x1", "a": 1, "XYN": []map[string]any{
+			{"y": "y1", "b": 10, "YZN": []map[string]any{{"z": "z1"}, {"z": "z2"}}},
+			{"y": "y2", "b": 11, "YZN": []map[string]any{}},
+		}},
+		{"x": "x2", "a": 2, "XYN": []map[string]any{}},
+	}
+
+	if !reflect.DeepEqual(nested, expected) {
+		t.Errorf("Nest failed.\n%v\n%v\n", nested, expected)
+	}
+
+	_, err = x.Nest([][]any{{"x1", 1}})
+	if err == nil || !strings.Contains(err.Error(), "has 2 columns") {
+		t.Errorf("expected column count error. got=%v", err)
+	}
+}
+
+func TestNestKeys(t *testing.T) {
+	// Defined in transpiler_test.go
+	base, err := testNewXYZ("")
+	if err != nil {
+		t.Fatalf("testNewXYZ. %s\n", err.Error())
+	}
+
+	for _, nest := range []bool{false, true} {
+		x, err := NewWithOptions("x:", base.endpoint, Options{Nest: nest})
+		if err != nil {
+			t.Fatalf("NewWithOptions. %s\n", err.Error())
+		}
+		xy, err := x.LEFTJOIN("XYN").ON("a", "a").Query("y:")
+		if err != nil {
+			t.Fatalf("LEFTJOIN XY. %s\n", err.Error())
+		}
+		if _, err = xy.LEFTJOIN("YZN").ON("b", "b").Query("z:"); err != nil {
+			t.Fatalf("LEFTJOIN YZ. %s\n", err.Error())
+		}
+		sql, err := x.EvaluateQuery()
+		if err != nil {
+			t.Fatalf("x.EvaluateQuery() %s\n", err.Error())
+		}
+
+		if !nest {
+			if _, err = x.Nest(nil); err == nil || !strings.Contains(err.Error(), "Nest requires join key a of XN") {
+				t.Errorf("expected a missing key error. got=%v", err)
+			}
+			continue
+		}
+
+		expectedSQL := "SELECT X.[x], X.[a], XYN.[y], XYN.[b], XYN.[z] FROM dbo.X LEFT JOIN ( SELECT XY.[y], XY.[b], YZN.[z], XY.[a] FROM dbo.XY LEFT JOIN ( SELECT YZ.[z], YZ.[b] FROM dbo.YZ ) AS YZN ON XY.[b] = YZN.[b] ) AS XYN ON X.[a] = XYN.[a]"
+		if sql != expectedSQL {
+			t.Errorf("expected the join keys to be selected.\nexpected=%s\ngot=     %s", expectedSQL, sql)
+		}
+
+		rows := [][]any{
+			{"x1", 1, "y1", 10, "z1"},
+			{"x1", 1, "y1", 10, "z1"},
+			{"x1", 1, "y1", 11, nil},
+			{"x1", 2, nil, nil, nil},
+		}
+		nested, err := x.Nest(rows)
+		if err != nil {
+			t.Fatalf("x.Nest() %s\n", err.Error())
+		}
+
+		// Parents and children with equal values are told apart by their keys, and equal child rows are kept
+		expected := []map[string]any{
+			{"x": "x1", "XYN": []map[string]any{
+				{"y": "y1", "YZN": []map[string]any{{"z": "z1"}, {"z": "z1"}}},
+				{"y": "y1", "YZN": []map[string]any{}},
+			}},
+			{"x": "x1", "XYN": []map[string]any{}},
+		}
+		if !reflect.DeepEqual(nested, expected) {
+			t.Errorf("Nest failed.\n%v\n%v\n", nested, expected)
+		}
+	}
+}
+
+func TestNestSiblingJoins(t *testing.T) {
+	// Defined in transpiler_test.go
+	x, err := testNewXYZ("x:a:")
+	if err != nil {
+		t.Fatalf("testNewXYZ. %s\n", err.Error())
+	}
+	if _, err = x.LEFTJOIN("XYN").ON("a", "a").Query("y:"); err != nil {
+		t.Fatalf("LEFTJOIN XY. %s\n", err.Error())
+	}
+	if _, err = x.LEFTJOIN("YZN").ON("a", "b").Query("z:"); err != nil {
+		t.Fatalf("LEFTJOIN YZ. %s\n", err.Error())
+	}
+	if _, err = x.EvaluateQuery(); err != nil {
+		t.Fatalf("x.EvaluateQuery() %s\n", err.Error())
+	}
+
+	// Each join repeats the rows of the other
+	rows := [][]any{
+		{"x1", 1, "y1", "z1"},
+		{"x1", 1, "y1", "z2"},
+		{"x1", 1, "y2", "z1"},
+		{"x1", 1, "y2", "z2"},
+	}
+	nested, err := x.Nest(rows)
+	if err != nil {
+		t.Fatalf("x.Nest() %s\n", err.Error())
+	}
+
+	expected := []map[string]any{
+		{"x": "x1", "a": 1,
+			"XYN": []map[string]any{{"y": "y1"}, {"y": "y2"}},
+			"YZN": []map[string]any{{"z": "z1"}, {"z": "z2"}}},
+	}
+	if !reflect.DeepEqual(nested, expected) {
+		t.Errorf("Nest failed.\n%v\n%v\n", nested, expected)
+	}
+}
+
+func TestNestToOne(t *testing.T) {
+	// Defined in transpiler_test.go
+	x, err := testNewXYZ("x:")
+	if err != nil {
+		t.Fatalf("testNewXYZ. %s\n", err.Error())
+	}
+
+	_, err = x.LEFTJOIN("XYN").ON("a", "a").CARDINALITY(endpoint.ManyToOne).Query("y:")
+	if err != nil {
+		t.Fatalf("LEFTJOIN XY. %s\n", err.Error())
+	}
+
+	_, err = x.EvaluateQuery()
+	if err != nil {
+		t.Fatalf("x.EvaluateQuery() %s\n", err.Error())
+	}
+
+	nested, err := x.Nest([][]any{{"x1", "y1"}, {"x2", nil}})
+	if err != nil {
+		t.Fatalf("x.Nest() %s\n", err.Error())
+	}
+
+	expected := []map[string]any{
+		{"x": "x1", "XYN": map[string]any{"y": "y1"}},
+		{"x": "x2", "XYN": nil},
+	}
+
+	if !reflect.DeepEqual(nested, expected) {
+		t.Errorf("Nest failed.\n%v\n%v\n", nested, expected)
+	}
+}
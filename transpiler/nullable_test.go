@@ -0,0 +1,97 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJoinNullChecks(t *testing.T) {
+	tests := []struct {
+		join        func(ir *PrimaryIR) *joinType
+		parentQuery string
+		expectError bool
+	}{
+		{func(ir *PrimaryIR) *joinType { return ir.INNERJOIN("Join") }, "intx:@('bool') == NULL;", true},
+		{func(ir *PrimaryIR) *joinType { return ir.LEFTJOIN("Join") }, "intx:@('bool') == NULL;", false},
+		{func(ir *PrimaryIR) *joinType { return ir.INNERJOIN("Join") }, "intx: == NULL;", true},
+		{func(ir *PrimaryIR) *joinType { return ir.RIGHTJOIN("Join") }, "intx: == NULL;", false},
+		{func(ir *PrimaryIR) *joinType { return ir.FULLJOIN("Join") }, "@('intx') != NULL;", false},
+	}
+
+	for _, tt := range tests {
+		parent_ir, err := testNewParent(tt.parentQuery)
+		if err != nil {
+			t.Fatalf("Query test error. %s\n", err)
+		}
+
+		_, err = tt.join(parent_ir).ON("intx", "inty").Query("bool:")
+		if err != nil {
+			t.Fatalf("Join error. %s\n", err)
+		}
+
+		_, err = parent_ir.EvaluateQuery()
+		if tt.expectError && (err == nil || !strings.Contains(err.Error(), "is not nullable")) {
+			t.Errorf("[%s] expected not nullable error. got=%v", tt.parentQuery, err)
+		}
+		if !tt.expectError && err != nil {
+			t.Errorf("[%s] unexpected error. %s", tt.parentQuery, err)
+		}
+	}
+}
+
+func TestExpressionNullable(t *testing.T) {
+	tests := []struct {
+		input    string
+		nullable []bool
+	}{
+		{"Int:StrN:", []bool{false, true}},
+		{"AS('len', len(@('Str'))):AS('lenN', len(@('StrN'))):", []bool{false, true}},
+		{"AS('like', like(@('StrN'), 'A%')):AS('date', date(@('Str'))):", []bool{true, false}},
+		{"GROUP('Int'):COUNT('count', @('StrN')):SUM('sum', @('IntN')):SUM('sumInt', @('Int')):", []bool{false, false, true, false}},
+		{"COUNT('count', @('Int')):SUM('sum', @('Int')):", []bool{false, true}},
+	}
+
+	for _, tt := range tests {
+		ir, err := testNewTypes(tt.input)
+		if err != nil {
+			t.Fatalf("Query test error. [%s] %s\n", tt.input, err)
+		}
+
+		_, err = ir.EvaluateQuery()
+		if err != nil {
+			t.Fatalf("Query test error. [%s] %s\n", tt.input, err)
+		}
+
+		if len(ir.sql.SelectStatements) != len(tt.nullable) {
+			t.Fatalf("[%s] expected %d select statements. got=%d", tt.input, len(tt.nullable), len(ir.sql.SelectStatements))
+		}
+
+		for i, ss := range ir.sql.SelectStatements {
+			if ss.Nullable() != tt.nullable[i] {
+				t.Errorf("[%s] %s nullable. got=%t want=%t", tt.input, ss.Name(), ss.Nullable(), tt.nullable[i])
+			}
+		}
+	}
+}
+
+func TestResultTypeScript(t *testing.T) {
+	parent_ir, err := testNewParent("intx:")
+	if err != nil {
+		t.Fatalf("Query test error. %s\n", err)
+	}
+
+	_, err = parent_ir.LEFTJOIN("Join").ON("intx", "inty").Query("bool:")
+	if err != nil {
+		t.Fatalf("Join error. %s\n", err)
+	}
+
+	_, err = parent_ir.EvaluateQuery()
+	if err != nil {
+		t.Fatalf("Evaluate error. %s\n", err)
+	}
+
+	expected := "interface ParentRow { \n  intx: number;\n  bool?: boolean;\n}"
+	if ts := parent_ir.TypeScript("ParentRow"); ts != expected {
+		t.Errorf("TypeScript did not match\n%s\n%s", ts, expected)
+	}
+}
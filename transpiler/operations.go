@@ -0,0 +1,100 @@
+package transpiler
+
+import (
+	"github.com/Team-Solutions-Dental/dyre/endpoint"
+	"github.com/Team-Solutions-Dental/dyre/object"
+)
+
+// Policy of an operation when the current user is denied it.
+// Returns nil when the operation is allowed or has no policy.
+func (ir *IR) deniedOperation(operation string, policy *endpoint.SecurityPolicy) (*endpoint.SecurityPolicy, object.Object) {
+	if ir.security == nil || ir.security.checker == nil || !checkedPolicy(policy) {
+		return nil, nil
+	}
+
+	allowed, err := policy.Evaluate(ir.security.allow)
+	if err != nil {
+		return nil, newError("security check failed for %s on %s: %v", operation, ir.endpoint.Name, err)
+	}
+	if allowed {
+		return nil, nil
+	}
+	return policy, nil
+}
+
+// Check GROUP and the group function. Returns true when the group function is omitted.
+func (ir *IR) checkGroupOperation(fn string) (bool, object.Object) {
+	ops := ir.endpoint.Operations
+	if ops == nil {
+		return false, nil
+	}
+
+	policy, errObj := ir.deniedOperation("GROUP", ops.Group)
+	if errObj != nil {
+		return false, errObj
+	}
+	if policy != nil {
+		return false, newError("permission denied for GROUP on %s: requires %s", ir.endpoint.Name, policy)
+	}
+	if fn == "GROUP" {
+		return false, nil
+	}
+
+	policy, errObj = ir.deniedOperation(fn, ops.GroupFunctions[fn])
+	if errObj != nil || policy == nil {
+		return false, errObj
+	}
+	if policy.OnDeny == "omit" {
+		return true, nil
+	}
+	return false, newError("permission denied for %s on %s: requires %s", fn, ir.endpoint.Name, policy)
+}
+
+// Check the join of the endpoint to child under alias. Returns true when the join is omitted.
+func (ir *IR) checkJoinOperation(alias string, child string) (bool, object.Object) {
+	policy, errObj := ir.deniedOperation("join "+alias, ir.endpoint.JoinPolicy(alias, child))
+	if errObj != nil || policy == nil {
+		return false, errObj
+	}
+	if policy.OnDeny == "omit" {
+		return true, nil
+	}
+	return false, newError("permission denied for join %s on %s: requires %s", alias, ir.endpoint.Name, policy)
+}
+
+// Requests in export mode require the export policy of every endpoint they read
+func (ir *IR) checkExportOperation() object.Object {
+	if ir.security == nil || !ir.security.export || ir.endpoint.Operations == nil {
+		return nil
+	}
+
+	policy, errObj := ir.deniedOperation("export", ir.endpoint.Operations.Export)
+	if errObj != nil || policy == nil {
+		return errObj
+	}
+	return newError("permission denied for export of %s: requires %s", ir.endpoint.Name, policy)
+}
+
+// Limits without the limit policy are refused, or lowered to the threshold with onDeny "omit".
+// Plans are limited when rendered, so they render at most the threshold instead of being refused.
+func (pir *PrimaryIR) checkLimitOperation() object.Object {
+	ops := pir.endpoint.Operations
+	if ops == nil || ops.Limit == nil {
+		return nil
+	}
+
+	policy, errObj := pir.deniedOperation("LIMIT", ops.Limit.Security)
+	if errObj != nil || policy == nil {
+		return errObj
+	}
+	pir.limitCap = ops.Limit.Above
+	if !ops.Limit.Exceeded(pir.sql.Limit) {
+		return nil
+	}
+	if policy.OnDeny == "omit" || pir.planned {
+		limit := ops.Limit.Above
+		pir.sql.Limit = &limit
+		return nil
+	}
+	return newError("permission denied for LIMIT above %d on %s: requires %s", ops.Limit.Above, pir.endpoint.Name, policy)
+}
@@ -0,0 +1,252 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Team-Solutions-Dental/dyre/endpoint"
+)
+
+func testNewOperations(t *testing.T) *endpoint.Service {
+	service, err := endpoint.ParseJSON([]byte(`
+[
+  {
+    "name": "Invoices",
+    "tableName": "Invoices",
+    "joins": [{ "endpoint": "Patients", "on": "PatientID" }, { "endpoint": "Payments", "on": "InvoiceID" }],
+    "operations": {
+      "group": "reports:run",
+      "groupFunctions": {"SUM": {"permissions": ["billing:totals"], "onDeny": "omit"}, "AVG": "billing:totals"},
+      "joins": {"Patients": "phi:read", "Payments": {"permissions": ["payments:read"], "onDeny": "omit"}},
+      "limit": {"above": 100, "security": "bulk:read"},
+      "export": "export:invoices"
+    },
+    "fields": ["InvoiceID", "PatientID", "ClinicID", {"name": "Amount", "type": "float"}]
+  },
+  {
+    "name": "Patients",
+    "tableName": "Patients",
+    "fields": ["PatientID", "Name"]
+  },
+  {
+    "name": "Payments",
+    "tableName": "Payments",
+    "fields": ["InvoiceID", {"name": "Paid", "type": "float"}]
+  }
+]`))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	return service
+}
+
+func TestGroupOperations(t *testing.T) {
+	tests := []struct {
+		grants   []string
+		query    string
+		expected string
+		err      string
+	}{
+		{[]string{"reports:run", "billing:totals"}, "GROUP('ClinicID'): SUM('Total', @('Amount')):",
+			"SELECT Invoices.[ClinicID], SUM(Invoices.[Amount]) AS [Total] FROM Invoices GROUP BY Invoices.[ClinicID]", ""},
+		{nil, "GROUP('ClinicID'):", "", "permission denied for GROUP on Invoices: requires [reports:run]"},
+		{nil, "COUNT('Invoices', @('InvoiceID')):", "", "permission denied for GROUP on Invoices: requires [reports:run]"},
+		// Omitted group functions are left out of the select
+		{[]string{"reports:run"}, "GROUP('ClinicID'): COUNT('Invoices', @('InvoiceID')): SUM('Total', @('Amount')):",
+			"SELECT Invoices.[ClinicID], COUNT(Invoices.[InvoiceID]) AS [Invoices] FROM Invoices GROUP BY Invoices.[ClinicID]", ""},
+		{[]string{"reports:run"}, "GROUP('ClinicID'): SUM('Total', @('Amount')): > 100;", "", "No current field specified or referenced"},
+		{[]string{"reports:run"}, "GROUP('ClinicID'): AVG('Average', @('Amount')):", "", "permission denied for AVG on Invoices: requires [billing:totals]"},
+		// Field queries need no operation permission
+		{nil, "InvoiceID: Amount:", "SELECT Invoices.[InvoiceID], Invoices.[Amount] FROM Invoices", ""},
+	}
+
+	service := testNewOperations(t)
+	for _, tt := range tests {
+		grants := map[string]bool{"bulk:read": true}
+		for _, g := range tt.grants {
+			grants[g] = true
+		}
+
+		ir, err := NewWithOptions(tt.query, service.Endpoints["Invoices"], Options{Checker: &batchChecker{grants: grants}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sql, err := ir.EvaluateQuery()
+
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: expected error %q. got=%v", tt.query, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.query, err)
+			continue
+		}
+		if sql != tt.expected {
+			t.Errorf("%s: wrong sql.\nexpected=%s\ngot=     %s", tt.query, tt.expected, sql)
+		}
+	}
+}
+
+func TestJoinOperations(t *testing.T) {
+	service := testNewOperations(t)
+	checker := &batchChecker{grants: map[string]bool{"bulk:read": true}}
+
+	ir, err := NewWithOptions("InvoiceID:", service.Endpoints["Invoices"], Options{Checker: checker})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	join, err := ir.AUTOJOIN("LEFT", "Patients")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = join.Query("Name:"); err == nil || !strings.Contains(err.Error(), "permission denied for join Patients on Invoices: requires [phi:read]") {
+		t.Errorf("expected the Patients join to be denied. got=%v", err)
+	}
+
+	// Joining under another alias uses the same policy
+	if _, err = ir.INNERJOIN("Patients").AS("Owner").ON("PatientID", "PatientID").Query("Name:"); err == nil {
+		t.Errorf("expected the aliased Patients join to be denied")
+	}
+
+	// Omitted joins are left out of the query so they neither filter nor repeat invoices
+	for _, joinType := range []string{"LEFT", "INNER"} {
+		ir, err := NewWithOptions("InvoiceID:", service.Endpoints["Invoices"], Options{Checker: checker})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		join, err := ir.AUTOJOIN(joinType, "Payments")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err = join.Query("Paid: > 0;"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sql, err := ir.EvaluateQuery()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if sql != "SELECT Invoices.[InvoiceID] FROM Invoices" {
+			t.Errorf("%s: expected the Payments join to be omitted. got=%s", joinType, sql)
+		}
+		record, err := ir.Audit()
+		if err != nil || len(record.Joins) != 1 || !record.Joins[0].Omitted {
+			t.Errorf("%s: expected the audit record to list the omitted join. got=%+v, %v", joinType, record.Joins, err)
+		}
+	}
+
+	exists := []struct {
+		query string
+		err   string
+	}{
+		{"InvoiceID: exists('Patients', '');", "permission denied for join Patients on Invoices: requires [phi:read]"},
+		{"InvoiceID: exists('Payments', '');", "Cannot filter on omitted join Payments"},
+	}
+	for _, tt := range exists {
+		ir, err := NewWithOptions(tt.query, service.Endpoints["Invoices"], Options{Checker: checker})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err = ir.EvaluateQuery(); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected error %q. got=%v", tt.query, tt.err, err)
+		}
+	}
+}
+
+func TestLimitOperation(t *testing.T) {
+	service := testNewOperations(t)
+
+	tests := []struct {
+		grants   []string
+		limit    int
+		expected string
+		err      string
+	}{
+		{nil, 50, "SELECT TOP 50 Invoices.[InvoiceID] FROM Invoices", ""},
+		{nil, 100, "SELECT TOP 100 Invoices.[InvoiceID] FROM Invoices", ""},
+		{nil, 101, "", "permission denied for LIMIT above 100 on Invoices: requires [bulk:read]"},
+		{nil, 0, "", "permission denied for LIMIT above 100 on Invoices: requires [bulk:read]"},
+		{[]string{"bulk:read"}, 0, "SELECT Invoices.[InvoiceID] FROM Invoices", ""},
+	}
+
+	for _, tt := range tests {
+		grants := map[string]bool{}
+		for _, g := range tt.grants {
+			grants[g] = true
+		}
+		ir, err := NewWithOptions("InvoiceID:", service.Endpoints["Invoices"], Options{Checker: &batchChecker{grants: grants}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if tt.limit > 0 {
+			ir.LIMIT(tt.limit)
+		}
+		sql, err := ir.EvaluateQuery()
+
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("limit %d: expected error %q. got=%v", tt.limit, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("limit %d: unexpected error: %v", tt.limit, err)
+			continue
+		}
+		if sql != tt.expected {
+			t.Errorf("limit %d: wrong sql.\nexpected=%s\ngot=     %s", tt.limit, tt.expected, sql)
+		}
+	}
+
+	// Plans render at most the threshold
+	ir, err := NewWithOptions("InvoiceID:", service.Endpoints["Invoices"], Options{Checker: &batchChecker{grants: map[string]bool{}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	plan, err := ir.Compile()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sql := plan.Render(0); sql != "SELECT TOP 100 Invoices.[InvoiceID] FROM Invoices" {
+		t.Errorf("expected the plan to be limited to 100. got=%s", sql)
+	}
+	if sql := plan.Render(25); sql != "SELECT TOP 25 Invoices.[InvoiceID] FROM Invoices" {
+		t.Errorf("expected a limit of 25. got=%s", sql)
+	}
+}
+
+func TestExportOperation(t *testing.T) {
+	service := testNewOperations(t)
+	grants := map[string]bool{"bulk:read": true}
+
+	// Requests that are not exports do not need the export policy
+	ir, err := NewWithOptions("InvoiceID:", service.Endpoints["Invoices"], Options{Checker: &batchChecker{grants: grants}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ir.EvaluateQuery(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	ir, err = NewWithOptions("InvoiceID:", service.Endpoints["Invoices"], Options{Checker: &batchChecker{grants: grants}, Export: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ir.EvaluateQuery(); err == nil || !strings.Contains(err.Error(), "permission denied for export of Invoices: requires [export:invoices]") {
+		t.Errorf("expected export to be denied. got=%v", err)
+	}
+
+	grants["export:invoices"] = true
+	ir, err = NewWithOptions("InvoiceID:", service.Endpoints["Invoices"], Options{Checker: &batchChecker{grants: grants}, Export: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ir.EvaluateQuery(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	record, err := ir.Audit()
+	if err != nil || !record.Export {
+		t.Errorf("expected the audit record to mark the export. got=%+v, %v", record, err)
+	}
+}
@@ -0,0 +1,63 @@
+package transpiler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input_x   string
+		input_xy  string
+		expected  string
+		optimized string
+	}{
+		{"x:", "y:",
+			"SELECT X.[x], XYN.[y] FROM dbo.X LEFT JOIN ( SELECT XY.[y], XY.[a] FROM dbo.XY ) AS XYN ON X.[a] = XYN.[a]",
+			"SELECT X.[x], XYN.[y] FROM dbo.X LEFT JOIN dbo.XY AS XYN ON X.[a] = XYN.[a]"},
+		{"x:", "y: == 'a';",
+			"SELECT X.[x], XYN.[y] FROM dbo.X LEFT JOIN ( SELECT XY.[y], XY.[a] FROM dbo.XY WHERE (XY.[y] = 'a') ) AS XYN ON X.[a] = XYN.[a]",
+			"SELECT X.[x], XYN.[y] FROM dbo.X LEFT JOIN ( SELECT XY.[y], XY.[a] FROM dbo.XY WHERE (XY.[y] = 'a') ) AS XYN ON X.[a] = XYN.[a]"},
+		{"x:AS('ax', @('a') + 1): @ > 2;", "",
+			"SELECT XN.[x], XN.[ax] FROM ( SELECT X.[x], ((X.[a] + 1)) AS [ax] FROM dbo.X ) AS XN WHERE (XN.[ax] > 2)",
+			"SELECT X.[x], ((X.[a] + 1)) AS [ax] FROM dbo.X WHERE (((X.[a] + 1)) > 2)"},
+		{"x: == 'b'; AS('ax', @('a') + 1): @ > 2 AND @ < 10; AS('ay', @('XYN.y')): @ == 'c';", "y:",
+			"SELECT XN.[x], XN.[ax], XN.[ay], XN.[y] FROM ( SELECT X.[x], ((X.[a] + 1)) AS [ax], (XYN.[y]) AS [ay], XYN.[y] FROM dbo.X LEFT JOIN ( SELECT XY.[y], XY.[a] FROM dbo.XY ) AS XYN ON X.[a] = XYN.[a] WHERE (X.[x] = 'b') ) AS XN WHERE ((XN.[ax] > 2) AND (XN.[ax] < 10)) AND (XN.[ay] = 'c')",
+			"SELECT X.[x], ((X.[a] + 1)) AS [ax], (XYN.[y]) AS [ay], XYN.[y] FROM dbo.X LEFT JOIN dbo.XY AS XYN ON X.[a] = XYN.[a] WHERE (X.[x] = 'b') AND ((((X.[a] + 1)) > 2) AND (((X.[a] + 1)) < 10)) AND ((XYN.[y]) = 'c')"},
+	}
+
+	for _, tt := range tests {
+		evaluate := func(optimize bool) (string, []string) {
+			// Defined in transpiler_test.go
+			x, err := testNewXYZ(tt.input_x)
+			if err != nil {
+				t.Fatalf("testNewXYZ. %s\n", err.Error())
+			}
+			if tt.input_xy != "" {
+				_, err = x.LEFTJOIN("XYN").ON("a", "a").Query(tt.input_xy)
+				if err != nil {
+					t.Fatalf("LEFTJOIN XY. %s\n", err.Error())
+				}
+			}
+			sql_statement, err := x.Optimize(optimize).EvaluateQuery()
+			if err != nil {
+				t.Fatalf("x.EvaluateQuery() %s\n", err.Error())
+			}
+			return sql_statement, x.FieldNames()
+		}
+
+		plain, plainNames := evaluate(false)
+		optimized, optimizedNames := evaluate(true)
+
+		if plain != tt.expected {
+			t.Errorf("Query failed. [%s] [%s]\n%s\n%s\n", tt.input_x, tt.input_xy, plain, tt.expected)
+		}
+		if optimized != tt.optimized {
+			t.Errorf("Optimized query failed. [%s] [%s]\n%s\n%s\n", tt.input_x, tt.input_xy, optimized, tt.optimized)
+		}
+		// Optimizing must not change the result columns
+		if !reflect.DeepEqual(plainNames, optimizedNames) {
+			t.Errorf("Optimized columns changed. [%s] [%s]\n%v\n%v\n", tt.input_x, tt.input_xy, plainNames, optimizedNames)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package transpiler
 
 import (
+	"fmt"
+
 	"github.com/Team-Solutions-Dental/dyre/ast"
 	"github.com/Team-Solutions-Dental/dyre/object"
 	"github.com/Team-Solutions-Dental/dyre/sql"
@@ -22,6 +24,26 @@ func (pir *PrimaryIR) OrderBy(req string) error {
 	return nil
 }
 
+// Order the child query of an apply join.
+// Requires a LIMIT on the child query.
+func (sir *SubIR) OrderBy(req string) error {
+	if !sir.lateral {
+		err := fmt.Errorf("Order By on joined endpoint '%s' requires an apply join", sir.endpoint.Name)
+		sir.error = err
+		return err
+	}
+
+	ast, err := parse(req)
+	if err != nil {
+		sir.error = err
+		return err
+	}
+
+	sir.orderByAST = ast
+
+	return nil
+}
+
 func evalOrderBy(node ast.Node, ir *IR) object.Object {
 	switch node := node.(type) {
 	case *ast.RequestStatements:
@@ -64,6 +86,10 @@ func evalOrderByColumnLiteral(node *ast.ColumnLiteral, ir *IR) object.Object {
 		return newError("Order By '%s' not found", node.TokenLiteral())
 	}
 
+	if errObj := ir.refuseDenied(node.TokenLiteral()); errObj != nil {
+		return errObj
+	}
+
 	if loc >= 0 {
 		ir.currentSelectStatement = ir.sql.SelectStatements[loc]
 	} else if ok {
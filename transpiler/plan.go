@@ -0,0 +1,118 @@
+package transpiler
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/Team-Solutions-Dental/dyre/ast"
+	"github.com/Team-Solutions-Dental/dyre/object"
+	"github.com/Team-Solutions-Dental/dyre/object/objectType"
+	"github.com/Team-Solutions-Dental/dyre/sql/sqlExpr"
+)
+
+// Compiled query.
+// The plan is not changed after compiling so it can be cached and rendered concurrently.
+type Plan struct {
+	ir *IR
+}
+
+// Evaluate the query into a reusable plan.
+// Do not change the PrimaryIR after compiling.
+func (pir *PrimaryIR) Compile() (*Plan, error) {
+	pir.planned = true
+	_, err := pir.EvaluateQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Plan{ir: &pir.IR}, nil
+}
+
+// SQL with the limit set before compiling
+func (p *Plan) SQL() string {
+	return p.ir.sql.ConstructQuery()
+}
+
+// SQL with a different limit. A limit of 0 returns all rows.
+// Limits above the threshold of a denied limit policy are lowered to the threshold.
+// Ex. first page of a list, then the same plan with a larger limit
+func (p *Plan) Render(limit int) string {
+	if p.ir.limitCap > 0 && (limit <= 0 || limit > p.ir.limitCap) {
+		limit = p.ir.limitCap
+	}
+	q := *p.ir.sql
+	q.Limit = &limit
+	return q.ConstructQuery()
+}
+
+// Names of the $param values of the plan, rendered as @name
+func (p *Plan) Parameters() []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, param := range sqlExpr.StatementParameters(p.ir.sql) {
+		if !seen[param.Name] {
+			seen[param.Name] = true
+			names = append(names, param.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Named arguments binding the parameters of the plan to values.
+// Ex. db.QueryContext(ctx, plan.Render(25), args...)
+func (p *Plan) Args(values map[string]any) ([]any, error) {
+	names := p.Parameters()
+	args := make([]any, 0, len(names))
+	for _, name := range names {
+		value, ok := values[name]
+		if !ok {
+			return nil, fmt.Errorf("missing value of parameter %s", name)
+		}
+		args = append(args, sql.Named(name, value))
+	}
+	for name := range values {
+		if !slices.Contains(names, name) {
+			return nil, fmt.Errorf("plan has no parameter %s", name)
+		}
+	}
+	return args, nil
+}
+
+// $param.name rendered as a SQL parameter. Values are not known until the plan is executed.
+func evalParameter(node *ast.Parameter, ir *IR) object.Object {
+	if ir.trusted {
+		return newError("Parameter %s cannot be used in endpoint config", node.String())
+	}
+	return &object.Expression{ExpressionType: objectType.EXPRESSION, HasNull: true, Node: &sqlExpr.Parameter{Name: node.Name}}
+}
+
+func (p *Plan) FieldNames() []string {
+	return p.ir.sql.SelectNameList()
+}
+
+func (p *Plan) TypeScript(name string) string {
+	return p.ir.typeScript(name)
+}
+
+func (p *Plan) RowFilters() []AppliedRowFilter {
+	return p.ir.rowFilters
+}
+
+// Principal attributes read by the row filters of the plan, with the value they were compiled with
+func (p *Plan) PrincipalAttributes() map[string]any {
+	if p.ir.security == nil {
+		return nil
+	}
+	return p.ir.security.attributes
+}
+
+func (p *Plan) Explain() string {
+	return explain(p.SQL(), p.ir.rowFilters)
+}
+
+func (p *Plan) Nest(rows [][]any) ([]map[string]any, error) {
+	return p.ir.nest(rows)
+}
@@ -0,0 +1,112 @@
+package transpiler
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateQueryTwice(t *testing.T) {
+	input := "Int: > 5; AS('half', @('Float') / 2): @ > 1;"
+	ir, err := testNewTypes(input)
+	if err != nil {
+		t.Fatalf("Query test error. [%s] %s\n", input, err.Error())
+	}
+	if err := ir.OrderBy("Int: DESC;"); err != nil {
+		t.Fatalf("Order By error. %s", err.Error())
+	}
+
+	first, err := ir.EvaluateQuery()
+	if err != nil {
+		t.Fatalf("Query test error. [%s] %s\n", input, err.Error())
+	}
+	second, err := ir.EvaluateQuery()
+	if err != nil {
+		t.Fatalf("Query test error. [%s] %s\n", input, err.Error())
+	}
+
+	if first != second {
+		t.Errorf("Second evaluation changed the query.\n%s\n%s", first, second)
+	}
+	if len(ir.FieldNames()) != 2 {
+		t.Errorf("expected 2 fields. got=%v", ir.FieldNames())
+	}
+}
+
+func TestPlanRender(t *testing.T) {
+	input := "Int: > 5; Str:"
+	ir, err := testNewTypes(input)
+	if err != nil {
+		t.Fatalf("Query test error. [%s] %s\n", input, err.Error())
+	}
+	ir.LIMIT(10)
+
+	plan, err := ir.Compile()
+	if err != nil {
+		t.Fatalf("Compile error. [%s] %s\n", input, err.Error())
+	}
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{plan.SQL(), "SELECT TOP 10 Types.[Int], Types.[Str] FROM dbo.Types WHERE (Types.[Int] > 5)"},
+		{plan.Render(50), "SELECT TOP 50 Types.[Int], Types.[Str] FROM dbo.Types WHERE (Types.[Int] > 5)"},
+		{plan.Render(0), "SELECT Types.[Int], Types.[Str] FROM dbo.Types WHERE (Types.[Int] > 5)"},
+		{plan.SQL(), "SELECT TOP 10 Types.[Int], Types.[Str] FROM dbo.Types WHERE (Types.[Int] > 5)"},
+	}
+
+	for i, tt := range tests {
+		if tt.sql != tt.expected {
+			t.Errorf("Render %d failed.\n%s\n%s", i, tt.sql, tt.expected)
+		}
+	}
+
+	names := plan.FieldNames()
+	if len(names) != 2 || names[0] != "Int" || names[1] != "Str" {
+		t.Errorf("unexpected field names %v", names)
+	}
+
+	bad, err := testNewTypes("Missing:")
+	if err != nil {
+		t.Fatalf("Query test error. %s\n", err.Error())
+	}
+	if _, err := bad.Compile(); err == nil {
+		t.Errorf("expected compile error for missing field")
+	}
+}
+
+func TestPlanParameters(t *testing.T) {
+	input := "Int: > $param.min; Str: == $param.name OR @ == $param.min;"
+	ir, err := testNewTypes(input)
+	if err != nil {
+		t.Fatalf("Query test error. [%s] %s\n", input, err.Error())
+	}
+	plan, err := ir.Compile()
+	if err != nil {
+		t.Fatalf("Compile error. [%s] %s\n", input, err.Error())
+	}
+
+	expected := "SELECT TOP 5 Types.[Int], Types.[Str] FROM dbo.Types WHERE (Types.[Int] > @min) AND ((Types.[Str] = @name) OR (Types.[Str] = @min))"
+	if sql := plan.Render(5); sql != expected {
+		t.Errorf("wrong sql.\nexpected=%s\ngot=     %s", expected, sql)
+	}
+	if names := plan.Parameters(); strings.Join(names, ",") != "min,name" {
+		t.Errorf("expected the parameters min and name. got=%v", names)
+	}
+
+	args, err := plan.Args(map[string]any{"min": 3, "name": "a"})
+	if err != nil {
+		t.Fatalf("Args error. %s", err.Error())
+	}
+	if len(args) != 2 || args[0] != sql.Named("min", 3) || args[1] != sql.Named("name", "a") {
+		t.Errorf("unexpected args %v", args)
+	}
+
+	if _, err := plan.Args(map[string]any{"min": 3}); err == nil || !strings.Contains(err.Error(), "missing value of parameter name") {
+		t.Errorf("expected a missing parameter error. got=%v", err)
+	}
+	if _, err := plan.Args(map[string]any{"min": 3, "name": "a", "max": 4}); err == nil || !strings.Contains(err.Error(), "plan has no parameter max") {
+		t.Errorf("expected an unknown parameter error. got=%v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package transpiler
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/Team-Solutions-Dental/dyre/ast"
+	"github.com/Team-Solutions-Dental/dyre/object"
+	"github.com/Team-Solutions-Dental/dyre/object/objectRef"
+	"github.com/Team-Solutions-Dental/dyre/object/objectType"
+)
+
+// Row filter of an endpoint applied to the query
+type AppliedRowFilter struct {
+	Path     []string // Join aliases from the primary endpoint
+	Endpoint string
+	Filter   string // rowFilter of the endpoint config
+	SQL      string
+}
+
+func (arf AppliedRowFilter) under(alias string) AppliedRowFilter {
+	arf.Path = append([]string{alias}, arf.Path...)
+	return arf
+}
+
+// AND the endpoint row filter into the where statement.
+// Evaluated before the request so columns resolve to the endpoint table and not to request aliases.
+func (ir *IR) evalRowFilter() object.Object {
+	if ir.endpoint.RowFilter == "" {
+		return nil
+	}
+
+	filter, err := parse(ir.endpoint.RowFilter)
+	if err != nil {
+		return newError("Row filter of %s: %s", ir.endpoint.Name, err.Error())
+	}
+
+	current := ir.currentSelectStatement
+	ir.currentSelectStatement = nil
+	ir.trusted = true
+	defer func() {
+		ir.currentSelectStatement = current
+		ir.trusted = false
+	}()
+
+	var statements []string
+	for _, stmnt := range filter.Statements {
+		es, ok := stmnt.(*ast.ExpressionStatement)
+		if !ok {
+			return newError("Row filter of %s may only contain expressions. got=%s", ir.endpoint.Name, stmnt.String())
+		}
+		where := len(ir.sql.WhereStatements)
+		result := evalExpressionStatement(es, ir, objectRef.NewLocalReferences())
+		if isError(result) {
+			return newError("Row filter of %s: %s", ir.endpoint.Name, result.(*object.Error).Message)
+		}
+		// Statements that are not added to the where statement would silently not filter
+		if len(ir.sql.WhereStatements) != where+1 {
+			return newError("Row filter of %s must be a condition on fields. got=%s", ir.endpoint.Name, stmnt.String())
+		}
+		statements = append(statements, ir.sql.WhereStatements[where].String())
+	}
+
+	applied := AppliedRowFilter{Endpoint: ir.endpoint.Name, Filter: ir.endpoint.RowFilter}
+	applied.SQL = strings.Join(statements, " AND ")
+	ir.rowFilters = append(ir.rowFilters, applied)
+
+	return nil
+}
+
+// $principal.name read by endpoint config. Client queries cannot read the attributes of the principal
+func evalPrincipalAttribute(node *ast.PrincipalAttribute, ir *IR) object.Object {
+	if !ir.trusted {
+		return newError("Principal attribute %s can only be used in endpoint config", node.String())
+	}
+	if ir.security == nil || ir.security.principal == nil {
+		return newError("No principal provided for %s", node.String())
+	}
+
+	value, ok := ir.security.principal.Attribute(node.Name)
+	if !ok {
+		return newError("Principal attribute %s not found", node.Name)
+	}
+	ir.security.attributes[node.Name] = value
+
+	return principalObject(node.Name, value)
+}
+
+// Literal object of an attribute value. Lists are used with IN
+func principalObject(name string, value any) object.Object {
+	switch v := value.(type) {
+	case nil:
+		return &object.Null{}
+	case string:
+		return &object.String{Value: strings.ReplaceAll(v, "'", "''")}
+	case bool:
+		return &object.Boolean{Value: v}
+	case int:
+		return &object.Integer{Value: int64(v)}
+	case int32:
+		return &object.Integer{Value: int64(v)}
+	case int64:
+		return &object.Integer{Value: v}
+	case float64:
+		return &object.Float{Value: v}
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice {
+		return newError("Principal attribute %s has unsupported type %T", name, value)
+	}
+
+	list := &object.List{}
+	for i := range rv.Len() {
+		element := principalObject(name, rv.Index(i).Interface())
+		if isError(element) {
+			return element
+		}
+		if element.Type() == objectType.LIST || element.Type() == objectType.NULL {
+			return newError("Principal attribute %s list may only contain literals", name)
+		}
+		list.Elements = append(list.Elements, element)
+	}
+	return list
+}
+
+// Row filters applied to every endpoint of the query
+// Run Evaluate Query First!
+func (pir *PrimaryIR) RowFilters() []AppliedRowFilter {
+	return pir.rowFilters
+}
+
+// Generated SQL with the row filters applied to it
+func (pir *PrimaryIR) Explain() (string, error) {
+	query, err := pir.EvaluateQuery()
+	if err != nil {
+		return "", err
+	}
+	return explain(query, pir.rowFilters), nil
+}
+
+func explain(query string, rowFilters []AppliedRowFilter) string {
+	var out strings.Builder
+	out.WriteString("SQL: " + query)
+	for _, rf := range rowFilters {
+		if len(rf.Path) == 0 {
+			out.WriteString(fmt.Sprintf("\nRow filter %s: %s => %s", rf.Endpoint, rf.Filter, rf.SQL))
+		} else {
+			out.WriteString(fmt.Sprintf("\nRow filter %s (%s): %s => %s", strings.Join(rf.Path, "/"), rf.Endpoint, rf.Filter, rf.SQL))
+		}
+	}
+	return out.String()
+}
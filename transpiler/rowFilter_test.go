@@ -0,0 +1,215 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Team-Solutions-Dental/dyre/endpoint"
+)
+
+func testNewRowFilters(t *testing.T) *endpoint.Service {
+	service, err := endpoint.ParseJSON([]byte(`
+[
+  {
+    "name": "Patients",
+    "tableName": "Patients",
+    "rowFilter": "@('ClinicID') IN $principal.clinics",
+    "joins": [{ "endpoint": "Appointments", "on": "PatientID" }],
+    "fields": ["PatientID", {"name": "ClinicID", "type": "int"}]
+  },
+  {
+    "name": "Appointments",
+    "tableName": "Appointments",
+    "rowFilter": "@('Provider') == $principal.name OR @('Provider') == NULL",
+    "fields": ["PatientID", "Provider"]
+  }
+]`))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	return service
+}
+
+func TestRowFilters(t *testing.T) {
+	service := testNewRowFilters(t)
+	principal := endpoint.PrincipalMap{"clinics": []int{1, 2}, "name": "o'neil"}
+
+	tests := []struct {
+		input    string
+		join     string
+		expected string
+	}{
+		{"PatientID:", "",
+			"SELECT Patients.[PatientID] FROM Patients WHERE (Patients.[ClinicID] IN (1, 2))"},
+		{"PatientID: ClinicID: == 3;", "",
+			"SELECT Patients.[PatientID], Patients.[ClinicID] FROM Patients WHERE (Patients.[ClinicID] IN (1, 2)) AND (Patients.[ClinicID] = 3)"},
+		// Aliases of the request cannot replace the filtered column
+		{"PatientID: AS('ClinicID', 5): @ == 5;", "",
+			"SELECT Patients.[PatientID], Patients.[ClinicID] FROM ( SELECT Patients.[PatientID], (5) AS [ClinicID] FROM Patients WHERE (Patients.[ClinicID] IN (1, 2)) ) AS Patients WHERE (Patients.[ClinicID] = 5)"},
+		{"PatientID:", "Provider:",
+			"SELECT Patients.[PatientID], Appointments.[Provider] FROM Patients LEFT JOIN ( SELECT Appointments.[Provider], Appointments.[PatientID] FROM Appointments WHERE ((Appointments.[Provider] = 'o''neil') OR (Appointments.[Provider] IS NULL)) ) AS Appointments ON Patients.[PatientID] = Appointments.[PatientID] WHERE (Patients.[ClinicID] IN (1, 2))"},
+		{"PatientID: exists('Appointments', '');", "",
+			"SELECT Patients.[PatientID] FROM Patients WHERE (Patients.[ClinicID] IN (1, 2)) AND EXISTS ( SELECT 1 FROM ( SELECT Appointments.[PatientID] FROM Appointments WHERE ((Appointments.[Provider] = 'o''neil') OR (Appointments.[Provider] IS NULL)) ) AS Appointments WHERE Patients.[PatientID] = Appointments.[PatientID] )"},
+	}
+
+	for _, tt := range tests {
+		ir, err := NewWithOptions(tt.input, service.Endpoints["Patients"], Options{Principal: principal})
+		if err != nil {
+			t.Fatalf("Query test error. [%s] %s\n", tt.input, err.Error())
+		}
+		if tt.join != "" {
+			join, err := ir.AUTOJOIN("LEFT", "Appointments")
+			if err != nil {
+				t.Fatalf("Join error. %s", err.Error())
+			}
+			if _, err := join.Query(tt.join); err != nil {
+				t.Fatalf("Join error. %s", err.Error())
+			}
+		}
+
+		sql_statement, err := ir.EvaluateQuery()
+		if err != nil {
+			t.Errorf("Query test error. [%s] %s\n", tt.input, err.Error())
+			continue
+		}
+		if sql_statement != tt.expected {
+			t.Errorf("Query failed. [%s]\n%s\n%s\n", tt.input, sql_statement, tt.expected)
+		}
+	}
+}
+
+func TestRowFilterPrincipals(t *testing.T) {
+	service := testNewRowFilters(t)
+
+	tests := []struct {
+		principal endpoint.Principal
+		expected  string
+	}{
+		{endpoint.PrincipalMap{"clinics": []string{}}, "SELECT Patients.[PatientID] FROM Patients WHERE (1 = 0)"},
+		{endpoint.PrincipalMap{"clinics": []any{"a'b", "c"}}, "SELECT Patients.[PatientID] FROM Patients WHERE (Patients.[ClinicID] IN ('a''b', 'c'))"},
+		{endpoint.PrincipalMap{"clinics": 4}, "IN requires a list. got=INTEGER"},
+		{endpoint.PrincipalMap{"clinics": []any{[]int{1}}}, "list may only contain literals"},
+		{endpoint.PrincipalMap{}, "Principal attribute clinics not found"},
+		{nil, "No principal provided for $principal.clinics"},
+	}
+
+	for _, tt := range tests {
+		ir, err := NewWithOptions("PatientID:", service.Endpoints["Patients"], Options{Principal: tt.principal})
+		if err != nil {
+			t.Fatalf("Query test error. %s\n", err.Error())
+		}
+		sql_statement, err := ir.EvaluateQuery()
+		if err != nil {
+			sql_statement = err.Error()
+		}
+		if !strings.Contains(sql_statement, tt.expected) {
+			t.Errorf("expected %q. got=%s", tt.expected, sql_statement)
+		}
+	}
+}
+
+func TestClientPrincipalAttribute(t *testing.T) {
+	service := testNewRowFilters(t)
+	principal := endpoint.PrincipalMap{"clinics": []int{7}, "name": "Lee"}
+
+	ir, err := NewWithOptions("PatientID: ClinicID: @('ClinicID') IN $principal.clinics;", service.Endpoints["Patients"], Options{Principal: principal})
+	if err != nil {
+		t.Fatalf("Query test error. %s\n", err.Error())
+	}
+	_, err = ir.EvaluateQuery()
+	if err == nil || !strings.Contains(err.Error(), "Principal attribute $principal.clinics can only be used in endpoint config") {
+		t.Errorf("expected the client query to be refused. got=%v", err)
+	}
+
+	ir, err = NewWithOptions("PatientID:", service.Endpoints["Patients"], Options{Principal: principal})
+	if err != nil {
+		t.Fatalf("Query test error. %s\n", err.Error())
+	}
+	join, err := ir.AUTOJOIN("INNER", "Appointments")
+	if err != nil {
+		t.Fatalf("Join error. %s", err.Error())
+	}
+	if _, err := join.Query("Provider: == $principal.name;"); err != nil {
+		t.Fatalf("Join error. %s", err.Error())
+	}
+	_, err = ir.EvaluateQuery()
+	if err == nil || !strings.Contains(err.Error(), "Principal attribute $principal.name can only be used in endpoint config") {
+		t.Errorf("expected the joined query to be refused. got=%v", err)
+	}
+}
+
+func TestRowFilterExplain(t *testing.T) {
+	service := testNewRowFilters(t)
+	principal := endpoint.PrincipalMap{"clinics": []int{7}, "name": "Lee"}
+
+	ir, err := NewWithOptions("PatientID:", service.Endpoints["Patients"], Options{Principal: principal})
+	if err != nil {
+		t.Fatalf("Query test error. %s\n", err.Error())
+	}
+	join, err := ir.AUTOJOIN("INNER", "Appointments")
+	if err != nil {
+		t.Fatalf("Join error. %s", err.Error())
+	}
+	if _, err := join.Query("Provider:"); err != nil {
+		t.Fatalf("Join error. %s", err.Error())
+	}
+
+	explained, err := ir.Explain()
+	if err != nil {
+		t.Fatalf("Explain error. %s", err.Error())
+	}
+
+	lines := strings.Split(explained, "\n")
+	expected := []string{
+		"Row filter Patients: @('ClinicID') IN $principal.clinics => (Patients.[ClinicID] IN (7))",
+		"Row filter Appointments (Appointments): @('Provider') == $principal.name OR @('Provider') == NULL => ((Appointments.[Provider] = 'Lee') OR (Appointments.[Provider] IS NULL))",
+	}
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "SQL: SELECT") {
+		t.Fatalf("unexpected explain output\n%s", explained)
+	}
+	for i, e := range expected {
+		if lines[i+1] != e {
+			t.Errorf("expected %s. got=%s", e, lines[i+1])
+		}
+	}
+
+	filters := ir.RowFilters()
+	if len(filters) != 2 || filters[1].Path[0] != "Appointments" {
+		t.Errorf("unexpected row filters %v", filters)
+	}
+}
+
+func TestRowFilterWithoutFields(t *testing.T) {
+	service, err := endpoint.ParseJSON([]byte(`[{"name": "Notes", "tableName": "Notes", "fields": ["NoteID"],
+		"rowFilter": "$principal.admin == TRUE"}]`))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	ir, err := NewWithOptions("NoteID:", service.Endpoints["Notes"], Options{Principal: endpoint.PrincipalMap{"admin": false}})
+	if err != nil {
+		t.Fatalf("Query test error. %s\n", err.Error())
+	}
+	_, err = ir.EvaluateQuery()
+	if err == nil || !strings.Contains(err.Error(), "must be a condition on fields") {
+		t.Errorf("expected row filter error. got=%v", err)
+	}
+}
+
+func TestRowFilterParameter(t *testing.T) {
+	service, err := endpoint.ParseJSON([]byte(`[{"name": "Notes", "tableName": "Notes", "fields": ["NoteID", "Owner"],
+		"rowFilter": "@('Owner') == $param.owner"}]`))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	// Parameters are bound by the caller so they cannot restrict rows
+	ir, err := New("NoteID:", service.Endpoints["Notes"])
+	if err != nil {
+		t.Fatalf("Query test error. %s\n", err.Error())
+	}
+	_, err = ir.EvaluateQuery()
+	if err == nil || !strings.Contains(err.Error(), "Parameter $param.owner cannot be used in endpoint config") {
+		t.Errorf("expected parameter error. got=%v", err)
+	}
+}
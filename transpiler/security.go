@@ -0,0 +1,174 @@
+package transpiler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Team-Solutions-Dental/dyre/endpoint"
+)
+
+// Options for a new query
+type Options struct {
+	// Passed to the checker. Defaults to context.Background()
+	Context context.Context
+	// Nil skips security checks
+	Checker endpoint.ContextChecker
+	// Refuse endpoints that declare security when Checker is nil
+	Strict bool
+	// Attributes read by row filters
+	Principal endpoint.Principal
+	// Tenant ID of the request. Required by endpoints with a tenant column. A string or integer
+	Tenant any
+	// Caller recorded in the audit record. Ex. a user ID
+	Subject string
+	// Request exports rows. Requires the export policy of every endpoint read
+	Export bool
+	// Select the join keys Nest groups rows by when the query does not
+	Nest bool
+}
+
+// Permission decisions, principal and tenant shared by every IR of a request.
+// A strict check without a checker refuses endpoints that declare security.
+// The permission sets of an endpoint, its fields and every endpoint reachable through its joins
+// are checked together in one AllowAll call the first time the endpoint is queried.
+type securityCheck struct {
+	ctx       context.Context
+	checker   endpoint.ContextChecker
+	strict    bool
+	principal endpoint.Principal
+	tenant    any
+	subject   string
+	export    bool
+	decided   map[string]bool
+	used      map[string]bool // Decided permission sets the request was evaluated on
+	visited   map[*endpoint.Endpoint]bool
+	// Principal attributes read by row filters
+	attributes map[string]any
+}
+
+func newSecurityCheck(opts Options) *securityCheck {
+	if opts.Checker == nil && !opts.Strict && opts.Principal == nil && opts.Tenant == nil && opts.Subject == "" && !opts.Export {
+		return nil
+	}
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &securityCheck{
+		ctx:        ctx,
+		checker:    opts.Checker,
+		strict:     opts.Strict,
+		principal:  opts.Principal,
+		tenant:     opts.Tenant,
+		subject:    opts.Subject,
+		export:     opts.Export,
+		decided:    map[string]bool{},
+		used:       map[string]bool{},
+		visited:    map[*endpoint.Endpoint]bool{},
+		attributes: map[string]any{},
+	}
+}
+
+func permissionKey(perms []string) string {
+	return strings.Join(perms, "\x00")
+}
+
+// Endpoint or one of its fields has a security policy
+func declaresSecurity(ep *endpoint.Endpoint) bool {
+	if !ep.Security.IsEmpty() || !ep.Operations.IsEmpty() {
+		return true
+	}
+	if ep.Service != nil && (ep.Service.Settings.DenyByDefault || !ep.Service.Settings.DefaultPolicy.IsEmpty()) {
+		return true
+	}
+	for _, name := range ep.FieldNames {
+		field := ep.Fields[name]
+		if !ep.FieldPolicy(&field).IsEmpty() {
+			return true
+		}
+	}
+	return false
+}
+
+// Policies that require a check
+func checkedPolicy(policy *endpoint.SecurityPolicy) bool {
+	return policy != nil && !policy.IsEmpty() && !policy.HasWildcard()
+}
+
+// Check the permission sets of the endpoint tree that have not been decided yet
+func (sc *securityCheck) prefetch(ep *endpoint.Endpoint) error {
+	var required [][]string
+	queued := map[string]bool{}
+	add := func(policy *endpoint.SecurityPolicy) {
+		if !checkedPolicy(policy) {
+			return
+		}
+		for _, perms := range policy.Sets() {
+			key := permissionKey(perms)
+			if _, ok := sc.decided[key]; ok || queued[key] {
+				continue
+			}
+			queued[key] = true
+			required = append(required, perms)
+		}
+	}
+
+	pending := []*endpoint.Endpoint{ep}
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+		if current == nil || sc.visited[current] {
+			continue
+		}
+		sc.visited[current] = true
+
+		add(current.Security)
+		for _, policy := range current.Operations.Policies() {
+			add(policy)
+		}
+		for _, name := range current.FieldNames {
+			field := current.Fields[name]
+			add(current.FieldPolicy(&field))
+		}
+		for _, name := range current.JoinNames {
+			join := current.Joins[name]
+			pending = append(pending, join.ChildEndpoint())
+		}
+	}
+
+	return sc.check(required)
+}
+
+func (sc *securityCheck) check(required [][]string) error {
+	if len(required) == 0 {
+		return nil
+	}
+
+	allowed, err := sc.checker.AllowAll(sc.ctx, required)
+	if err != nil {
+		return err
+	}
+	if len(allowed) != len(required) {
+		return fmt.Errorf("checker returned %d results for %d permission sets", len(allowed), len(required))
+	}
+
+	for i, perms := range required {
+		sc.decided[permissionKey(perms)] = allowed[i]
+	}
+	return nil
+}
+
+// Permission sets not covered by a prefetch are checked on their own
+func (sc *securityCheck) allow(perms []string) (bool, error) {
+	key := permissionKey(perms)
+	sc.used[key] = true
+	if allowed, ok := sc.decided[key]; ok {
+		return allowed, nil
+	}
+
+	if err := sc.check([][]string{perms}); err != nil {
+		return false, err
+	}
+	return sc.decided[key], nil
+}
@@ -1,6 +1,8 @@
 package transpiler
 
 import (
+	"context"
+	"fmt"
 	"strings"
 	"testing"
 
@@ -160,6 +162,27 @@ func TestFieldSecurity_OmittedColumn(t *testing.T) {
 	}
 }
 
+func TestFieldSecurity_OmittedColumnFilter(t *testing.T) {
+	ep := createTestEndpointWithSecurity()
+	checker := endpoint.NewStaticChecker(map[string]struct{}{
+		"customers:read":            {},
+		"customers:customerid:view": {},
+	})
+
+	// The condition belongs to the omitted Email and must not filter CustomerID
+	ir, err := NewWithSecurity("CustomerID: Email: == 'a@b.c';", ep, checker)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sql, err := ir.EvaluateQuery()
+	if err == nil {
+		t.Fatalf("expected the filter of the omitted field to be refused. got=%s", sql)
+	}
+	if !strings.Contains(err.Error(), "No current field specified or referenced") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
 func TestFieldSecurity_ErrorOnDeny(t *testing.T) {
 	ep := createTestEndpointWithSecurity()
 	checker := endpoint.NewStaticChecker(map[string]struct{}{
@@ -515,3 +538,388 @@ func TestJoinSecurity_NilCheckerInJoin(t *testing.T) {
 		t.Error("expected Amount in query with nil checker")
 	}
 }
+
+// Records every AllowAll call
+type batchChecker struct {
+	grants map[string]bool
+	calls  [][][]string
+}
+
+func (bc *batchChecker) AllowAll(ctx context.Context, required [][]string) ([]bool, error) {
+	bc.calls = append(bc.calls, required)
+	allowed := make([]bool, len(required))
+	for i, perms := range required {
+		allowed[i] = true
+		for _, p := range perms {
+			if !bc.grants[p] {
+				allowed[i] = false
+			}
+		}
+	}
+	return allowed, nil
+}
+
+func TestContextChecker_BatchedCall(t *testing.T) {
+	service, err := endpoint.ParseJSON([]byte(`
+[
+  {
+    "name": "Customers",
+    "tableName": "Customers",
+    "security": "customers:read",
+    "joins": [{ "endpoint": "Invoices", "on": "CustomerID" }],
+    "fields": ["CustomerID", {"name": "Email", "security": {"permissions": ["customers:email:view"], "onDeny": "omit"}}]
+  },
+  {
+    "name": "Invoices",
+    "tableName": "Invoices",
+    "security": "invoices:read",
+    "fields": ["CustomerID", {"name": "Amount", "type": "float", "security": {"permissions": ["invoices:amount:view"], "onDeny": "omit"}}]
+  }
+]`))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	checker := &batchChecker{grants: map[string]bool{"customers:read": true, "invoices:read": true, "invoices:amount:view": true}}
+	ir, err := NewWithOptions("CustomerID: Email:", service.Endpoints["Customers"], Options{Context: context.Background(), Checker: checker})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	join, err := ir.AUTOJOIN("LEFT", "Invoices")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := join.Query("Amount:"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sql, err := ir.EvaluateQuery()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(checker.calls) != 1 {
+		t.Fatalf("expected 1 AllowAll call. got=%d %v", len(checker.calls), checker.calls)
+	}
+	if len(checker.calls[0]) != 4 {
+		t.Errorf("expected 4 permission sets. got=%v", checker.calls[0])
+	}
+	if strings.Contains(sql, "Email") || !strings.Contains(sql, "Amount") {
+		t.Errorf("expected Email omitted and Amount selected. got=%s", sql)
+	}
+}
+
+func TestContextChecker_Adapter(t *testing.T) {
+	checker := endpoint.AdaptChecker(endpoint.NewStaticChecker(map[string]struct{}{"a": {}}))
+
+	allowed, err := checker.AllowAll(context.Background(), [][]string{{"a"}, {"a", "b"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(allowed) != 2 || !allowed[0] || allowed[1] {
+		t.Errorf("unexpected results %v", allowed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewWithOptions("CustomerID:", createTestEndpointWithSecurity(), Options{Context: ctx, Checker: checker})
+	if err == nil || !strings.Contains(err.Error(), "security check failed") {
+		t.Errorf("expected security check error for cancelled context. got=%v", err)
+	}
+}
+
+func TestRequirementTrees(t *testing.T) {
+	service, err := endpoint.ParseJSON([]byte(`
+[
+  {
+    "name": "Patients",
+    "tableName": "Patients",
+    "security": {"anyOf": ["billing:read", {"allOf": ["admin", "phi:read"]}]},
+    "fields": ["PatientID", {"name": "Diagnosis", "security": {"allOf": ["phi:read", {"anyOf": ["doctor", "nurse"]}]}}]
+  }
+]`))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	tests := []struct {
+		grants []string
+		err    string
+	}{
+		{[]string{"billing:read", "phi:read", "nurse"}, ""},
+		{[]string{"admin", "phi:read", "doctor"}, ""},
+		{[]string{"admin"}, "permission denied: requires anyOf(billing:read, allOf(admin, phi:read))"},
+		{[]string{"billing:read", "phi:read"}, "permission denied for field Diagnosis: requires allOf(phi:read, anyOf(doctor, nurse))"},
+	}
+
+	for _, tt := range tests {
+		grants := map[string]bool{}
+		for _, g := range tt.grants {
+			grants[g] = true
+		}
+		checker := &batchChecker{grants: grants}
+
+		ir, err := NewWithOptions("PatientID: Diagnosis:", service.Endpoints["Patients"], Options{Checker: checker})
+		if err == nil {
+			_, err = ir.EvaluateQuery()
+		}
+
+		if tt.err == "" && err != nil {
+			t.Errorf("%v: unexpected error: %v", tt.grants, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%v: expected error %q. got=%v", tt.grants, tt.err, err)
+		}
+		// Every set of both trees is checked in the first call
+		if len(checker.calls) != 1 || len(checker.calls[0]) != 5 {
+			t.Errorf("%v: expected 1 AllowAll call of 5 sets. got=%v", tt.grants, checker.calls)
+		}
+	}
+}
+
+func TestDeniedFieldsRefused(t *testing.T) {
+	service, err := endpoint.ParseJSON([]byte(`[
+    {"name": "Patients", "tableName": "Patients",
+      "joins": [{"endpoint": "Visits", "on": "PatientID"}],
+      "fields": ["PatientID", "Clinic", {"name": "Name", "security": "phi:name"},
+        {"name": "Email", "security": {"permissions": ["phi:contact"], "onDeny": "omit"}}]},
+    {"name": "Visits", "tableName": "Visits",
+      "fields": ["PatientID", {"name": "Diagnosis", "security": {"permissions": ["phi:read"], "onDeny": "omit"}}]}
+  ]`))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	tests := []struct {
+		query   string
+		join    string
+		orderBy string
+		err     string
+	}{
+		{"PatientID: @('Name') == 'Bob';", "", "", "permission denied for field Name: requires [phi:name]"},
+		{"AS('n', @('Name')):", "", "", "permission denied for field Name: requires [phi:name]"},
+		{"PatientID: @('Email') == 'a@b.c';", "", "", "Field Email is omitted and cannot be filtered, sorted or grouped"},
+		{"AS('e', @('Email')):", "", "", "Field Email is omitted and cannot be filtered, sorted or grouped"},
+		{"PatientID:", "", "Email:", "Field Email is omitted and cannot be filtered, sorted or grouped"},
+		{"GROUP('Email'):", "", "", "Field Email is omitted and cannot be filtered, sorted or grouped"},
+		{"PatientID: @('Visits.Diagnosis') == 'flu';", "Diagnosis:", "", "Field Visits.Diagnosis is omitted and cannot be filtered, sorted or grouped"},
+	}
+
+	for _, tt := range tests {
+		ir, err := NewWithOptions(tt.query, service.Endpoints["Patients"], Options{Checker: &batchChecker{grants: map[string]bool{}}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if tt.join != "" {
+			if _, err = ir.LEFTJOIN("Visits").ON("PatientID", "PatientID").Query(tt.join); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if tt.orderBy != "" {
+			if err = ir.OrderBy(tt.orderBy); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		if _, err = ir.EvaluateQuery(); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected error %q. got=%v", tt.query, tt.err, err)
+		}
+	}
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	config := `{
+  %s
+  "endpoints": [
+    {"name": "Patients", "tableName": "Patients",
+      "fields": ["PatientID", {"name": "Notes", "security": {"permissions": ["phi:read"], "onDeny": "omit"}}, {"name": "Clinic", "security": "*"}]}
+  ]
+}`
+
+	tests := []struct {
+		settings string
+		grants   []string
+		query    string
+		expected string
+		err      string
+	}{
+		{"", nil, "PatientID: Clinic:", "SELECT Patients.[PatientID], Patients.[Clinic] FROM Patients", ""},
+		{`"defaultPolicy": "patients:read",`, []string{"patients:read"}, "PatientID: Clinic:", "SELECT Patients.[PatientID], Patients.[Clinic] FROM Patients", ""},
+		{`"defaultPolicy": "patients:read",`, nil, "PatientID:", "", "permission denied for field PatientID: requires [patients:read]"},
+		{`"defaultPolicy": {"permissions": ["patients:read"], "onDeny": "omit"},`, nil, "PatientID: Clinic: Notes:", "SELECT Patients.[Clinic] FROM Patients", ""},
+		{`"denyByDefault": true,`, []string{"phi:read"}, "Clinic: Notes:", "SELECT Patients.[Clinic], Patients.[Notes] FROM Patients", ""},
+		{`"denyByDefault": true,`, []string{"phi:read"}, "PatientID:", "", "permission denied for field PatientID: no security policy"},
+		{`"denyByDefault": true,`, []string{"phi:read"}, "Clinic: @('PatientID') == 1;", "", "permission denied for field PatientID: no security policy"},
+		{`"denyByDefault": true,`, []string{"phi:read"}, "AS('id', @('PatientID')):", "", "permission denied for field PatientID: no security policy"},
+		{`"denyByDefault": true,`, []string{"phi:read"}, "GROUP('PatientID'):", "", "permission denied for field PatientID: no security policy"},
+	}
+
+	for _, tt := range tests {
+		service, err := endpoint.ParseJSON([]byte(fmt.Sprintf(config, tt.settings)))
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		grants := map[string]bool{}
+		for _, g := range tt.grants {
+			grants[g] = true
+		}
+
+		ir, err := NewWithOptions(tt.query, service.Endpoints["Patients"], Options{Checker: &batchChecker{grants: grants}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sql, err := ir.EvaluateQuery()
+
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s %s: expected error %q. got=%v", tt.settings, tt.query, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s: unexpected error: %v", tt.settings, tt.query, err)
+			continue
+		}
+		if sql != tt.expected {
+			t.Errorf("%s %s: wrong sql.\nexpected=%s\ngot=     %s", tt.settings, tt.query, tt.expected, sql)
+		}
+	}
+}
+
+func TestDenyByDefault_WithoutChecker(t *testing.T) {
+	service, err := endpoint.ParseJSON([]byte(`{"denyByDefault": true, "endpoints": [
+    {"name": "Patients", "tableName": "Patients", "fields": ["PatientID", {"name": "Clinic", "security": "*"}]}]}`))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	ir, err := New("Clinic:", service.Endpoints["Patients"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ir.EvaluateQuery(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	ir, err = New("PatientID:", service.Endpoints["Patients"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ir.EvaluateQuery(); err == nil || !strings.Contains(err.Error(), "no security policy") {
+		t.Errorf("expected unannotated field to be denied. got=%v", err)
+	}
+
+	for _, query := range []string{"Clinic: @('PatientID') == 1;", "AS('id', @('PatientID')):"} {
+		ir, err = New(query, service.Endpoints["Patients"])
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := ir.EvaluateQuery(); err == nil || !strings.Contains(err.Error(), "no security policy") {
+			t.Errorf("%s: expected unannotated field reference to be denied. got=%v", query, err)
+		}
+	}
+
+	if _, err := NewWithOptions("Clinic:", service.Endpoints["Patients"], Options{Strict: true}); err == nil {
+		t.Errorf("expected strict mode to require a checker")
+	}
+}
+
+func TestClassificationPolicies(t *testing.T) {
+	service, err := endpoint.ParseJSON([]byte(`{
+  "classifications": {"phi": {"permissions": ["phi:read"], "onDeny": "omit"}, "pii": {"permissions": ["pii:read"], "onDeny": "mask"}},
+  "endpoints": [
+    {"name": "Patients", "tableName": "Patients",
+      "fields": ["PatientID", {"name": "Diagnosis", "classification": "phi"}, {"name": "Phone", "classification": "pii"},
+        {"name": "Notes", "classification": "phi", "security": "notes:read"}, {"name": "Clinic", "classification": "public"}]}
+  ]
+}`))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	tests := []struct {
+		grants   []string
+		query    string
+		expected string
+		err      string
+	}{
+		{[]string{"phi:read", "pii:read"}, "PatientID: Diagnosis: Phone:", "SELECT Patients.[PatientID], Patients.[Diagnosis], Patients.[Phone] FROM Patients", ""},
+		{nil, "PatientID: Diagnosis: Phone: Clinic:", "SELECT Patients.[PatientID], (NULL) AS [Phone], Patients.[Clinic] FROM Patients", ""},
+		// The field policy overrides its classification
+		{[]string{"notes:read"}, "Notes:", "SELECT Patients.[Notes] FROM Patients", ""},
+		{[]string{"phi:read"}, "Notes:", "", "permission denied for field Notes: requires [notes:read]"},
+	}
+
+	for _, tt := range tests {
+		grants := map[string]bool{}
+		for _, g := range tt.grants {
+			grants[g] = true
+		}
+
+		ir, err := NewWithOptions(tt.query, service.Endpoints["Patients"], Options{Checker: &batchChecker{grants: grants}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sql, err := ir.EvaluateQuery()
+
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: expected error %q. got=%v", tt.query, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.query, err)
+			continue
+		}
+		if sql != tt.expected {
+			t.Errorf("%s: wrong sql.\nexpected=%s\ngot=     %s", tt.query, tt.expected, sql)
+		}
+	}
+
+	// Classified fields declare security, so strict requests without a checker are refused
+	if _, err := NewWithOptions("Diagnosis:", service.Endpoints["Patients"], Options{Strict: true}); err == nil {
+		t.Errorf("expected strict request without a checker to be refused")
+	}
+
+	// Classification policies add to the endpoint policy
+	service, err = endpoint.ParseJSON([]byte(`{
+  "classifications": {"phi": {"permissions": ["phi:read"], "onDeny": "omit"}, "pii": {"permissions": ["pii:read"], "onDeny": "mask"}},
+  "endpoints": [
+    {"name": "Patients", "tableName": "Patients", "security": {"permissions": ["patients:read"], "onDeny": "mask"},
+      "fields": ["PatientID", {"name": "Diagnosis", "classification": "phi"}, {"name": "Phone", "classification": "pii"}]}
+  ]
+}`))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	masked := []struct {
+		grants   []string
+		expected string
+	}{
+		{[]string{"patients:read", "phi:read", "pii:read"}, "SELECT Patients.[PatientID], Patients.[Diagnosis], Patients.[Phone] FROM Patients"},
+		{[]string{"phi:read", "pii:read"}, "SELECT (NULL) AS [PatientID], (NULL) AS [Phone] FROM Patients"},
+		{[]string{"patients:read"}, "SELECT Patients.[PatientID], (NULL) AS [Phone] FROM Patients"},
+	}
+	for _, tt := range masked {
+		grants := map[string]bool{}
+		for _, g := range tt.grants {
+			grants[g] = true
+		}
+
+		ir, err := NewWithOptions("PatientID: Diagnosis: Phone:", service.Endpoints["Patients"], Options{Checker: &batchChecker{grants: grants}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sql, err := ir.EvaluateQuery()
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tt.grants, err)
+			continue
+		}
+		if sql != tt.expected {
+			t.Errorf("%v: wrong sql.\nexpected=%s\ngot=     %s", tt.grants, tt.expected, sql)
+		}
+	}
+}
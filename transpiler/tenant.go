@@ -0,0 +1,58 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Team-Solutions-Dental/dyre/endpoint"
+	"github.com/Team-Solutions-Dental/dyre/object"
+	"github.com/Team-Solutions-Dental/dyre/sql/sqlExpr"
+)
+
+// Limit the endpoint table to the tenant of the request
+func (ir *IR) evalTenant() object.Object {
+	column, ok := ir.endpoint.Service.TenantColumn(ir.endpoint.Name)
+	if !ok {
+		return nil
+	}
+
+	if ir.security == nil || ir.security.tenant == nil {
+		return newError("Endpoint %s requires a tenant", ir.endpoint.Name)
+	}
+
+	var literal sqlExpr.Node
+	switch id := ir.security.tenant.(type) {
+	case string:
+		literal = &sqlExpr.Literal{Value: "'" + strings.ReplaceAll(id, "'", "''") + "'"}
+	case int, int32, int64:
+		literal = &sqlExpr.Literal{Value: fmt.Sprintf("%d", id)}
+	default:
+		return newError("Tenant must be a string or integer. got=%T", id)
+	}
+
+	ir.sql.WhereStatements = append(ir.sql.WhereStatements,
+		&sqlExpr.Binary{Operator: "=", Left: &sqlExpr.Column{Table: ir.endpoint.TableName, Name: column}, Right: literal})
+
+	return nil
+}
+
+// Join rows of the same tenant when both endpoints store a tenant
+func (js *joinIR) addTenantOn() {
+	service := js.parentIR.endpoint.Service
+	parent, ok := service.TenantColumn(js.parentIR.endpoint.Name)
+	if !ok {
+		return
+	}
+	child, ok := service.TenantColumn(js.endpoint.Name)
+	if !ok {
+		return
+	}
+
+	on := endpoint.JoinOn{Parent: parent, Child: child}
+	for _, existing := range js.ons {
+		if existing == on {
+			return
+		}
+	}
+	js.ons = append(js.ons, on)
+}
@@ -0,0 +1,118 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Team-Solutions-Dental/dyre/endpoint"
+)
+
+func testNewTenants(t *testing.T) *endpoint.Service {
+	service, err := endpoint.ParseJSON([]byte(`
+[
+  {
+    "name": "Patients",
+    "tableName": "Patients",
+    "joins": [{ "endpoint": "Appointments", "on": "PatientID" }, { "endpoint": "Clinics", "on": "ClinicID" }],
+    "fields": ["TenantID", "PatientID", "ClinicID"]
+  },
+  {
+    "name": "Appointments",
+    "tableName": "Appointments",
+    "fields": ["OrgID", "PatientID", "Note"]
+  },
+  {
+    "name": "Clinics",
+    "tableName": "Clinics",
+    "fields": ["ClinicID", "Name"]
+  }
+]`))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	err = service.SetTenantColumns(map[string]string{"Patients": "TenantID", "Appointments": "OrgID"})
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	return service
+}
+
+func TestTenants(t *testing.T) {
+	service := testNewTenants(t)
+
+	tests := []struct {
+		input    string
+		tenant   any
+		join     string
+		query    string
+		expected string
+	}{
+		{"PatientID:", 7, "", "",
+			"SELECT Patients.[PatientID] FROM Patients WHERE (Patients.[TenantID] = 7)"},
+		{"PatientID: == 1;", "a'b", "", "",
+			"SELECT Patients.[PatientID] FROM Patients WHERE (Patients.[TenantID] = 'a''b') AND (Patients.[PatientID] = 1)"},
+		{"PatientID:", 7, "Appointments", "Note:",
+			"SELECT Patients.[PatientID], Appointments.[Note] FROM Patients INNER JOIN ( SELECT Appointments.[Note], Appointments.[PatientID], Appointments.[OrgID] FROM Appointments WHERE (Appointments.[OrgID] = 7) ) AS Appointments ON Patients.[PatientID] = Appointments.[PatientID] AND Patients.[TenantID] = Appointments.[OrgID] WHERE (Patients.[TenantID] = 7)"},
+		// Shared endpoints are not limited to a tenant
+		{"PatientID:", 7, "Clinics", "Name:",
+			"SELECT Patients.[PatientID], Clinics.[Name] FROM Patients INNER JOIN ( SELECT Clinics.[Name], Clinics.[ClinicID] FROM Clinics ) AS Clinics ON Patients.[ClinicID] = Clinics.[ClinicID] WHERE (Patients.[TenantID] = 7)"},
+		{"PatientID: exists('Appointments', '');", 7, "", "",
+			"SELECT Patients.[PatientID] FROM Patients WHERE (Patients.[TenantID] = 7) AND EXISTS ( SELECT 1 FROM ( SELECT Appointments.[PatientID], Appointments.[OrgID] FROM Appointments WHERE (Appointments.[OrgID] = 7) ) AS Appointments WHERE Patients.[PatientID] = Appointments.[PatientID] AND Patients.[TenantID] = Appointments.[OrgID] )"},
+	}
+
+	for _, tt := range tests {
+		ir, err := NewWithOptions(tt.input, service.Endpoints["Patients"], Options{Tenant: tt.tenant})
+		if err != nil {
+			t.Fatalf("Query test error. [%s] %s\n", tt.input, err.Error())
+		}
+		if tt.join != "" {
+			join, err := ir.AUTOJOIN("INNER", tt.join)
+			if err != nil {
+				t.Fatalf("Join error. %s", err.Error())
+			}
+			if _, err := join.Query(tt.query); err != nil {
+				t.Fatalf("Join error. %s", err.Error())
+			}
+		}
+
+		sql_statement, err := ir.EvaluateQuery()
+		if err != nil {
+			t.Errorf("Query test error. [%s] %s\n", tt.input, err.Error())
+			continue
+		}
+		if sql_statement != tt.expected {
+			t.Errorf("Query failed. [%s]\n%s\n%s\n", tt.input, sql_statement, tt.expected)
+		}
+	}
+}
+
+func TestTenantErrors(t *testing.T) {
+	service := testNewTenants(t)
+
+	tests := []struct {
+		endpoint string
+		tenant   any
+		expected string
+	}{
+		{"Patients", nil, "Endpoint Patients requires a tenant"},
+		{"Patients", 1.5, "Tenant must be a string or integer. got=float64"},
+		{"Clinics", nil, ""},
+	}
+
+	for _, tt := range tests {
+		ir, err := NewWithOptions("ClinicID:", service.Endpoints[tt.endpoint], Options{Tenant: tt.tenant})
+		if err != nil {
+			t.Fatalf("Query test error. %s\n", err.Error())
+		}
+		_, err = ir.EvaluateQuery()
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected error. %v", err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected error containing %q. got=%v", tt.expected, err)
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/Team-Solutions-Dental/dyre/object/objectType"
 	"github.com/Team-Solutions-Dental/dyre/parser"
 	"github.com/Team-Solutions-Dental/dyre/sql"
+	"github.com/Team-Solutions-Dental/dyre/sql/sqlExpr"
 	"github.com/Team-Solutions-Dental/dyre/utils"
 )
 
@@ -24,68 +25,91 @@ type IR struct {
 	sql                    *sql.Query
 	isGroup                *bool
 	joins                  []*joinIR
+	omittedJoins           []*joinIR // Joins omitted due to security. Left out of the query
+	orderByAST             *ast.RequestStatements
 	error                  error
-	securityChecker        endpoint.SecurityChecker
+	security               *securityCheck
 	omittedFields          map[string]bool // Track fields omitted due to security
+	omitted                bool            // Endpoint omitted due to security
+	maskedFields           map[string]bool // Fields returned masked due to security
+	trusted                bool            // Evaluating endpoint config which may use masked fields
+	columns                []nestColumn    // Result column positions used by Nest
+	rowFilters             []AppliedRowFilter
+	semiJoins              []*joinIR      // Joins of exists() filters
+	limitCap               int            // Highest limit plans render. 0 is unlimited
+	tableFilters           []sqlExpr.Node // Tenant and row filter conditions on the endpoint table
+	nestKeys               bool           // Select the join keys Nest groups rows by
 }
 
 type PrimaryIR struct {
 	IR
-	orderByAST *ast.RequestStatements
+	optimize  bool
+	evaluated bool
+	planned   bool // Compiled into a plan which is rendered with its own limit
 }
 
 type SubIR struct {
 	IR
+	// Child of an apply join. Correlated to the parent row
+	lateral bool
 }
 
 // Entry into transpiler package
 // Create a new query
 func New(query string, endpoint *endpoint.Endpoint) (*PrimaryIR, error) {
-	return NewWithSecurity(query, endpoint, nil)
+	return NewWithOptions(query, endpoint, Options{})
 }
 
 // NewWithSecurity creates a new query with security enforcement.
 // If checker is nil, security checks are skipped (permissive behavior).
 func NewWithSecurity(query string, ep *endpoint.Endpoint, checker endpoint.SecurityChecker) (*PrimaryIR, error) {
+	var opts Options
+	if checker != nil {
+		opts.Checker = endpoint.AdaptChecker(checker)
+	}
+	return NewWithOptions(query, ep, opts)
+}
+
+// NewWithOptions creates a new query checking permissions with opts.Checker.
+// The permissions of the endpoint, its fields and joined endpoints are checked in one call.
+func NewWithOptions(query string, ep *endpoint.Endpoint, opts Options) (*PrimaryIR, error) {
 	if ep == nil {
 		return nil, errors.New("No end point provided for query: " + query)
 	}
 
+	security := newSecurityCheck(opts)
+
 	// Check endpoint-level security first
-	if checker != nil && ep.Security != nil && !ep.Security.IsEmpty() {
-		// Skip check if wildcard is present
-		if !ep.Security.HasWildcard() {
-			allowed, err := checker.Allow(ep.Security.Permissions)
-			if err != nil {
-				return nil, fmt.Errorf("security check failed: %w", err)
-			}
-			if !allowed {
-				if ep.Security.OnDeny == "omit" {
-					// Return empty IR - caller should handle as empty result set
-					emptyAST := &ast.RequestStatements{Statements: []ast.Statement{}}
-					ir := PrimaryIR{IR: IR{
-						endpoint:        ep,
-						ast:             emptyAST,
-						sql:             &sql.Query{BracketedColumns: ep.Service.Settings.BracketedColumns},
-						securityChecker: checker,
-						omittedFields:   make(map[string]bool),
-					}}
-					return &ir, nil
-				}
-				// OnDeny == "error"
-				return nil, fmt.Errorf("permission denied: requires %v", ep.Security.Permissions)
-			}
-		}
+	omitted, err := checkEndpointSecurity(ep, security)
+	if err != nil {
+		return nil, err
+	}
+	if omitted {
+		// Return empty IR - caller should handle as empty result set
+		emptyAST := &ast.RequestStatements{Statements: []ast.Statement{}}
+		ir := PrimaryIR{IR: IR{
+			endpoint:      ep,
+			ast:           emptyAST,
+			sql:           &sql.Query{BracketedColumns: ep.Service.Settings.BracketedColumns},
+			security:      security,
+			omittedFields: make(map[string]bool),
+			maskedFields:  make(map[string]bool),
+			omitted:       true,
+			nestKeys:      opts.Nest,
+		}}
+		return &ir, nil
 	}
 
 	q, err := parse(query)
 	var ir PrimaryIR = PrimaryIR{IR: IR{
-		endpoint:        ep,
-		ast:             q,
-		error:           err,
-		sql:             &sql.Query{BracketedColumns: ep.Service.Settings.BracketedColumns},
-		securityChecker: checker,
-		omittedFields:   make(map[string]bool),
+		endpoint:      ep,
+		ast:           q,
+		error:         err,
+		sql:           &sql.Query{BracketedColumns: ep.Service.Settings.BracketedColumns},
+		security:      security,
+		omittedFields: make(map[string]bool),
+		maskedFields:  make(map[string]bool),
+		nestKeys:      opts.Nest,
 	}}
 	return &ir, err
 }
@@ -96,48 +120,84 @@ func newSubIR(query string, endpoint *endpoint.Endpoint) (*SubIR, error) {
 }
 
 // newSubIRWithSecurity creates a SubIR with security enforcement for joined tables
-func newSubIRWithSecurity(query string, ep *endpoint.Endpoint, checker endpoint.SecurityChecker) (*SubIR, error) {
+func newSubIRWithSecurity(query string, ep *endpoint.Endpoint, security *securityCheck) (*SubIR, error) {
 	if ep == nil {
 		return nil, errors.New("No end point provided for query: " + query)
 	}
 
 	// Check endpoint-level security for joined table
-	if checker != nil && ep.Security != nil && !ep.Security.IsEmpty() {
-		if !ep.Security.HasWildcard() {
-			allowed, err := checker.Allow(ep.Security.Permissions)
-			if err != nil {
-				return nil, fmt.Errorf("security check failed for join %s: %w", ep.Name, err)
-			}
-			if !allowed {
-				if ep.Security.OnDeny == "omit" {
-					// Return empty IR for joined table
-					emptyAST := &ast.RequestStatements{Statements: []ast.Statement{}}
-					ir := SubIR{IR: IR{
-						endpoint:        ep,
-						ast:             emptyAST,
-						sql:             &sql.Query{BracketedColumns: ep.Service.Settings.BracketedColumns},
-						securityChecker: checker,
-						omittedFields:   make(map[string]bool),
-					}}
-					return &ir, nil
-				}
-				return nil, fmt.Errorf("permission denied for join %s: requires %v", ep.Name, ep.Security.Permissions)
-			}
-		}
+	omitted, err := checkEndpointSecurity(ep, security)
+	if err != nil {
+		return nil, fmt.Errorf("join %s: %w", ep.Name, err)
+	}
+	if omitted {
+		return omittedSubIR(ep, security), nil
 	}
 
 	q, err := parse(query)
 	var ir SubIR = SubIR{IR: IR{
-		endpoint:        ep,
-		ast:             q,
-		error:           err,
-		sql:             &sql.Query{BracketedColumns: ep.Service.Settings.BracketedColumns},
-		securityChecker: checker,
-		omittedFields:   make(map[string]bool),
+		endpoint:      ep,
+		ast:           q,
+		error:         err,
+		sql:           &sql.Query{BracketedColumns: ep.Service.Settings.BracketedColumns},
+		security:      security,
+		omittedFields: make(map[string]bool),
+		maskedFields:  make(map[string]bool),
 	}}
 	return &ir, err
 }
 
+// Empty IR for joined table
+func omittedSubIR(ep *endpoint.Endpoint, security *securityCheck) *SubIR {
+	emptyAST := &ast.RequestStatements{Statements: []ast.Statement{}}
+	return &SubIR{IR: IR{
+		endpoint:      ep,
+		ast:           emptyAST,
+		sql:           &sql.Query{BracketedColumns: ep.Service.Settings.BracketedColumns},
+		security:      security,
+		omittedFields: make(map[string]bool),
+		maskedFields:  make(map[string]bool),
+		omitted:       true,
+	}}
+}
+
+// Check the endpoint policy. Returns true when the endpoint is omitted
+func checkEndpointSecurity(ep *endpoint.Endpoint, security *securityCheck) (bool, error) {
+	if security == nil {
+		return false, nil
+	}
+	if security.checker == nil {
+		if security.strict && declaresSecurity(ep) {
+			return false, fmt.Errorf("security checker required for endpoint %s", ep.Name)
+		}
+		return false, nil
+	}
+
+	if err := security.prefetch(ep); err != nil {
+		return false, fmt.Errorf("security check failed: %w", err)
+	}
+	if !checkedPolicy(ep.Security) {
+		return false, nil
+	}
+
+	allowed, err := ep.Security.Evaluate(security.allow)
+	if err != nil {
+		return false, fmt.Errorf("security check failed: %w", err)
+	}
+	if allowed {
+		return false, nil
+	}
+	if ep.Security.OnDeny == "omit" {
+		return true, nil
+	}
+	if ep.Security.Masks() {
+		// Fields inherit the policy and are masked
+		return false, nil
+	}
+	// OnDeny == "error"
+	return false, fmt.Errorf("permission denied: requires %s", ep.Security)
+}
+
 // Check if ir is group. If nil set value
 func (ir *IR) checkGroup(expected bool) bool {
 	if ir.isGroup == nil {
@@ -152,46 +212,70 @@ func (ir *IR) checkGroup(expected bool) bool {
 	return false
 }
 
+// Query has been evaluated with group functions
+func (ir *IR) grouped() bool {
+	return ir.isGroup != nil && *ir.isGroup
+}
+
 // checkFieldSecurity checks if the current user has permission to access a field.
-// Returns an error object if denied with onDeny="error", or records omission if onDeny="omit".
+// Returns an error object if denied with onDeny="error", or records omission if onDeny="omit"
+// and masking if onDeny="mask" or "partial".
 func (ir *IR) checkFieldSecurity(field *endpoint.Field) object.Object {
-	if ir.securityChecker == nil {
-		return nil
+	if errObj := ir.denyUnannotated(field); errObj != nil {
+		return errObj
 	}
 
-	// Determine the security policy: use field policy, or inherit from endpoint
-	policy := field.Security
-	if policy == nil || policy.IsEmpty() {
-		policy = ir.endpoint.Security
+	policy, errObj := ir.deniedPolicy(field)
+	if errObj != nil || policy == nil {
+		return errObj
 	}
 
-	// No security policy means no restrictions
-	if policy == nil || policy.IsEmpty() {
+	switch {
+	case policy.OnDeny == "omit":
+		// Mark field as omitted and continue
+		ir.omittedFields[field.Name] = true
+		return nil
+	case policy.Masks():
+		ir.maskedFields[field.Name] = true
 		return nil
 	}
+	// OnDeny == "error"
+	return newError("permission denied for field %s: requires %s", field.Name, policy)
+}
 
+// Unannotated fields are denied even without a checker when the service denies by default
+func (ir *IR) denyUnannotated(field *endpoint.Field) object.Object {
+	if ir.endpoint.Service != nil && ir.endpoint.Service.Settings.DenyByDefault && ir.endpoint.FieldPolicy(field) == nil {
+		return newError("permission denied for field %s: no security policy", field.Name)
+	}
+	return nil
+}
+
+// Policy of the field, or inherited from the endpoint, when the current user is denied access.
+// Returns nil when access is allowed.
+func (ir *IR) deniedPolicy(field *endpoint.Field) (*endpoint.SecurityPolicy, object.Object) {
+	if ir.security == nil || ir.security.checker == nil {
+		return nil, nil
+	}
+
+	// Determine the security policy: use field policy, or inherit from endpoint and service
+	policy := ir.endpoint.FieldPolicy(field)
+
+	// No security policy means no restrictions
 	// Wildcard means access is always allowed
-	if policy.HasWildcard() {
-		return nil
+	if !checkedPolicy(policy) {
+		return nil, nil
 	}
 
 	// Check permissions
-	allowed, err := ir.securityChecker.Allow(policy.Permissions)
+	allowed, err := policy.Evaluate(ir.security.allow)
 	if err != nil {
-		return newError("security check failed for field %s: %v", field.Name, err)
+		return nil, newError("security check failed for field %s: %v", field.Name, err)
 	}
-
-	if !allowed {
-		if policy.OnDeny == "omit" {
-			// Mark field as omitted and continue
-			ir.omittedFields[field.Name] = true
-			return nil
-		}
-		// OnDeny == "error"
-		return newError("permission denied for field %s: requires %v", field.Name, policy.Permissions)
+	if allowed {
+		return nil, nil
 	}
-
-	return nil
+	return policy, nil
 }
 
 // Parse incoming request
@@ -215,11 +299,16 @@ func parse(req string) (*ast.RequestStatements, error) {
 
 // Returns SQL Query for requested statement.
 // Run after all query inputs have been made.
+// Evaluating again renders the same query without evaluating the statements twice.
 func (pir *PrimaryIR) EvaluateQuery() (string, error) {
 	if pir.error != nil {
 		return "", pir.error
 	}
 
+	if pir.evaluated {
+		return pir.sql.ConstructQuery(), nil
+	}
+
 	result := pir.evalTable()
 
 	if isError(result) {
@@ -228,18 +317,72 @@ func (pir *PrimaryIR) EvaluateQuery() (string, error) {
 	}
 
 	if pir.orderByAST != nil {
-		evalOrderBy(pir.orderByAST, &pir.IR)
+		result = evalOrderBy(pir.orderByAST, &pir.IR)
+		if isError(result) {
+			pir.error = errors.New(result.String())
+			return "", pir.error
+		}
 	}
 
+	result = pir.checkLimitOperation()
+	if isError(result) {
+		pir.error = errors.New(result.String())
+		return "", pir.error
+	}
+
+	if pir.optimize {
+		pir.sql.Optimize()
+	}
+
+	pir.evaluated = true
+
 	return pir.sql.ConstructQuery(), nil
 }
 
+// Render joined queries and alias stages as named CTEs instead of nested sub queries.
+// Apply joins and semi joins stay inline since they are correlated to the parent row.
+func (pir *PrimaryIR) CTEMode(enabled bool) *PrimaryIR {
+	pir.sql.CTEMode = enabled
+	return pir
+}
+
+// Simplify the generated SQL without changing its results.
+// Plain joined queries are joined as tables and alias filters are inlined.
+func (pir *PrimaryIR) Optimize(enabled bool) *PrimaryIR {
+	pir.optimize = enabled
+	return pir
+}
+
 // Return a list of names for headers
 // Run Evaluate Query First!
 func (pir *PrimaryIR) FieldNames() []string {
 	return pir.sql.SelectNameList()
 }
 
+// Return a TypeScript interface of the result row
+// Run Evaluate Query First!
+func (pir *PrimaryIR) TypeScript(name string) string {
+	return pir.typeScript(name)
+}
+
+func (ir *IR) typeScript(name string) string {
+	var out strings.Builder
+	out.WriteString("interface " + name + " { ")
+	for _, ss := range ir.sql.SelectStatements {
+		out.WriteString("\n  ")
+		out.WriteString(ss.Name())
+		if ss.Nullable() {
+			out.WriteString("?")
+		}
+		out.WriteString(": ")
+		out.WriteString(endpoint.TSType(ss.ObjectType()))
+		out.WriteString(";")
+	}
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
 // Eval Table Query
 // Evaluate only top level query since this runs recursivly.
 // Evaluates joins then evalueates parent and adds fields into parent
@@ -253,37 +396,88 @@ func (ir *IR) evalTable() object.Object {
 	ir.sql.TableName = ir.endpoint.TableName
 	ir.sql.TableAlias = ir.endpoint.Name
 
+	if !ir.omitted {
+		if errObj := ir.checkExportOperation(); errObj != nil {
+			return errObj
+		}
+	}
+
 	// Eval Joins Before Parent
 	for _, js := range ir.joins {
 		result := js.childIR.evalTable()
 		if isError(result) {
 			return result
 		}
+		result = js.evalFilter()
+		if isError(result) {
+			return result
+		}
+		result = js.evalOrderBy()
+		if isError(result) {
+			return result
+		}
+	}
+
+	where := len(ir.sql.WhereStatements)
+	result := ir.evalTenant()
+	if isError(result) {
+		return result
+	}
+
+	ir.rowFilters = nil
+	ir.semiJoins = nil
+	result = ir.evalRowFilter()
+	if isError(result) {
+		return result
+	}
+	ir.tableFilters = append([]sqlExpr.Node{}, ir.sql.WhereStatements[where:]...)
+	for _, j := range ir.joins {
+		for _, rf := range j.childIR.rowFilters {
+			ir.rowFilters = append(ir.rowFilters, rf.under(j.alias))
+		}
 	}
 
 	local := objectRef.NewLocalReferences()
 
-	result := eval(ir.ast, ir, local)
+	result = eval(ir.ast, ir, local)
 	if isError(result) {
 		return result
 	}
 
 	ir.sql.RefLevel = local.Highest()
 
+	ir.evalNullable()
+
+	hidden := map[string]bool{}
+	if ir.nestKeys {
+		var errObj object.Object
+		if hidden, errObj = ir.selectNestKeys(); errObj != nil {
+			return errObj
+		}
+	}
+	keys := ir.nestKeyNames()
+
+	ir.columns = nil
+	for _, ss := range ir.sql.SelectStatements {
+		ir.columns = append(ir.columns, nestColumn{name: ss.Name(), key: utils.Array_Contains(keys, ss.Name()), hidden: hidden[ss.Name()]})
+	}
+
 	// Add statements from joins into parent.
 	for _, j := range ir.joins {
 		if ir.sql.RefLevel < objectRef.GROUP {
-			for _, ss := range j.childIR.sql.SelectStatements {
-				// Ignore child joined on since parent should be referenced instead
-				if ss.Name() == j.childOn {
+			for i, ss := range j.childIR.sql.SelectStatements {
+				// Ignore child joined on since parent should be referenced instead. Nest still needs the keys of the child
+				if utils.Array_Contains(j.childOns(), ss.Name()) && !j.childIR.columns[i].key {
 					continue
 				}
+				ir.columns = append(ir.columns, j.childIR.columns[i].under(j.alias))
 				fieldName := ss.Name()
 				joinedSelect := sql.SelectField{
 					Query:     ir.sql,
 					FieldName: &fieldName,
 					TableName: &j.alias,
 					ObjType:   ss.ObjectType(),
+					HasNull:   ss.Nullable() || j.statement.ChildNullable(),
 				}
 				ir.sql.SelectStatements = append(ir.sql.SelectStatements, &joinedSelect)
 			}
@@ -298,6 +492,29 @@ func (ir *IR) evalTable() object.Object {
 	return nil
 }
 
+// Parent columns can be NULL when any join keeps unmatched child rows. Ex. RIGHT or FULL
+func (ir *IR) outerParent() bool {
+	for _, j := range ir.joins {
+		if j.statement.ParentNullable() {
+			return true
+		}
+	}
+	return false
+}
+
+// Adjust nullability of select statements after evaluation.
+// Aggregates without GROUP BY return NULL on an empty table.
+func (ir *IR) evalNullable() {
+	for _, ss := range ir.sql.SelectStatements {
+		switch ss := ss.(type) {
+		case *sql.SelectGroupExpression:
+			if len(ir.sql.GroupByStatements) == 0 && *ss.Fn != "COUNT" {
+				ss.HasNull = true
+			}
+		}
+	}
+}
+
 // Evaluation loop Function
 // Eval statements and expressions based on AST
 func eval(node ast.Node, ir *IR, local *objectRef.LocalReferences) object.Object {
@@ -340,6 +557,10 @@ func eval(node ast.Node, ir *IR, local *objectRef.LocalReferences) object.Object
 		return evalInfixExpression(node.Operator, left, right, local)
 	case *ast.Reference:
 		return evalColumnCall(node, ir, local)
+	case *ast.PrincipalAttribute:
+		return evalPrincipalAttribute(node, ir)
+	case *ast.Parameter:
+		return evalParameter(node, ir)
 	case *ast.CallExpression:
 		return evalCallExpression(node.Function.TokenLiteral(), node.Arguments, ir, local)
 	default:
@@ -379,8 +600,10 @@ func evalColumnLiteral(node *ast.ColumnLiteral, ir *IR, local *objectRef.LocalRe
 		return err
 	}
 
-	// If field was omitted due to security, skip adding to select
+	// If field was omitted due to security, skip adding to select.
+	// Conditions that follow have no field to filter on
 	if ir.omittedFields[column.Name] {
+		ir.currentSelectStatement = nil
 		return nil
 	}
 
@@ -398,12 +621,20 @@ func evalColumnLiteral(node *ast.ColumnLiteral, ir *IR, local *objectRef.LocalRe
 		ir.currentSelectStatement = ir.sql.SelectStatements[selectStatementLoc]
 		ir.sql.SelectStatements = newSelectStatementList
 
+	} else if ir.maskedFields[column.Name] {
+		policy, errObj := ir.deniedPolicy(&column)
+		if errObj != nil {
+			return errObj
+		}
+		selects := ir.maskedSelect(&column, policy)
+		ir.currentSelectStatement = selects
+		ir.sql.SelectStatements = append(ir.sql.SelectStatements, selects)
 	} else {
 		selects := &sql.SelectField{
 			Query:     ir.sql,
 			FieldName: &column.Name,
 			TableName: &ir.endpoint.TableName,
-			HasNull:   column.Nullable,
+			HasNull:   column.Nullable || ir.outerParent(),
 			ObjType:   column.FieldType,
 		}
 		ir.currentSelectStatement = selects
@@ -448,6 +679,15 @@ func evalGroupFunction(
 		return newError("Group Function '%s' cannot be called on Non-Grouped Table '%s'", node.Fn, ir.endpoint.TableName)
 	}
 
+	omit, errObj := ir.checkGroupOperation(node.Fn)
+	if errObj != nil {
+		return errObj
+	}
+	if omit {
+		ir.currentSelectStatement = nil
+		return nil
+	}
+
 	subRef := objectRef.NewLocalReferences()
 	args := evalExpressions(node.Arguments, ir, subRef)
 
@@ -462,6 +702,13 @@ func evalGroupFunction(
 		return newError("Group Function Function '%s' not found", node.Fn)
 	}
 
+	if node.Fn == "SUM" || node.Fn == "COUNT" {
+		result := ir.checkFanOut(node.Fn, subRef)
+		if isError(result) {
+			return result
+		}
+	}
+
 	local.Append(subRef)
 
 	return groupFunctions[node.Fn](ir, local, args...)
@@ -497,15 +744,15 @@ func evalExpressionStatement(
 	switch highest {
 	case objectRef.FIELD:
 		if evaluated.Type() == objectType.BOOLEAN {
-			ir.sql.WhereStatements = append(ir.sql.WhereStatements, evaluated.String())
+			ir.sql.WhereStatements = append(ir.sql.WhereStatements, object.NodeOf(evaluated))
 		}
 	case objectRef.EXPRESSION:
 		if evaluated.Type() == objectType.BOOLEAN {
-			ir.sql.AliasWhereStatements = append(ir.sql.AliasWhereStatements, evaluated.String())
+			ir.sql.AliasWhereStatements = append(ir.sql.AliasWhereStatements, object.NodeOf(evaluated))
 		}
 	case objectRef.GROUP:
 		if evaluated.Type() == objectType.BOOLEAN {
-			ir.sql.HavingStatements = append(ir.sql.HavingStatements, evaluated.String())
+			ir.sql.HavingStatements = append(ir.sql.HavingStatements, object.NodeOf(evaluated))
 		}
 	}
 
@@ -539,7 +786,7 @@ func evalBangOperatorExpression(
 		return &object.Expression{
 			ExpressionType: objectType.BOOLEAN,
 			HasNull:        right.Nullable(),
-			Value:          fmt.Sprintf("!%s", right.String())}
+			Node:           &sqlExpr.Prefix{Operator: "!", Right: object.NodeOf(right)}}
 	default:
 		return newError("Invalid Bang Operator Expression %s", right.String())
 	}
@@ -554,7 +801,7 @@ func evalMinusPrefixOperatorExpression(
 		return &object.Expression{
 			ExpressionType: objectType.INTEGER,
 			HasNull:        right.Nullable(),
-			Value:          fmt.Sprintf("-%s", right.String())}
+			Node:           &sqlExpr.Prefix{Operator: "-", Right: object.NodeOf(right)}}
 	default:
 		return newError("Invalid Minus Prefix Operator Expression %s", right.String())
 	}
@@ -582,62 +829,64 @@ func evalInfixExpression(
 		return &object.Expression{
 			ExpressionType: objectType.BOOLEAN,
 			HasNull:        nullable,
-			Value:          fmt.Sprintf("(%s = %s)", left.String(), right.String())}
+			Node:           &sqlExpr.Binary{Operator: "=", Left: object.NodeOf(left), Right: object.NodeOf(right)}}
 	case operator == "!=":
 		return &object.Expression{
 			ExpressionType: objectType.BOOLEAN,
 			HasNull:        nullable,
-			Value:          fmt.Sprintf("(%s != %s)", left.String(), right.String())}
+			Node:           &sqlExpr.Binary{Operator: "!=", Left: object.NodeOf(left), Right: object.NodeOf(right)}}
 	case operator == ">":
 		return &object.Expression{
 			ExpressionType: objectType.BOOLEAN,
 			HasNull:        nullable,
-			Value:          fmt.Sprintf("(%s > %s)", left.String(), right.String())}
+			Node:           &sqlExpr.Binary{Operator: ">", Left: object.NodeOf(left), Right: object.NodeOf(right)}}
 	case operator == "<":
 		return &object.Expression{
 			ExpressionType: objectType.BOOLEAN,
 			HasNull:        nullable,
-			Value:          fmt.Sprintf("(%s < %s)", left.String(), right.String())}
+			Node:           &sqlExpr.Binary{Operator: "<", Left: object.NodeOf(left), Right: object.NodeOf(right)}}
 	case operator == ">=":
 		return &object.Expression{
 			ExpressionType: objectType.BOOLEAN,
 			HasNull:        nullable,
-			Value:          fmt.Sprintf("(%s >= %s)", left.String(), right.String())}
+			Node:           &sqlExpr.Binary{Operator: ">=", Left: object.NodeOf(left), Right: object.NodeOf(right)}}
 	case operator == "<=":
 		return &object.Expression{
 			ExpressionType: objectType.BOOLEAN,
 			HasNull:        nullable,
-			Value:          fmt.Sprintf("(%s <= %s)", left.String(), right.String())}
+			Node:           &sqlExpr.Binary{Operator: "<=", Left: object.NodeOf(left), Right: object.NodeOf(right)}}
+	case operator == "IN":
+		return evalInExpression(left, right, nullable)
 	case operator == "AND":
 		return &object.Expression{
 			ExpressionType: objectType.BOOLEAN,
 			HasNull:        nullable,
-			Value:          fmt.Sprintf("(%s AND %s)", left.String(), right.String())}
+			Node:           &sqlExpr.Binary{Operator: "AND", Left: object.NodeOf(left), Right: object.NodeOf(right)}}
 	case operator == "OR":
 		return &object.Expression{
 			ExpressionType: objectType.BOOLEAN,
 			HasNull:        nullable,
-			Value:          fmt.Sprintf("(%s OR %s)", left.String(), right.String())}
+			Node:           &sqlExpr.Binary{Operator: "OR", Left: object.NodeOf(left), Right: object.NodeOf(right)}}
 	case operator == "*":
 		return &object.Expression{
 			ExpressionType: objectType.INTEGER,
 			HasNull:        nullable,
-			Value:          fmt.Sprintf("(%s * %s)", left.String(), right.String())}
+			Node:           &sqlExpr.Binary{Operator: "*", Left: object.NodeOf(left), Right: object.NodeOf(right)}}
 	case operator == "/":
 		return &object.Expression{
 			ExpressionType: objectType.INTEGER,
 			HasNull:        nullable,
-			Value:          fmt.Sprintf("(%s / %s)", left.String(), right.String())}
+			Node:           &sqlExpr.Binary{Operator: "/", Left: object.NodeOf(left), Right: object.NodeOf(right)}}
 	case operator == "+":
 		return &object.Expression{
 			ExpressionType: objectType.INTEGER,
 			HasNull:        nullable,
-			Value:          fmt.Sprintf("(%s + %s)", left.String(), right.String())}
+			Node:           &sqlExpr.Binary{Operator: "+", Left: object.NodeOf(left), Right: object.NodeOf(right)}}
 	case operator == "-":
 		return &object.Expression{
 			ExpressionType: objectType.INTEGER,
 			HasNull:        nullable,
-			Value:          fmt.Sprintf("(%s - %s)", left.String(), right.String())}
+			Node:           &sqlExpr.Binary{Operator: "-", Left: object.NodeOf(left), Right: object.NodeOf(right)}}
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
@@ -658,17 +907,34 @@ func evalInfixNullExpression(
 		return &object.Expression{
 			ExpressionType: objectType.BOOLEAN,
 			HasNull:        true,
-			Value:          fmt.Sprintf("(%s IS %s)", ref.String(), null.String())}
+			Node:           &sqlExpr.Binary{Operator: "IS", Left: object.NodeOf(ref), Right: object.NodeOf(null)}}
 	case operator == "!=":
 		return &object.Expression{
 			ExpressionType: objectType.BOOLEAN,
 			HasNull:        false,
-			Value:          fmt.Sprintf("(%s IS NOT %s)", ref.String(), null.String())}
+			Node:           &sqlExpr.Binary{Operator: "IS NOT", Left: object.NodeOf(ref), Right: object.NodeOf(null)}}
 	default:
 		return newError("unknown operator: %s %s %s", ref.Type(), operator, null.Type())
 	}
 }
 
+// Right side must be a list. An empty list matches no rows
+func evalInExpression(left, right object.Object, nullable bool) object.Object {
+	list, ok := right.(*object.List)
+	if !ok {
+		return newError("IN requires a list. got=%s", right.Type())
+	}
+	if len(list.Elements) == 0 {
+		return &object.Expression{
+			ExpressionType: objectType.BOOLEAN,
+			Node:           &sqlExpr.Binary{Operator: "=", Left: &sqlExpr.Literal{Value: "1"}, Right: &sqlExpr.Literal{Value: "0"}}}
+	}
+	return &object.Expression{
+		ExpressionType: objectType.BOOLEAN,
+		HasNull:        nullable,
+		Node:           &sqlExpr.Binary{Operator: "IN", Left: object.NodeOf(left), Right: object.NodeOf(right)}}
+}
+
 // Evaluate @ for expressions
 // WARN: Cannot call alias
 func evalColumnCall(
@@ -686,22 +952,25 @@ func evalColumnCall(
 	}
 
 	if node.Argument == nil {
+		if errObj := ir.refuseDenied(ir.currentSelectStatement.Name()); errObj != nil {
+			return errObj
+		}
 		switch ir.currentSelectStatement.Type() {
 		case "FIELD":
 			local.Set(ir.currentSelectStatement.Name(), objectRef.FIELD)
 			return &object.Expression{ExpressionType: ir.currentSelectStatement.ObjectType(),
 				HasNull: ir.currentSelectStatement.Nullable(),
-				Value:   fmt.Sprintf("%s.[%s]", ir.endpoint.TableName, ir.currentSelectStatement.Name())}
+				Node:    &sqlExpr.Column{Table: ir.endpoint.TableName, Name: ir.currentSelectStatement.Name()}}
 		case "EXPRESSION":
 			local.Set(ir.currentSelectStatement.Name(), objectRef.EXPRESSION)
 			return &object.Expression{ExpressionType: ir.currentSelectStatement.ObjectType(),
 				HasNull: ir.currentSelectStatement.Nullable(),
-				Value:   fmt.Sprintf("%s.[%s]", ir.endpoint.Name, ir.currentSelectStatement.Name())}
+				Node:    &sqlExpr.Column{Table: ir.endpoint.Name, Name: ir.currentSelectStatement.Name()}}
 		case "GROUP_FIELD":
 			local.Set(ir.currentSelectStatement.Name(), objectRef.GROUP)
 			return &object.Expression{ExpressionType: ir.currentSelectStatement.ObjectType(),
 				HasNull: ir.currentSelectStatement.Nullable(),
-				Value:   fmt.Sprintf("%s.[%s]", ir.endpoint.TableName, ir.currentSelectStatement.Name())}
+				Node:    &sqlExpr.Column{Table: ir.endpoint.TableName, Name: ir.currentSelectStatement.Name()}}
 		case "GROUP_EXPRESSION":
 			local.Set(ir.currentSelectStatement.Name(), objectRef.GROUP)
 			ge := ir.currentSelectStatement.(*sql.SelectGroupExpression)
@@ -721,18 +990,22 @@ func evalColumnCall(
 
 	str := eval.(*object.String)
 
+	if errObj := ir.refuseDenied(str.Value); errObj != nil {
+		return errObj
+	}
+
 	if field, ok := ir.endpoint.Fields[str.Value]; ok {
 		local.Set(field.Name, objectRef.FIELD)
 		return &object.Expression{ExpressionType: field.FieldType,
-			HasNull: field.Nullable,
-			Value:   fmt.Sprintf("%s.[%s]", ir.endpoint.TableName, str.Value)}
+			HasNull: field.Nullable || ir.outerParent(),
+			Node:    &sqlExpr.Column{Table: ir.endpoint.TableName, Name: str.Value}}
 	}
 
 	if joined, ok := ir.sql.GetJoinedStatement(str.Value); ok {
 		local.Set(joined.Statement(), objectRef.FIELD)
 		return &object.Expression{ExpressionType: joined.ObjectType(),
 			HasNull: joined.Nullable(),
-			Value:   joined.Statement()}
+			Node:    &sqlExpr.Column{Table: *joined.TableName, Name: *joined.FieldName}}
 	}
 
 	return newError("Column Call %s not found", eval.String())